@@ -39,6 +39,7 @@ const (
 	MimetypeDataWithValidator = "data/validator"
 	MimetypeTypedData         = "data/typed"
 	MimetypeClique            = "application/x-clique-header"
+	MimetypeBFT               = "application/x-bft-vote"
 	MimetypeTextPlain         = "text/plain"
 )
 
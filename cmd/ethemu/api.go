@@ -0,0 +1,479 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	errInvalidRate     = errors.New("workload rate must be non-negative")
+	errInvalidFraction = errors.New("fraction of nodes must be in (0, 1]")
+	errInvalidDepth    = errors.New("confirmation depth must be positive")
+)
+
+// workload paces the blocks or transactions generated by the orchestrator and
+// tracks its position, so that checkpoints can record and restore it.
+type workload struct {
+	interval atomic.Int64 // Time between two work items in nanoseconds, 0 = unthrottled
+	txMode   bool         // Whether transactions are generated instead of blocks
+
+	seed   int64
+	source *countingSource
+	rand   *rand.Rand // Random source picking senders and sealers, only used under lock
+	cursor uint64     // Work items generated so far, only changed under lock
+
+	lock sync.Mutex // Held while generating a work item, checkpoints hold it to halt the workload
+}
+
+func newWorkload(rate float64, txMode bool, seed int64) *workload {
+	w := &workload{
+		txMode: txMode,
+		seed:   seed,
+		source: &countingSource{src: rand.NewSource(seed)},
+	}
+	w.rand = rand.New(w.source)
+	w.setRate(rate)
+	return w
+}
+
+// restoreWorkload recreates the workload recorded in a checkpoint, replaying
+// the random source up to the recorded position.
+func restoreWorkload(state emu.Workload) *workload {
+	w := newWorkload(state.Rate, state.TxMode, state.Seed)
+	for w.source.draws < state.Draws {
+		w.source.Int63()
+	}
+	w.cursor = state.Cursor
+	return w
+}
+
+// state returns the position of the workload. The lock must be held.
+func (w *workload) state() emu.Workload {
+	return emu.Workload{
+		TxMode: w.txMode,
+		Rate:   w.rate(),
+		Cursor: w.cursor,
+		Seed:   w.seed,
+		Draws:  w.source.draws,
+	}
+}
+
+// rate returns the number of work items generated per second, 0 if unthrottled.
+func (w *workload) rate() float64 {
+	interval := w.interval.Load()
+	if interval == 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(interval)
+}
+
+// setRate changes the number of work items generated per second.
+func (w *workload) setRate(rate float64) {
+	if rate <= 0 || math.IsInf(rate, 1) {
+		w.interval.Store(0)
+		return
+	}
+	w.interval.Store(int64(float64(time.Second) / rate))
+}
+
+// wait blocks until the next work item is due.
+func (w *workload) wait() {
+	if interval := w.interval.Load(); interval > 0 {
+		time.Sleep(time.Duration(interval))
+	}
+}
+
+// countingSource is a random source counting the values drawn from it, so that
+// its state can be restored by replaying as many draws on the same seed.
+type countingSource struct {
+	src   rand.Source
+	draws uint64
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.draws = 0
+}
+
+// emuAPI is the control API of a running emulation, served by the orchestrator
+// in the emu_ namespace.
+type emuAPI struct {
+	nodes    map[common.Address]*node.Node
+	eths     map[common.Address]*eth.Ethereum
+	threads  int
+	workload *workload
+
+	lock sync.Mutex // Serialises partitions and checkpoints
+}
+
+func newEmuAPI(nodes map[common.Address]*node.Node, eths map[common.Address]*eth.Ethereum, threads int, workload *workload) *emuAPI {
+	return &emuAPI{
+		nodes:    nodes,
+		eths:     eths,
+		threads:  threads,
+		workload: workload,
+	}
+}
+
+// startControl serves the control API over HTTP and WebSocket on the given
+// endpoint.
+func startControl(endpoint string, api *emuAPI) (*http.Server, error) {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("emu", api); err != nil {
+		return nil, err
+	}
+	// The full API of every node is served below /node/<id>, which is the only
+	// way to reach lean nodes
+	handlers := map[string]http.Handler{"/": rpcHandler(srv)}
+	for addr, stack := range api.nodes {
+		nodeSrv, err := stack.RPCHandler()
+		if err != nil {
+			return nil, err
+		}
+		handlers[fmt.Sprintf("/node/%d", emu.Global.Nodes[addr].Identity)] = rpcHandler(nodeSrv)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		if path == "" {
+			path = "/"
+		}
+		h, ok := handlers[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+	server, addr, err := node.StartHTTPEndpoint(endpoint, rpc.DefaultHTTPTimeouts, handler)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Emulator control endpoint opened", "url", fmt.Sprintf("http://%v/", addr), "ws", fmt.Sprintf("ws://%v/", addr), "nodes", fmt.Sprintf("http://%v/node/<id>", addr))
+	return server, nil
+}
+
+// rpcHandler serves an RPC server over both HTTP and WebSocket.
+func rpcHandler(srv *rpc.Server) http.Handler {
+	httpHandler := node.NewHTTPHandlerStack(srv, []string{"*"}, []string{"*"}, nil)
+	wsHandler := node.NewWSHandlerStack(srv.WebsocketHandler([]string{"*"}), nil)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			wsHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
+
+// stack retrieves the node with the given address.
+func (api *emuAPI) stack(addr common.Address) (*node.Node, error) {
+	stack, ok := api.nodes[addr]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", emu.ErrNodeNotFound, addr)
+	}
+	return stack, nil
+}
+
+// Nodes lists all emulated nodes along with their heads and peers.
+func (api *emuAPI) Nodes() []*emu.NodeInfo {
+	infos := make([]*emu.NodeInfo, 0, len(api.nodes))
+	for addr, stack := range api.nodes {
+		backend := api.eths[addr]
+		head := backend.BlockChain().CurrentBlock()
+		info := &emu.NodeInfo{
+			Identity: emu.Global.Nodes[addr].Identity,
+			Address:  addr,
+			Enode:    stack.Server().Self().URLv4(),
+			Number:   hexutil.Uint64(head.Number.Uint64()),
+			Head:     head.Hash(),
+			Peers:    []common.Address{},
+			Mining:   backend.IsMining(),
+			Paused:   emu.Paused(addr),
+			Versions: backend.ProtocolVersions(),
+			Clock:    backend.BlockChain().Clock().Now().Sub(time.Now()).Milliseconds(),
+		}
+		if profile := emu.Global.Nodes[addr].Profile; profile != nil {
+			info.Profile = profile.Name
+		}
+		for _, peer := range stack.Server().Peers() {
+			if remote, ok := emu.NodeAddress(peer.ID()); ok {
+				info.Peers = append(info.Peers, remote)
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Identity < infos[j].Identity
+	})
+	return infos
+}
+
+// Links lists the connections of all emulated nodes along with the eth protocol
+// version negotiated on each. Every connection is reported from both ends.
+func (api *emuAPI) Links() []*emu.LinkInfo {
+	var links []*emu.LinkInfo
+	for addr, stack := range api.nodes {
+		for _, peer := range stack.Server().Peers() {
+			remote, ok := emu.NodeAddress(peer.ID())
+			if !ok {
+				continue
+			}
+			version, ok := api.eths[addr].PeerVersion(peer.ID())
+			if !ok {
+				continue
+			}
+			links = append(links, &emu.LinkInfo{From: addr, To: remote, Version: version})
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		from, to := emu.Global.Nodes[links[i].From].Identity, emu.Global.Nodes[links[j].From].Identity
+		if from != to {
+			return from < to
+		}
+		return emu.Global.Nodes[links[i].To].Identity < emu.Global.Nodes[links[j].To].Identity
+	})
+	return links
+}
+
+// AddLink connects two nodes. Nodes that were connected shortly before only
+// redial each other once the dial history of the p2p server expires.
+func (api *emuAPI) AddLink(a, b common.Address) error {
+	stackA, err := api.stack(a)
+	if err != nil {
+		return err
+	}
+	stackB, err := api.stack(b)
+	if err != nil {
+		return err
+	}
+	stackA.Server().AddPeer(stackB.Server().Self())
+	return nil
+}
+
+// RemoveLink disconnects two nodes and stops them from redialing each other.
+func (api *emuAPI) RemoveLink(a, b common.Address) error {
+	stackA, err := api.stack(a)
+	if err != nil {
+		return err
+	}
+	stackB, err := api.stack(b)
+	if err != nil {
+		return err
+	}
+	stackA.Server().RemovePeer(stackB.Server().Self())
+	stackB.Server().RemovePeer(stackA.Server().Self())
+	return nil
+}
+
+// SetLink changes the latency, bandwidth and loss of both directions of the link
+// between two nodes. Zero values fall back to the global defaults.
+func (api *emuAPI) SetLink(a, b common.Address, link emu.Link) error {
+	if _, err := api.stack(a); err != nil {
+		return err
+	}
+	if _, err := api.stack(b); err != nil {
+		return err
+	}
+	if err := emu.CheckLink(link); err != nil {
+		return err
+	}
+	emu.SetLink(a, b, link)
+	return nil
+}
+
+// SetLinkDirection changes the latency, bandwidth and loss of the direction of
+// the link from one node to another only. Zero values fall back to the global
+// defaults.
+func (api *emuAPI) SetLinkDirection(from, to common.Address, link emu.Link) error {
+	if _, err := api.stack(from); err != nil {
+		return err
+	}
+	if _, err := api.stack(to); err != nil {
+		return err
+	}
+	if err := emu.CheckLink(link); err != nil {
+		return err
+	}
+	emu.SetLinkDirection(from, to, link)
+	return nil
+}
+
+// GetLink retrieves the effective latency, bandwidth and loss of the direction
+// of the link from node a to node b.
+func (api *emuAPI) GetLink(a, b common.Address) (emu.Link, error) {
+	if _, err := api.stack(a); err != nil {
+		return emu.Link{}, err
+	}
+	if _, err := api.stack(b); err != nil {
+		return emu.Link{}, err
+	}
+	return emu.GetLink(a, b), nil
+}
+
+// SetDefaultLink changes the latency, bandwidth and loss of all links without an
+// override. Zero values leave the current setting untouched.
+func (api *emuAPI) SetDefaultLink(link emu.Link) error {
+	if err := emu.CheckLink(link); err != nil {
+		return err
+	}
+	emu.SetDefaultLink(link)
+	return nil
+}
+
+// Partition splits the network into the given groups by dropping every link
+// crossing a group boundary. Nodes missing from all groups form one more group.
+// Until healed, nodes in different groups refuse to connect and do not discover
+// each other. A partition replaces the previous one, though links cut before
+// stay cut.
+func (api *emuAPI) Partition(groups [][]common.Address) error {
+	group := make(map[common.Address]int)
+	for i, members := range groups {
+		for _, addr := range members {
+			if _, err := api.stack(addr); err != nil {
+				return err
+			}
+			group[addr] = i + 1
+		}
+	}
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	emu.Partition(group)
+	for addr, stack := range api.nodes {
+		for _, peer := range stack.Server().Peers() {
+			remote, ok := emu.NodeAddress(peer.ID())
+			if !ok || group[addr] == group[remote] {
+				continue
+			}
+			emu.CutLink(addr, remote)
+			api.RemoveLink(addr, remote)
+		}
+	}
+	return nil
+}
+
+// Heal restores all links dropped by previous partitions, subject to the same
+// redial delay as AddLink.
+func (api *emuAPI) Heal() {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	for _, link := range emu.Heal() {
+		api.AddLink(link[0], link[1])
+	}
+}
+
+// Pause freezes a node: it stops mining and stops processing inbound messages.
+func (api *emuAPI) Pause(addr common.Address) error {
+	if _, err := api.stack(addr); err != nil {
+		return err
+	}
+	if emu.Pause(addr) {
+		api.eths[addr].StopMining()
+	}
+	return nil
+}
+
+// Resume lets a paused node continue, processing everything queued meanwhile.
+func (api *emuAPI) Resume(addr common.Address) error {
+	if _, err := api.stack(addr); err != nil {
+		return err
+	}
+	if emu.Resume(addr) {
+		return api.eths[addr].StartMining(api.threads)
+	}
+	return nil
+}
+
+// Work makes a node seal a block on top of its current head.
+func (api *emuAPI) Work(addr common.Address) error {
+	if _, err := api.stack(addr); err != nil {
+		return err
+	}
+	api.eths[addr].Miner().Work()
+	return nil
+}
+
+// WorkloadRate returns the number of blocks or transactions the orchestrator
+// generates per second, 0 if unthrottled.
+func (api *emuAPI) WorkloadRate() float64 {
+	return api.workload.rate()
+}
+
+// SetWorkloadRate changes the number of blocks or transactions the orchestrator
+// generates per second, 0 removes the throttling.
+func (api *emuAPI) SetWorkloadRate(rate float64) error {
+	if rate < 0 {
+		return errInvalidRate
+	}
+	api.workload.setRate(rate)
+	return nil
+}
+
+// TxTransmissions returns how often a transaction reached nodes in full or
+// announced, and how many of these transmissions were redundant.
+func (api *emuAPI) TxTransmissions(hash common.Hash) *emu.TxTransmissions {
+	return emu.GetTxTransmissions(hash)
+}
+
+// TxRedundancy sums the transmission counters of all tracked transactions.
+func (api *emuAPI) TxRedundancy() *emu.TxRedundancy {
+	return emu.TotalTxTransmissions()
+}
+
+// TxLifecycle returns the path of a transaction through the network: when it
+// was submitted, reached every node and entered their pools, why pools dropped
+// it and when it was included and confirmed.
+func (api *emuAPI) TxLifecycle(hash common.Hash) *emu.TxLifecycle {
+	return emu.GetTxLifecycle(hash)
+}
+
+// TxStats summarises the tracked transactions: the time they took to reach the
+// given fraction of nodes and from submission until the given number of
+// confirmations on the submitting node.
+func (api *emuAPI) TxStats(fraction float64, depth uint64) (*emu.TxStats, error) {
+	if fraction <= 0 || fraction > 1 {
+		return nil, errInvalidFraction
+	}
+	if depth == 0 {
+		return nil, errInvalidDepth
+	}
+	return emu.GetTxStats(fraction, depth), nil
+}
@@ -0,0 +1,401 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/ethclient/emuclient"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/debug"
+	"github.com/ethereum/go-ethereum/internal/flags"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/urfave/cli/v2"
+)
+
+// checkpointTxsFile is the file in a node directory of a checkpoint holding the
+// transactions of its pool.
+const checkpointTxsFile = "txpool.rlp"
+
+var (
+	errCheckpointExists = errors.New("checkpoint directory already exists")
+	errDataDirExists    = errors.New("data directory already holds an emulation")
+)
+
+var (
+	checkpointCommand = &cli.Command{
+		Action:    checkpoint,
+		Name:      "checkpoint",
+		Usage:     "Snapshot a running emulation",
+		ArgsUsage: "<checkpointDir>",
+		Flags:     []cli.Flag{utils.ControlAddrFlag},
+		Description: `
+The checkpoint command asks a running emulation through its control endpoint,
+opened with --control.addr, to halt its workload and all nodes, flush their
+databases and copy the whole network into the given directory, which must not
+exist yet. The emulation continues right afterwards.
+
+The directory is created on the host running the emulation.`,
+	}
+	resumeCommand = &cli.Command{
+		Action:    resume,
+		Name:      "resume",
+		Usage:     "Continue an emulation from a checkpoint",
+		ArgsUsage: "<checkpointDir>",
+		Flags: flags.Merge(
+			nodeFlags,
+			rpcFlags,
+			debug.Flags,
+			emuFlags),
+		Description: `
+The resume command copies a checkpoint into the data directory and continues the
+emulation exactly where the checkpoint was taken: every node restarts from its
+recorded head and pool content, and the orchestrator from its recorded workload
+position. Resuming the same checkpoint into different data directories forks
+independent experiments from one network.`,
+	}
+)
+
+func checkpoint(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	dir, err := filepath.Abs(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	endpoint := ctx.String(utils.ControlAddrFlag.Name)
+	if endpoint == "" {
+		utils.Fatalf("The control endpoint of the emulation is required (--%s).", utils.ControlAddrFlag.Name)
+	}
+	client, err := emuclient.Dial("http://" + endpoint)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	cp, err := client.Checkpoint(context.Background(), dir)
+	if err != nil {
+		return err
+	}
+	for _, node := range cp.Nodes {
+		fmt.Printf("emu%06d number=%d head=%x pending=%d queued=%d paused=%v\n", node.Identity, node.Number, node.Head, node.Pending, node.Queued, node.Paused)
+	}
+	fmt.Printf("Checkpoint written to %s, workload cursor %d\n", dir, cp.Workload.Cursor)
+	return nil
+}
+
+func resume(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	if !ctx.IsSet(utils.DataDirFlag.Name) {
+		utils.Fatalf("The data directory to continue in must be set with --%s.", utils.DataDirFlag.Name)
+	}
+	src, err := filepath.Abs(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	dataDir, err := filepath.Abs(ctx.String(utils.DataDirFlag.Name))
+	if err != nil {
+		return err
+	}
+	cp, err := emu.LoadCheckpoint(src)
+	if err != nil {
+		return err
+	}
+	// Resuming in place consumes the checkpoint, otherwise it is copied so that
+	// it can be resumed again
+	if src != dataDir {
+		if common.FileExist(filepath.Join(dataDir, emu.CONFIG_JSON)) {
+			if !ctx.Bool(utils.ForceFlag.Name) {
+				return fmt.Errorf("%w: %s", errDataDirExists, dataDir)
+			}
+			if err := os.RemoveAll(dataDir); err != nil {
+				return err
+			}
+		}
+		if err := copyDir(src, dataDir, nil); err != nil {
+			return err
+		}
+	}
+	log.Info("Resuming emulation", "checkpoint", src, "taken", cp.Time, "cursor", cp.Workload.Cursor)
+	return run(ctx, cp)
+}
+
+// Checkpoint halts the workload and all nodes, copies the network into the given
+// directory and lets everything continue afterwards. The directory must not
+// exist yet and is resolved on the host running the emulation.
+func (api *emuAPI) Checkpoint(dir string) (*emu.Checkpoint, error) {
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("%w: %s", errCheckpointExists, dir)
+	}
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	// Wait for the work item in progress, then freeze all nodes that aren't
+	// paused already
+	api.workload.lock.Lock()
+	defer api.workload.lock.Unlock()
+
+	paused := make(map[common.Address]bool)
+	for addr := range api.nodes {
+		if emu.Pause(addr) {
+			api.eths[addr].StopMining()
+		} else {
+			paused[addr] = true
+		}
+	}
+	defer func() {
+		for addr := range api.nodes {
+			if !paused[addr] && emu.Resume(addr) {
+				if err := api.eths[addr].StartMining(api.threads); err != nil {
+					log.Error("Failed to restart mining after checkpoint", "node", addr, "err", err)
+				}
+			}
+		}
+	}()
+	start := time.Now()
+	cp := &emu.Checkpoint{
+		Time:     start,
+		Clocks:   emu.ClockElapsed(),
+		Workload: api.workload.state(),
+		Links:    emu.Links(),
+	}
+	cp.Groups, cp.Cut = emu.Partitioned()
+	for addr, stack := range api.nodes {
+		node, err := checkpointNode(dir, stack, api.eths[addr])
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		node.Identity = emu.Global.Nodes[addr].Identity
+		node.Address = addr
+		node.Paused = paused[addr]
+		cp.Nodes = append(cp.Nodes, node)
+	}
+	sort.Slice(cp.Nodes, func(i, j int) bool {
+		return cp.Nodes[i].Identity < cp.Nodes[j].Identity
+	})
+	if err := emu.StoreConfig(dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := emu.StoreCheckpoint(dir, cp); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	log.Info("Checkpointed emulation", "dir", dir, "nodes", len(cp.Nodes), "cursor", cp.Workload.Cursor, "elapsed", common.PrettyDuration(time.Since(start)))
+	return cp, nil
+}
+
+// checkpointTxs is the pool content of a node stored in a checkpoint.
+type checkpointTxs struct {
+	Locals  []*types.Transaction
+	Remotes []*types.Transaction
+}
+
+// checkpointNode copies the data directory of a halted node into the checkpoint
+// directory, along with the content of its transaction pool.
+func checkpointNode(dir string, stack *node.Node, backend *eth.Ethereum) (*emu.NodeCheckpoint, error) {
+	var (
+		nodeDir   = filepath.Join(dir, filepath.Base(stack.DataDir()))
+		chainData = stack.ResolvePath("chaindata")
+	)
+	rel, err := filepath.Rel(stack.DataDir(), chainData)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyDir(stack.DataDir(), nodeDir, map[string]bool{chainData: true}); err != nil {
+		return nil, err
+	}
+	// Persist the head state before copying the database
+	if err := backend.BlockChain().Flush(); err != nil {
+		return nil, err
+	}
+	if err := copyDatabase(backend.ChainDb(), filepath.Join(nodeDir, rel)); err != nil {
+		return nil, err
+	}
+	head := backend.BlockChain().CurrentBlock()
+	checkpoint := &emu.NodeCheckpoint{
+		Number: hexutil.Uint64(head.Number.Uint64()),
+		Head:   head.Hash(),
+	}
+	// Record the pool content, keeping local transactions apart so that they
+	// keep their priority once resumed
+	var (
+		txs             checkpointTxs
+		pending, queued = backend.TxPool().Content()
+		locals          = make(map[common.Address]bool)
+	)
+	for _, addr := range backend.TxPool().Locals() {
+		locals[addr] = true
+	}
+	for _, content := range []map[common.Address]types.Transactions{pending, queued} {
+		for addr, list := range content {
+			if locals[addr] {
+				txs.Locals = append(txs.Locals, list...)
+			} else {
+				txs.Remotes = append(txs.Remotes, list...)
+			}
+		}
+	}
+	for _, list := range pending {
+		checkpoint.Pending += len(list)
+	}
+	for _, list := range queued {
+		checkpoint.Queued += len(list)
+	}
+	blob, err := rlp.EncodeToBytes(&txs)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(nodeDir, checkpointTxsFile), blob, 0644); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// restoreCheckpoint brings freshly started nodes back into the state recorded in
+// a checkpoint: their pools are refilled, link overrides reapplied and nodes
+// paused at the time are paused again.
+func restoreCheckpoint(cp *emu.Checkpoint, nodes map[common.Address]*node.Node, eths map[common.Address]*eth.Ethereum) error {
+	for _, link := range cp.Links {
+		emu.SetLinkDirection(link.A, link.B, link.Link)
+	}
+	for _, checkpoint := range cp.Nodes {
+		backend, ok := eths[checkpoint.Address]
+		if !ok {
+			return fmt.Errorf("%w: %v", emu.ErrNodeNotFound, checkpoint.Address)
+		}
+		blob, err := os.ReadFile(filepath.Join(nodes[checkpoint.Address].DataDir(), checkpointTxsFile))
+		if err != nil {
+			return err
+		}
+		var txs checkpointTxs
+		if err := rlp.DecodeBytes(blob, &txs); err != nil {
+			return err
+		}
+		backend.TxPool().AddLocals(txs.Locals)
+		backend.TxPool().AddRemotes(txs.Remotes)
+
+		if head := backend.BlockChain().CurrentBlock(); head.Hash() != checkpoint.Head {
+			log.Warn("Node resumed from a different head", "node", checkpoint.Address, "number", head.Number, "hash", head.Hash(), "checkpoint", checkpoint.Head)
+		}
+		if checkpoint.Paused && emu.Pause(checkpoint.Address) {
+			backend.StopMining()
+		}
+	}
+	return nil
+}
+
+// copyDir recursively copies the regular files of a directory, leaving out the
+// given paths as well as database locks and IPC sockets.
+func copyDir(src, dst string, skip map[string]bool) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip[path] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case !d.Type().IsRegular(), d.Name() == "LOCK":
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyDatabase writes every entry of a database into a new database at the
+// given path.
+func copyDatabase(src ethdb.Database, path string) error {
+	dst, err := rawdb.NewBadgerDBDatabase(path, 0, 0, "", false)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	it := src.NewIterator(nil, nil)
+	defer it.Release()
+
+	batch := dst.NewBatch()
+	for it.Next() {
+		if err := batch.Put(common.CopyBytes(it.Key()), it.Value()); err != nil {
+			return err
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/urfave/cli/v2"
+)
+
+// churner periodically drops a fraction of the connections of every node, the
+// peers being picked by the eviction policy of the node. Discovering nodes fill
+// the freed slots through their dialer, otherwise every dropped link is rewired
+// to a random node, keeping the degree of the node but changing the topology.
+//
+// Every event is logged to churn.csv as ms,node,peer,event,policy, where the
+// event is drop for evicted peers and dial for their replacements.
+type churner struct {
+	nodes    map[common.Address]*node.Node
+	rate     float64
+	interval time.Duration
+	rewire   bool
+	policy   string
+	log      *os.File
+	quit     chan struct{}
+}
+
+// startChurn starts rewiring the network as configured on the command line. The
+// returned function stops churning again.
+func startChurn(ctx *cli.Context, nodes map[common.Address]*node.Node) (func(), error) {
+	rate := ctx.Float64(utils.ChurnRateFlag.Name)
+	if rate <= 0 {
+		return func() {}, nil
+	}
+	if rate > 1 {
+		return nil, fmt.Errorf("churn rate %v above 1", rate)
+	}
+	interval := ctx.Duration(utils.ChurnIntervalFlag.Name)
+	if interval <= 0 {
+		return nil, fmt.Errorf("churn interval %v not positive", interval)
+	}
+	churnLog, err := os.OpenFile("churn.csv", os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	mode := ctx.String(utils.DiscoveryFlag.Name)
+	c := &churner{
+		nodes:    nodes,
+		rate:     rate,
+		interval: interval,
+		rewire:   mode == "" || mode == "none",
+		policy:   ctx.String(utils.EvictionFlag.Name),
+		log:      churnLog,
+		quit:     make(chan struct{}),
+	}
+	log.Info("Churning connections", "rate", c.rate, "interval", c.interval, "eviction", c.policy, "rewire", c.rewire)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.loop()
+	}()
+	return func() {
+		close(c.quit)
+		<-done
+		churnLog.Close()
+	}, nil
+}
+
+func (c *churner) loop() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for addr := range c.nodes {
+				c.churn(addr)
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// churn drops the connections of a single node. The number of dropped peers is
+// the churn rate of the peer count, with fractions rounded at random so that
+// nodes with few peers still churn at the configured rate on average.
+func (c *churner) churn(addr common.Address) {
+	srv := c.nodes[addr].Server()
+
+	share := c.rate * float64(srv.PeerCount())
+	n := int(share)
+	if rand.Float64() < share-float64(n) {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	for _, peer := range srv.EvictPeers(n) {
+		remote, ok := emu.NodeAddress(peer.ID())
+		if !ok {
+			continue
+		}
+		c.record(addr, remote, "drop")
+		if !c.rewire {
+			continue
+		}
+		// Keep the remote end from dialing the dropped link again, without
+		// waiting for the connection to wind down
+		go c.nodes[remote].Server().RemovePeer(srv.Self())
+
+		if replacement, ok := c.candidate(addr, remote); ok {
+			srv.AddPeer(c.nodes[replacement].Server().Self())
+			c.record(addr, replacement, "dial")
+		}
+	}
+}
+
+// candidate picks a random node to replace a dropped peer, which is neither the
+// node itself, nor the dropped peer, nor already connected, nor paused or cut
+// off by a partition.
+func (c *churner) candidate(addr, dropped common.Address) (common.Address, bool) {
+	connected := make(map[enode.ID]bool)
+	for _, peer := range c.nodes[addr].Server().Peers() {
+		connected[peer.ID()] = true
+	}
+	var candidates []common.Address
+	for other, stack := range c.nodes {
+		if other == addr || other == dropped || connected[stack.Server().Self().ID()] {
+			continue
+		}
+		if !emu.Paused(other) && emu.Reachable(addr, other) {
+			candidates = append(candidates, other)
+		}
+	}
+	if len(candidates) == 0 {
+		return common.Address{}, false
+	}
+	return candidates[rand.Intn(len(candidates))], true
+}
+
+// record logs a churn event between a node and one of its peers.
+func (c *churner) record(addr, peer common.Address, event string) {
+	fmt.Fprintf(c.log, "%d,%d,%d,%s,%s\n", time.Now().UnixMilli(), emu.Global.Nodes[addr].Identity, emu.Global.Nodes[peer].Identity, event, c.policy)
+}
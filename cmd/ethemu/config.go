@@ -17,11 +17,14 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"fmt"
 	"github.com/urfave/cli/v2"
 	"os"
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
@@ -57,23 +60,138 @@ func makeConfigNode(ctx *cli.Context, emu *emu.Node) (*node.Node, gethConfig) {
 
 	// Apply flags.
 	utils.SetNodeConfig(ctx, &cfg.Node, emu)
+	var keys []*ecdsa.PrivateKey
+	if emu != nil {
+		nodeKey, accountKeys, err := derivedKeys(emu)
+		if err != nil {
+			utils.Fatalf("Failed to derive node keys: %v", err)
+		}
+		if nodeKey != nil {
+			cfg.Node.P2P.PrivateKey = nodeKey
+		}
+		keys = accountKeys
+	}
+	lean := emu != nil && ctx.Bool(utils.LeanFlag.Name)
+	if lean {
+		setLeanNodeConfig(&cfg.Node)
+	}
+	if emu != nil && emu.Profile != nil {
+		setProfileNodeConfig(emu.Profile, &cfg.Node)
+	}
 	stack, err := node.New(&cfg.Node)
 	if err != nil {
 		utils.Fatalf("Failed to create the protocol stack: %v", err)
 	}
 	// Node doesn't by default populate account manager backends
-	if err := setAccountManagerBackends(stack); err != nil {
-		utils.Fatalf("Failed to set account manager backends: %v", err)
+	switch {
+	case len(keys) > 0:
+		stack.AccountManager().AddBackend(newKeyBackend(keys...))
+	default:
+		if err := setAccountManagerBackends(stack); err != nil {
+			utils.Fatalf("Failed to set account manager backends: %v", err)
+		}
 	}
 
 	utils.SetEthConfig(ctx, &cfg.Eth, emu)
+	if lean {
+		setLeanEthConfig(&cfg.Eth)
+	}
+	if emu != nil && emu.Profile != nil {
+		setProfileEthConfig(emu.Profile, &cfg.Eth)
+	}
 
 	return stack, cfg
 }
 
-// makeFullNode loads geth configuration and creates the Ethereum backend.
-func makeFullNode(ctx *cli.Context, emu *emu.Node, blockLog *os.File, txLog *os.File) (*node.Node, *eth.Ethereum, ethapi.Backend) {
+// checkLean rejects lean runs that cannot work. Lean nodes have no keystore, so
+// their keys have to be derived from the seed of the network, and no RPC
+// servers, so the control endpoint is the only way to reach them.
+func checkLean(ctx *cli.Context) error {
+	if !ctx.Bool(utils.LeanFlag.Name) {
+		return nil
+	}
+	if len(emu.Global.Seed) == 0 {
+		return fmt.Errorf("--%s needs a network generated with a key seed", utils.LeanFlag.Name)
+	}
+	if ctx.String(utils.ControlAddrFlag.Name) == "" {
+		return fmt.Errorf("--%s needs --%s, lean nodes have no other RPC", utils.LeanFlag.Name, utils.ControlAddrFlag.Name)
+	}
+	return nil
+}
+
+// setLeanNodeConfig strips a node down to the eth protocol: its APIs are only
+// reachable in-process, e.g. through the control endpoint of the emulator.
+func setLeanNodeConfig(cfg *node.Config) {
+	cfg.InProcOnly = true
+	cfg.IPCPath = ""
+	cfg.HTTPHost = ""
+	cfg.WSHost = ""
+}
+
+// setLeanEthConfig shrinks the caches of a lean node, whose chains are short
+// lived and identical across the emulated network.
+func setLeanEthConfig(cfg *ethconfig.Config) {
+	cfg.DatabaseCache = 16
+	cfg.TrieCleanCache = 16
+	cfg.TrieCleanCacheJournal = ""
+	cfg.TrieDirtyCache = 16
+	cfg.SnapshotCache = 0
+}
+
+// setProfileNodeConfig applies the node overrides of a profile.
+func setProfileNodeConfig(profile *emu.Profile, cfg *node.Config) {
+	if profile.MaxPeers != nil {
+		cfg.P2P.MaxPeers = *profile.MaxPeers
+	}
+}
+
+// setProfileEthConfig applies the eth overrides of a profile.
+func setProfileEthConfig(profile *emu.Profile, cfg *ethconfig.Config) {
+	if profile.Archive {
+		cfg.NoPruning = true
+		cfg.Preimages = true
+		cfg.TxLookupLimit = 0
+	}
+	if profile.BlockPropagation != "" {
+		cfg.BlockPropagation = profile.BlockPropagation
+	}
+	if profile.TxPropagation != "" {
+		cfg.TxPropagation = profile.TxPropagation
+	}
+	if profile.CompactBlocks {
+		cfg.CompactBlocks = true
+	}
+	if len(profile.EthVersions) > 0 {
+		cfg.ProtocolVersions = profile.EthVersions
+	}
+	if profile.GasCeil != nil {
+		cfg.Miner.GasCeil = *profile.GasCeil
+	}
+	if profile.GasPrice != nil {
+		cfg.Miner.GasPrice = profile.GasPrice.ToInt()
+	}
+	if profile.PriceLimit != nil {
+		cfg.TxPool.PriceLimit = *profile.PriceLimit
+	}
+	if profile.AccountSlots != nil {
+		cfg.TxPool.AccountSlots = *profile.AccountSlots
+	}
+	if profile.GlobalSlots != nil {
+		cfg.TxPool.GlobalSlots = *profile.GlobalSlots
+	}
+	if profile.AccountQueue != nil {
+		cfg.TxPool.AccountQueue = *profile.AccountQueue
+	}
+	if profile.GlobalQueue != nil {
+		cfg.TxPool.GlobalQueue = *profile.GlobalQueue
+	}
+}
+
+// makeFullNode loads geth configuration and creates the Ethereum backend. The
+// genesis, if given, is written into the database if it is still empty.
+func makeFullNode(ctx *cli.Context, emu *emu.Node, genesis *core.Genesis, blockLog *os.File, txLog *os.File) (*node.Node, *eth.Ethereum, ethapi.Backend) {
 	stack, cfg := makeConfigNode(ctx, emu)
+	cfg.Eth.Genesis = genesis
 	if ctx.IsSet(utils.OverrideShanghai.Name) {
 		v := ctx.Uint64(utils.OverrideShanghai.Name)
 		cfg.Eth.OverrideShanghai = &v
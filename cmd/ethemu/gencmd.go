@@ -1,15 +1,18 @@
 package main
 
 import (
+	crand "crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"golang.org/x/exp/rand"
 	"math"
 	"os"
-	"path"
 
-	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/internal/debug"
 	"github.com/ethereum/go-ethereum/internal/flags"
@@ -35,9 +38,9 @@ func generateConfig(ctx *cli.Context) error {
 		if err := os.RemoveAll(dataDir); err != nil {
 			return err
 		}
-		if err := os.MkdirAll(dataDir, 0755); err != nil {
-			return err
-		}
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
 	}
 
 	num := ctx.Int(utils.NodesFlag.Name)
@@ -46,10 +49,25 @@ func generateConfig(ctx *cli.Context) error {
 		nodes[i] = &emu.Node{}
 	}
 	setId(nodes)
+	if err := setSeed(ctx); err != nil {
+		return err
+	}
 	if err := setAddr(ctx, nodes); err != nil {
 		return err
 	}
 	setPeers(ctx, nodes)
+	if err := setProfiles(ctx, nodes); err != nil {
+		return err
+	}
+	setHashrate(ctx, nodes)
+	setCapacity(ctx, nodes)
+	setClocks(ctx, nodes)
+	if err := setProcessing(ctx, nodes); err != nil {
+		return err
+	}
+	if err := setConsensus(ctx, nodes); err != nil {
+		return err
+	}
 
 	emu.Global.Latency = uint64(ctx.Int(utils.LatencyFlag.Name))
 	emu.Global.Bandwidth = uint64(ctx.Int(utils.BandwidthFlag.Name))
@@ -67,18 +85,55 @@ func setId(nodes []*emu.Node) {
 	}
 }
 
+// setSeed picks the seed deriving all keys of the network, which also drives
+// the random choices of the topology.
+func setSeed(ctx *cli.Context) error {
+	mnemonic, seed := ctx.String(utils.MnemonicFlag.Name), ctx.String(utils.KeySeedFlag.Name)
+	switch {
+	case mnemonic != "" && seed != "":
+		return fmt.Errorf("--%s and --%s are mutually exclusive", utils.MnemonicFlag.Name, utils.KeySeedFlag.Name)
+	case mnemonic != "":
+		emu.Global.Seed = accounts.NewSeedFromMnemonic(mnemonic, "")
+	case seed != "":
+		blob, err := hexutil.Decode(seed)
+		if err != nil {
+			return fmt.Errorf("invalid key seed: %v", err)
+		}
+		emu.Global.Seed = blob
+	default:
+		emu.Global.Seed = make([]byte, 32)
+		if _, err := crand.Read(emu.Global.Seed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func setAddr(ctx *cli.Context, nodes []*emu.Node) error {
 	for _, node := range nodes {
-		keystorePath := path.Join(ctx.String(utils.DataDirFlag.Name), fmt.Sprintf("emu%06d", node.Identity), "keystore")
-		account, err := keystore.StoreKey(keystorePath, "")
+		key, err := emu.AccountKey(node.Identity)
 		if err != nil {
 			return err
 		}
-		node.Address = account.Address
+		node.Address = crypto.PubkeyToAddress(key.PublicKey)
+		for i := 0; i < ctx.Int(utils.AccountsFlag.Name); i++ {
+			key, err := emu.WorkloadKey(node.Identity, i)
+			if err != nil {
+				return err
+			}
+			node.Accounts = append(node.Accounts, crypto.PubkeyToAddress(key.PublicKey))
+		}
 	}
 	return nil
 }
 
+// seededRand creates a random source derived from the key seed, so that the
+// same seed always generates the same network.
+func seededRand(salt ...[]byte) *rand.Rand {
+	hash := crypto.Keccak256(append([][]byte{emu.Global.Seed}, salt...)...)
+	return rand.New(rand.NewSource(binary.BigEndian.Uint64(hash)))
+}
+
 func setPeers(ctx *cli.Context, nodes []*emu.Node) {
 	getPij := func(dens float64, prop float64, maxDis, i, j int) float64 {
 		dis := int(math.Abs(float64(i - j)))
@@ -88,11 +143,13 @@ func setPeers(ctx *cli.Context, nodes []*emu.Node) {
 		}
 		return prop*dens + (1-prop)*float64(theta)
 	}
+	// The same seed yields the same topology
+	rng := seededRand()
 	density := float64(ctx.Int(utils.PeerNumFlag.Name)) / float64(len(nodes)-1)
 	maxDist := len(nodes) / 2
 	for i := 0; i < len(nodes); i++ {
 		for j := i + 1; j < len(nodes); j++ {
-			randNum := float64(rand.Intn(100)) / float64(100)
+			randNum := float64(rng.Intn(100)) / float64(100)
 			if randNum < getPij(density, 0.25, maxDist, i, j) {
 				nodes[i].Peers = append(nodes[i].Peers, nodes[j].Address)
 				nodes[j].Peers = append(nodes[j].Peers, nodes[i].Address)
@@ -101,3 +158,96 @@ func setPeers(ctx *cli.Context, nodes []*emu.Node) {
 		}
 	}
 }
+
+// setProfiles assigns the configured fractions of randomly picked nodes their
+// profiles.
+func setProfiles(ctx *cli.Context, nodes []*emu.Node) error {
+	shares, err := emu.ParseProfileShares(ctx.String(utils.ProfilesFlag.Name))
+	if err != nil {
+		return err
+	}
+	var (
+		perm = seededRand([]byte("profiles")).Perm(len(nodes))
+		next = 0
+	)
+	for _, share := range shares {
+		count := int(math.Round(share.Fraction * float64(len(nodes))))
+		for i := 0; i < count && next < len(nodes); i++ {
+			nodes[perm[next]].Profile = share.Profile
+			next++
+		}
+	}
+	return nil
+}
+
+func setHashrate(ctx *cli.Context, nodes []*emu.Node) {
+	for _, node := range nodes {
+		node.Hashrate = ctx.Uint64(utils.HashrateFlag.Name)
+	}
+}
+
+func setCapacity(ctx *cli.Context, nodes []*emu.Node) {
+	for _, node := range nodes {
+		node.Upload = ctx.Uint64(utils.UploadFlag.Name)
+		node.Download = ctx.Uint64(utils.DownloadFlag.Name)
+	}
+}
+
+// setClocks skews the clocks of all nodes by random offsets and drifts up to the
+// configured bounds, in either direction.
+func setClocks(ctx *cli.Context, nodes []*emu.Node) {
+	var (
+		offset = ctx.Duration(utils.ClockOffsetFlag.Name).Milliseconds()
+		drift  = ctx.Float64(utils.ClockDriftFlag.Name)
+		rand   = seededRand([]byte("clocks"))
+	)
+	for _, node := range nodes {
+		if offset > 0 {
+			node.ClockOffset = rand.Int63n(2*offset+1) - offset
+		}
+		if drift > 0 {
+			node.ClockDrift = (2*rand.Float64() - 1) * drift
+		}
+	}
+}
+
+// setProcessing gives all nodes the configured processing model, if any, except
+// for nodes whose profile brings a model of its own.
+func setProcessing(ctx *cli.Context, nodes []*emu.Node) error {
+	model := emu.Processing{
+		GasCost:  ctx.Float64(utils.CPUGasCostFlag.Name),
+		TxCost:   ctx.Float64(utils.CPUTxCostFlag.Name),
+		Slowdown: ctx.Float64(utils.CPUSlowdownFlag.Name),
+	}
+	if model == (emu.Processing{}) {
+		return nil
+	}
+	if err := model.Validate(); err != nil {
+		return fmt.Errorf("%v, set --%s or --%s", err, utils.CPUGasCostFlag.Name, utils.CPUTxCostFlag.Name)
+	}
+	for _, node := range nodes {
+		if node.Profile == nil || node.Profile.Processing == nil {
+			node.Processing = &model
+		}
+	}
+	return nil
+}
+
+func setConsensus(ctx *cli.Context, nodes []*emu.Node) error {
+	switch engine := ctx.String(utils.ConsensusFlag.Name); engine {
+	case "ethash":
+		return nil
+	case "bft":
+		emu.Global.Consensus = engine
+	default:
+		return fmt.Errorf("unknown consensus engine %q", engine)
+	}
+	num := ctx.Int(utils.BFTValidatorsFlag.Name)
+	if num <= 0 || num > len(nodes) {
+		num = len(nodes)
+	}
+	for _, node := range nodes[:num] {
+		node.Validator = true
+	}
+	return nil
+}
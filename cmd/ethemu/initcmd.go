@@ -18,11 +18,14 @@ package main
 
 import (
 	"math/big"
-	"sync"
+	"path"
+	"sort"
 	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/internal/flags"
 	"github.com/ethereum/go-ethereum/log"
@@ -51,7 +54,39 @@ func initGenesis(ctx *cli.Context) error {
 	dataDir := ctx.String(utils.DataDirFlag.Name)
 	emu.LoadConfig(dataDir)
 
-	// Construct a default genesis block
+	genesis := makeGenesis()
+
+	// The genesis is written once into the shared database, the nodes only store
+	// their own changes on top of it
+	for _, node := range emu.Global.Nodes {
+		stack, _ := makeConfigNode(ctx, node)
+		if common.FileExist(stack.ResolvePath("chaindata")) {
+			utils.Fatalf("Node %d already has a database, initialise a fresh data directory", node.Identity)
+		}
+		stack.Close()
+	}
+	chaindb, err := rawdb.NewBadgerDBDatabase(path.Join(dataDir, emu.SHARED_DIR, "chaindata"), 0, 0, "", false)
+	if err != nil {
+		utils.Fatalf("Failed to open database: %v", err)
+	}
+	defer chaindb.Close()
+
+	triedb := trie.NewDatabaseWithConfig(chaindb, &trie.Config{
+		Preimages: ctx.Bool(utils.CachePreimagesFlag.Name),
+	})
+	_, hash, err := core.SetupGenesisBlock(chaindb, triedb, genesis)
+	if err != nil {
+		utils.Fatalf("Failed to write genesis block: %v", err)
+	}
+	log.Info("Successfully wrote genesis state", "hash", hash, "nodes", len(emu.Global.Nodes))
+
+	emu.Global.Shared = true
+	return emu.StoreConfig(dataDir)
+}
+
+// makeGenesis constructs the default genesis block of the emulated network,
+// funding every node and setting up the configured consensus engine.
+func makeGenesis() *core.Genesis {
 	genesis := &core.Genesis{
 		Timestamp:  uint64(time.Now().Unix()),
 		ExtraData:  make([]byte, 32),
@@ -76,32 +111,29 @@ func initGenesis(ctx *cli.Context) error {
 		genesis.Alloc[node.Address] = core.GenesisAccount{
 			Balance: new(big.Int).Lsh(big.NewInt(1), 256-7), // 2^256 / 128 (allow many pre-funds without balance overflows)
 		}
-	}
-
-	var wg sync.WaitGroup
-	for _, node := range emu.Global.Nodes {
-		wg.Add(1)
-		go func(node *emu.Node) {
-			// Open and initialise both full and light databases
-			stack, _ := makeConfigNode(ctx, node)
-			defer stack.Close()
-
-			chaindb, err := stack.OpenDatabase("chaindata", 0, 0, "", false)
-			if err != nil {
-				utils.Fatalf("Failed to open database: %v", err)
+		for _, account := range node.Accounts {
+			genesis.Alloc[account] = core.GenesisAccount{
+				Balance: new(big.Int).Lsh(big.NewInt(1), 256-7-32), // 2^256 / 2^39, room for many workload accounts per node
 			}
-			triedb := trie.NewDatabaseWithConfig(chaindb, &trie.Config{
-				Preimages: ctx.Bool(utils.CachePreimagesFlag.Name),
-			})
-			_, hash, err := core.SetupGenesisBlock(chaindb, triedb, genesis)
-			if err != nil {
-				utils.Fatalf("Failed to write genesis block: %v", err)
+		}
+	}
+	if emu.Global.Consensus == "bft" {
+		// Validators are ordered by node id, which fixes the proposer rotation
+		var validators []*emu.Node
+		for _, node := range emu.Global.Nodes {
+			if node.Validator {
+				validators = append(validators, node)
 			}
-			chaindb.Close()
-			log.Info("Successfully wrote genesis state", "hash", hash)
-			wg.Done()
-		}(node)
+		}
+		sort.Slice(validators, func(i, j int) bool {
+			return validators[i].Identity < validators[j].Identity
+		})
+		genesis.Config.BFT = new(params.BFTConfig)
+		for _, node := range validators {
+			genesis.Config.BFT.Validators = append(genesis.Config.BFT.Validators, node.Address)
+		}
+		genesis.Config.Ethash = nil
+		genesis.Difficulty = big.NewInt(1)
 	}
-	wg.Wait()
-	return nil
+	return genesis
 }
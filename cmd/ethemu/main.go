@@ -19,13 +19,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
-	"math/rand"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"sort"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
@@ -33,6 +35,9 @@ import (
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/internal/debug"
@@ -40,6 +45,7 @@ import (
 	"github.com/ethereum/go-ethereum/internal/flags"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
 
 	"github.com/urfave/cli/v2"
 )
@@ -144,6 +150,41 @@ var (
 		utils.TxModeFlag,
 		utils.BlockSizeFlag,
 		utils.PeerNumFlag,
+		utils.MnemonicFlag,
+		utils.KeySeedFlag,
+		utils.AccountsFlag,
+		utils.ProfilesFlag,
+		utils.HashrateFlag,
+		utils.UploadFlag,
+		utils.DownloadFlag,
+		utils.ClockOffsetFlag,
+		utils.ClockDriftFlag,
+		utils.CPUGasCostFlag,
+		utils.CPUTxCostFlag,
+		utils.CPUSlowdownFlag,
+		utils.ConsensusFlag,
+		utils.BFTValidatorsFlag,
+		utils.ControlAddrFlag,
+		utils.SharedCacheFlag,
+		utils.LeanFlag,
+		utils.BlockPropagationFlag,
+		utils.TxPropagationFlag,
+		utils.CompactBlocksFlag,
+		utils.EthVersionsFlag,
+		utils.TraceFlag,
+		utils.TxTrackFlag,
+		utils.DiscoveryFlag,
+		utils.DialRatioFlag,
+		utils.ChurnRateFlag,
+		utils.ChurnIntervalFlag,
+		utils.EvictionFlag,
+		utils.ScoreEvictionFlag,
+		utils.EmuDBFlag,
+		utils.EmuDBCapFlag,
+		utils.EmuDBSpillFlag,
+		utils.MetricsAddrFlag,
+		utils.MetricsSampleFlag,
+		utils.MetricsIntervalFlag,
 	}
 )
 
@@ -158,6 +199,13 @@ func init() {
 		genCommand,
 		// See initcmd.go:
 		initCommand,
+		// See checkpointcmd.go:
+		checkpointCommand,
+		resumeCommand,
+		// See topologycmd.go:
+		topologyCommand,
+		// See reportcmd.go:
+		reportCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -189,10 +237,25 @@ func main() {
 // It creates a default node based on the command line arguments and runs it in
 // blocking mode, waiting for it to be shut down.
 func ethemu(ctx *cli.Context) error {
+	return run(ctx, nil)
+}
+
+// run starts all emulated nodes and the orchestrator driving them, continuing
+// from the given checkpoint if it is non-nil.
+func run(ctx *cli.Context, cp *emu.Checkpoint) error {
 	dataDir := ctx.String(utils.DataDirFlag.Name)
 	emu.LoadConfig(dataDir)
+	if err := checkLean(ctx); err != nil {
+		return err
+	}
 	stopSig := make(chan struct{})
 
+	// Let all nodes share recovered senders and decoded objects if requested
+	if size := ctx.Int(utils.SharedCacheFlag.Name); size > 0 {
+		types.EnableSharedCaches(size)
+		log.Info("Enabled shared sender and decoding caches", "size", size)
+	}
+
 	nodes := make(map[common.Address]*node.Node)
 	var firstNode *node.Node
 	eths := make(map[common.Address]*eth.Ethereum)
@@ -206,24 +269,120 @@ func ethemu(ctx *cli.Context) error {
 		return err
 	}
 	defer txLog.Close()
+	stopTrace, err := startTrace(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopTrace()
+	stopProcessingLog, err := startProcessingLog()
+	if err != nil {
+		return err
+	}
+	defer stopProcessingLog()
+	stopTxTracking, err := startTxTracking(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopTxTracking()
+	// In-memory nodes start out empty, so they all write the same genesis
+	var genesis *core.Genesis
+	if ctx.String(utils.EmuDBFlag.Name) == "memory" {
+		if cp != nil {
+			return errors.New("checkpoints can only be resumed into on-disk databases")
+		}
+		genesis = makeGenesis()
+	}
+	// Restore the partition before any node starts connecting, and the clocks
+	// before any node reads them
+	if cp != nil {
+		emu.ResumeClocks(cp.Clocks)
+		emu.Partition(cp.Groups)
+		for _, link := range cp.Cut {
+			emu.CutLink(link[0], link[1])
+		}
+	}
 	for _, node := range emu.Global.Nodes {
-		stack, eth, backend := makeFullNode(ctx, node, blockLog, txLog)
+		stack, eth, backend := makeFullNode(ctx, node, genesis, blockLog, txLog)
 		nodes[node.Address] = stack
 		if firstNode == nil {
 			firstNode = stack
 		}
 		eths[node.Address] = eth
 
+		// Refuse connections over the links partitions cut
+		addr := node.Address
+		stack.Server().SetLinkFilter(func(id enode.ID) bool {
+			remote, ok := emu.NodeAddress(id)
+			return !ok || emu.Reachable(addr, remote)
+		})
 		startNode(ctx, stack, backend, false)
+		emu.RegisterNode(node.Address, stack.Server().Self())
 	}
+	start := time.Now()
 
-	for _, node := range emu.Global.Nodes {
-		for _, peer := range node.Peers {
-			nodes[node.Address].Server().AddPeer(nodes[peer].Server().Self())
+	// Interrupted runs still report their summary and flush their logs
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		logSummary(start)
+		stopTrace()
+		stopTxTracking()
+		blockLog.Sync()
+		txLog.Sync()
+		os.Exit(0)
+	}()
+
+	// Blocks are requested once per second, transactions as fast as possible
+	var wl *workload
+	if cp != nil {
+		if err := restoreCheckpoint(cp, nodes, eths); err != nil {
+			return err
+		}
+		wl = restoreWorkload(cp.Workload)
+	} else if ctx.Bool(utils.TxModeFlag.Name) {
+		wl = newWorkload(0, true, time.Now().UnixNano())
+	} else {
+		wl = newWorkload(1, false, time.Now().UnixNano())
+	}
+
+	// Discovering nodes find their peers themselves, the static topology is
+	// only wired without discovery
+	if mode := ctx.String(utils.DiscoveryFlag.Name); mode != "" && mode != "none" {
+		log.Info("Leaving the topology to peer discovery", "mode", mode)
+	} else {
+		for _, node := range emu.Global.Nodes {
+			for _, peer := range node.Peers {
+				if !emu.Reachable(node.Address, peer) {
+					continue
+				}
+				nodes[node.Address].Server().AddPeer(nodes[peer].Server().Self())
+			}
 		}
 	}
 
-	if ctx.Bool(utils.TxModeFlag.Name) {
+	if endpoint := ctx.String(utils.ControlAddrFlag.Name); endpoint != "" {
+		api := newEmuAPI(nodes, eths, ctx.Int(utils.MinerThreadsFlag.Name), wl)
+		server, err := startControl(endpoint, api)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+	}
+
+	stopMetrics, err := startMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	stopChurn, err := startChurn(ctx, nodes)
+	if err != nil {
+		return err
+	}
+	defer stopChurn()
+
+	if wl.txMode {
 		go func() {
 			sealers := make([]*eth.Ethereum, 0)
 			for addr := range emu.Global.Nodes {
@@ -233,18 +392,22 @@ func ethemu(ctx *cli.Context) error {
 			for _, node := range emu.Global.Nodes {
 				addrs = append(addrs, node.Address)
 			}
-			txNum := 0
+			emu.SortByIdentity(addrs)
+			txNum := int(wl.cursor)
 			for {
-				from := addrs[rand.Intn(len(addrs))]
+				wl.wait()
+				wl.lock.Lock()
+				from := addrs[wl.rand.Intn(len(addrs))]
 				to := from
 				for from == to {
-					to = addrs[rand.Intn(len(addrs))]
+					to = addrs[wl.rand.Intn(len(addrs))]
 				}
 				value := big.NewInt(int64(txNum))
 				tx := ethapi.TransactionArgs{From: &from, To: &to, Value: (*hexutil.Big)(value)}
 				var hash common.Hash
 				select {
 				case <-stopSig:
+					wl.lock.Unlock()
 					return
 				default:
 					hash, _ = eths[from].SendTransaction(context.Background(), tx)
@@ -263,22 +426,65 @@ func ethemu(ctx *cli.Context) error {
 					fmt.Println("txNum", txNum)
 					txNum++
 					if txNum >= 5050 {
+						logSummary(start)
 						txLog.Sync()
 						os.Exit(0)
 					}
 				}
+				wl.cursor = uint64(txNum)
+				wl.lock.Unlock()
 			}
 		}()
 	}
 
-	if !ctx.Bool(utils.TxModeFlag.Name) {
+	if !wl.txMode && autoSealing(eths) {
 		go func() {
-			sealers := make([]*eth.Ethereum, 0)
-			for addr := range emu.Global.Nodes {
-				sealers = append(sealers, eths[addr])
+			// Blocks are found by the simulated miners on their own, so only
+			// wait for the network to progress far enough.
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopSig:
+					return
+				case <-ticker.C:
+				}
+				for _, sealer := range eths {
+					if sealer.BlockChain().CurrentBlock().Number.Uint64() >= 110 {
+						logSummary(start)
+						blockLog.Sync()
+						os.Exit(0)
+					}
+				}
 			}
+		}()
+	} else if !wl.txMode {
+		go func() {
+			// Continue on top of the highest chain, which is genesis unless
+			// resuming from a checkpoint
 			curHeight := uint64(0)
+			for _, backend := range eths {
+				if number := backend.BlockChain().CurrentBlock().Number.Uint64(); number > curHeight {
+					curHeight = number
+				}
+			}
+			addrs := make([]common.Address, 0, len(emu.Global.Nodes))
+			for addr := range emu.Global.Nodes {
+				addrs = append(addrs, addr)
+			}
+			emu.SortByIdentity(addrs)
 			for {
+				// Paused nodes neither follow the chain nor get picked to seal
+				sealers := make([]*eth.Ethereum, 0)
+				for _, addr := range addrs {
+					if !emu.Paused(addr) {
+						sealers = append(sealers, eths[addr])
+					}
+				}
+				if len(sealers) == 0 {
+					time.Sleep(time.Second)
+					continue
+				}
 				for {
 					counter := 0
 					for _, sealer := range sealers {
@@ -290,22 +496,28 @@ func ethemu(ctx *cli.Context) error {
 						break
 					}
 				}
-				time.Sleep(time.Second)
-				sealer := sealers[rand.Intn(len(sealers))]
+				wl.wait()
+				wl.lock.Lock()
+				sealer := sealers[wl.rand.Intn(len(sealers))]
 				etherbase, err := sealer.Etherbase()
 				if err != nil {
+					wl.lock.Unlock()
 					return
 				}
 				select {
 				case <-stopSig:
+					wl.lock.Unlock()
 					return
 				default:
 					log.Warn("Sealing time", "sealer", etherbase)
 					sealer.Miner().Work()
 					fmt.Println("blockNum", curHeight)
 				}
+				wl.cursor++
+				wl.lock.Unlock()
 				curHeight++
 				if curHeight >= 110 {
+					logSummary(start)
 					blockLog.Sync()
 					os.Exit(0)
 				}
@@ -316,9 +528,21 @@ func ethemu(ctx *cli.Context) error {
 	for _, node := range nodes {
 		node.Wait()
 	}
+	logSummary(start)
 	return nil
 }
 
+// autoSealing reports whether the emulated nodes seal blocks on their own with
+// a simulated hashrate instead of being picked by the orchestrator.
+func autoSealing(eths map[common.Address]*eth.Ethereum) bool {
+	for _, backend := range eths {
+		if sealer, ok := backend.Engine().(consensus.AutoSealer); ok && sealer.AutoSeal() {
+			return true
+		}
+	}
+	return false
+}
+
 // startNode boots up the system node and all registered protocols, after which
 // it unlocks any requested accounts, and starts the RPC/IPC interfaces and the
 // miner.
@@ -353,7 +577,12 @@ func startNode(ctx *cli.Context, stack *node.Node, backend ethapi.Backend, isCon
 
 // unlockAccounts unlocks any account specifically requested.
 func unlockAccounts(ctx *cli.Context, stack *node.Node) {
-	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	// Nodes without keystore hold their keys unlocked in memory
+	backends := stack.AccountManager().Backends(keystore.KeyStoreType)
+	if len(backends) == 0 {
+		return
+	}
+	ks := backends[0].(*keystore.KeyStore)
 	for _, account := range ks.Accounts() {
 		unlockAccount(ks, account.Address.String())
 	}
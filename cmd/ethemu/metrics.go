@@ -0,0 +1,170 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/emu"
+	ethproto "github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/urfave/cli/v2"
+)
+
+// startMetrics opens the Prometheus endpoint and starts the metric sampler as
+// configured on the command line. The returned function tears both down again.
+func startMetrics(ctx *cli.Context) (func(), error) {
+	var stops []func()
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	if endpoint := ctx.String(utils.MetricsAddrFlag.Name); endpoint != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		server, addr, err := node.StartHTTPEndpoint(endpoint, rpc.DefaultHTTPTimeouts, mux)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Metrics endpoint opened", "url", fmt.Sprintf("http://%v/metrics", addr))
+		stops = append(stops, func() { server.Close() })
+	}
+	if path := ctx.String(utils.MetricsSampleFlag.Name); path != "" {
+		format := "csv"
+		if filepath.Ext(path) == ".jsonl" {
+			format = "jsonl"
+		}
+		out, fresh, err := openLog(path)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		sampler, err := metrics.NewSampler(out, format, fresh, ctx.Duration(utils.MetricsIntervalFlag.Name), metrics.SampledMetrics)
+		if err != nil {
+			out.Close()
+			stop()
+			return nil, err
+		}
+		sampler.Start()
+		log.Info("Sampling metrics", "path", path, "format", format, "interval", ctx.Duration(utils.MetricsIntervalFlag.Name))
+		stops = append(stops, func() {
+			sampler.Stop()
+			out.Close()
+		})
+	}
+	return stop, nil
+}
+
+// startTrace starts tracing the eth messages of all nodes into the file given on
+// the command line, if any. The returned function stops tracing again.
+func startTrace(ctx *cli.Context) (func(), error) {
+	path := ctx.String(utils.TraceFlag.Name)
+	if path == "" {
+		return func() {}, nil
+	}
+	format := "csv"
+	if filepath.Ext(path) == ".jsonl" {
+		format = "jsonl"
+	}
+	out, fresh, err := openLog(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := ethproto.EnableTracer(out, format, fresh); err != nil {
+		out.Close()
+		return nil, err
+	}
+	log.Info("Tracing eth messages", "path", path, "format", format)
+	return func() {
+		ethproto.EnableTracer(nil, "", false)
+		out.Close()
+	}, nil
+}
+
+// openLog opens a log for appending, so that a resumed run continues the log of
+// the previous one, and reports whether the log is still empty.
+func openLog(path string) (*os.File, bool, error) {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return nil, false, err
+	}
+	return out, info.Size() == 0, nil
+}
+
+// startProcessingLog logs the block import times of the nodes with a processing
+// model to processing.csv, provided any node has one. The returned function
+// stops logging again.
+func startProcessingLog() (func(), error) {
+	modelled := false
+	for _, node := range emu.Global.Nodes {
+		if node.Processing != nil || (node.Profile != nil && node.Profile.Processing != nil) {
+			modelled = true
+			break
+		}
+	}
+	if !modelled {
+		return func() {}, nil
+	}
+	out, fresh, err := openLog("processing.csv")
+	if err != nil {
+		return nil, err
+	}
+	if err := emu.EnableProcessingLog(out, fresh); err != nil {
+		out.Close()
+		return nil, err
+	}
+	log.Info("Emulating node processing times", "log", out.Name())
+	return func() {
+		emu.EnableProcessingLog(nil, false)
+		out.Close()
+	}, nil
+}
+
+// startTxTracking follows the lifecycle of every transaction across all nodes
+// if requested on the command line, logging it to txlife.csv for the report
+// command. The returned function stops tracking again.
+func startTxTracking(ctx *cli.Context) (func(), error) {
+	if !ctx.Bool(utils.TxTrackFlag.Name) {
+		return func() {}, nil
+	}
+	out, fresh, err := openLog("txlife.csv")
+	if err != nil {
+		return nil, err
+	}
+	if err := emu.EnableTxTracking(out, fresh); err != nil {
+		out.Close()
+		return nil, err
+	}
+	log.Info("Tracking transaction lifecycles", "log", out.Name())
+	return func() {
+		emu.EnableTxTracking(nil, false)
+		out.Close()
+	}, nil
+}
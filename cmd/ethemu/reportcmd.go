@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/internal/flags"
+	"github.com/urfave/cli/v2"
+)
+
+var reportCommand = &cli.Command{
+	Action:    report,
+	Name:      "report",
+	Usage:     "Report how transactions propagated and were confirmed in a run",
+	ArgsUsage: "[<outputDir>]",
+	Flags: flags.Merge([]cli.Flag{
+		utils.ReportTxLogFlag,
+		utils.ReportFractionFlag,
+		utils.ReportDepthFlag,
+	}, utils.DatabasePathFlags),
+	Description: `
+The report command reads the transaction lifecycle log runs with --emu.txtrack
+write into txlife.csv and prints the distributions of the time transactions took
+to reach a fraction of the nodes of the network in the data directory, and of
+their latency from submission until the submitting node saw them confirmed to
+the given depth. It also counts why pools dropped transactions.
+
+Per transaction figures are written to txreport.csv in the given directory, the
+current one by default, with times in milliseconds since submission and empty
+fields for transactions which did not get that far.`,
+}
+
+var (
+	errInvalidReportFraction = errors.New("report fraction must be in (0, 1]")
+	errInvalidReportDepth    = errors.New("report depth must be positive")
+)
+
+func report(ctx *cli.Context) error {
+	if err := emu.LoadConfig(ctx.String(utils.DataDirFlag.Name)); err != nil {
+		return err
+	}
+	fraction, depth := ctx.Float64(utils.ReportFractionFlag.Name), ctx.Uint64(utils.ReportDepthFlag.Name)
+	if fraction <= 0 || fraction > 1 {
+		return errInvalidReportFraction
+	}
+	if depth == 0 {
+		return errInvalidReportDepth
+	}
+	dir := "."
+	if ctx.Args().Len() > 0 {
+		dir = ctx.Args().First()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(ctx.String(utils.ReportTxLogFlag.Name))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tracker, err := emu.ReadTxLog(in)
+	if err != nil {
+		return fmt.Errorf("%s: %v", in.Name(), err)
+	}
+	nodes := len(emu.Global.Nodes)
+	stats := tracker.Stats(nodes, fraction, depth)
+
+	fmt.Printf("Transactions: %d in a network of %d nodes\n", stats.Txs, nodes)
+	printDistribution(fmt.Sprintf("Reach %.0f%% of nodes", 100*fraction), stats.Reach, stats.Txs)
+	printDistribution(fmt.Sprintf("Confirmation depth %d", depth), stats.Confirmation, stats.Txs)
+	reasons := make([]string, 0, len(stats.Drops))
+	for reason := range stats.Drops {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Printf("Dropped as %s: %d times\n", reason, stats.Drops[reason])
+	}
+	return writeFile(filepath.Join(dir, "txreport.csv"), func(w io.Writer) {
+		writeTxReport(w, tracker, nodes, fraction, depth)
+	})
+}
+
+// printDistribution prints a distribution of times in milliseconds along with
+// the share of transactions it covers.
+func printDistribution(name string, d emu.Distribution, txs int) {
+	if d.Count == 0 {
+		fmt.Printf("%s: no transactions\n", name)
+		return
+	}
+	fmt.Printf("%s: %d txs (%s), mean %.0fms, min %dms, p50 %dms, p90 %dms, p99 %dms, max %dms\n",
+		name, d.Count, share(float64(d.Count), float64(txs)), d.Mean, d.Min, d.P50, d.P90, d.P99, d.Max)
+}
+
+// writeTxReport writes the propagation and confirmation times of every
+// transaction as CSV.
+func writeTxReport(w io.Writer, tracker *emu.TxTracker, nodes int, fraction float64, depth uint64) {
+	fmt.Fprintln(w, "tx,origin,submitted,seen,reach,confirmation,drops")
+	for _, hash := range tracker.Hashes() {
+		lc := tracker.Lifecycle(hash)
+
+		reach, confirmation := "", ""
+		if ms, ok := lc.Reached(fraction, nodes); ok {
+			reach = fmt.Sprint(ms)
+		}
+		if uint64(len(lc.Confirmations)) >= depth {
+			confirmation = fmt.Sprint(lc.Confirmations[depth-1])
+		}
+		counts := make(map[string]int)
+		for _, reason := range lc.Dropped {
+			counts[reason]++
+		}
+		drops := make([]string, 0, len(counts))
+		for reason, count := range counts {
+			drops = append(drops, fmt.Sprintf("%s:%d", reason, count))
+		}
+		sort.Strings(drops)
+		fmt.Fprintf(w, "%s,%d,%d,%d,%s,%s,%s\n", hash.Hex(), lc.Origin, lc.Submitted, len(lc.Seen), reach, confirmation, strings.Join(drops, ";"))
+	}
+}
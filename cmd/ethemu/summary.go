@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// logSummary reports the outcome of a run started at the given time: for every
+// node how much of its capacities it used and which limit its traffic ran into,
+// and for nodes with a processing model the emulated processing times next to
+// the ones measured on the host.
+func logSummary(start time.Time) {
+	elapsed := time.Since(start)
+	log.Info("Run summary", "nodes", len(emu.Global.Nodes), "elapsed", common.PrettyDuration(elapsed))
+
+	addrs := make([]common.Address, 0, len(emu.Global.Nodes))
+	for addr := range emu.Global.Nodes {
+		addrs = append(addrs, addr)
+	}
+	emu.SortByIdentity(addrs)
+
+	for _, addr := range addrs {
+		usage := emu.GetCapacityUsage(addr)
+		log.Info("Node traffic", "node", emu.Global.Nodes[addr].Identity,
+			"upload", capacity(usage.Upload), "download", capacity(usage.Download),
+			"sent", common.StorageSize(usage.Sent), "received", common.StorageSize(usage.Received),
+			"upbusy", share(float64(usage.UploadBusy), float64(elapsed)),
+			"downbusy", share(float64(usage.DownloadBusy), float64(elapsed)),
+			"upbound", share(float64(usage.UploadBound), float64(usage.Sent)),
+			"downbound", share(float64(usage.DownloadBound), float64(usage.Received)),
+			"peakup", usage.PeakUploads, "peakdown", usage.PeakDownloads,
+			"bottleneck", usage.Bottleneck())
+
+		if cpu := emu.NodeCPU(emu.Global.Nodes[addr].Identity); cpu != nil {
+			usage := cpu.Usage()
+			log.Info("Node processing", "node", emu.Global.Nodes[addr].Identity,
+				"blocks", usage.Blocks, "blockhost", common.PrettyDuration(usage.BlockHost), "blockemulated", common.PrettyDuration(usage.BlockEmulated),
+				"msgs", usage.Msgs, "msghost", common.PrettyDuration(usage.MsgHost), "msgemulated", common.PrettyDuration(usage.MsgEmulated))
+		}
+	}
+}
+
+// capacity formats a capacity in bytes per millisecond.
+func capacity(bytesPerMs uint64) string {
+	if bytesPerMs == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%v/s", common.StorageSize(bytesPerMs*1000))
+}
+
+// share formats a fraction as a percentage.
+func share(part, total float64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*part/total)
+}
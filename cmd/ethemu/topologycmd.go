@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/emu"
+	ethproto "github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/internal/flags"
+	"github.com/urfave/cli/v2"
+)
+
+var topologyCommand = &cli.Command{
+	Action:    exportTopology,
+	Name:      "topology",
+	Usage:     "Export the peer graph and reconstruct block propagation trees",
+	ArgsUsage: "[<outputDir>]",
+	Flags: flags.Merge([]cli.Flag{
+		utils.TopologyFormatFlag,
+		utils.TraceFlag,
+	}, utils.DatabasePathFlags),
+	Description: `
+The topology command exports the static peer graph of the network in the data
+directory as topology.graphml, topology.dot or topology.json, with an edge for
+each direction of every link carrying its latency in milliseconds and its
+bandwidth. Metrics of the graph such as its
+diameter, clustering and degree distribution are written to graph.json.
+
+Given the message trace of a run with --emu.trace, it also reconstructs the
+propagation tree of every block: propagation.csv lists every delivery of a
+block, pushed in full or compact or fetched as header after an announcement,
+with its delay in milliseconds since the block was first sent, its hop count
+from the origin and whether it was the first delivery to the receiving node,
+forming the tree, or redundant. Announcements carry no block and are listed
+apart in announcements.csv. blocks.csv summarises every block.
+
+The files are written into the given directory, the current one by default.`,
+}
+
+func exportTopology(ctx *cli.Context) error {
+	if err := emu.LoadConfig(ctx.String(utils.DataDirFlag.Name)); err != nil {
+		return err
+	}
+	dir := "."
+	if ctx.Args().Len() > 0 {
+		dir = ctx.Args().First()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	format := ctx.String(utils.TopologyFormatFlag.Name)
+	var write func(io.Writer)
+	switch format {
+	case "graphml":
+		write = writeGraphML
+	case "dot":
+		write = writeDOT
+	case "json":
+		write = writeGraphJSON
+	default:
+		return fmt.Errorf("unknown topology format %q (graphml, dot, json)", format)
+	}
+	if err := writeFile(filepath.Join(dir, "topology."+format), write); err != nil {
+		return err
+	}
+	err := writeFile(filepath.Join(dir, "graph.json"), func(w io.Writer) {
+		blob, _ := json.MarshalIndent(emu.PeerGraphMetrics(), "", "  ")
+		w.Write(append(blob, '\n'))
+	})
+	if err != nil {
+		return err
+	}
+	path := ctx.String(utils.TraceFlag.Name)
+	if path == "" {
+		return nil
+	}
+	entries, err := readTrace(path)
+	if err != nil {
+		return err
+	}
+	trees := propagationTrees(entries)
+	if err := writeFile(filepath.Join(dir, "propagation.csv"), func(w io.Writer) { writePropagation(w, trees) }); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, "announcements.csv"), func(w io.Writer) { writeAnnouncements(w, trees) }); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, "blocks.csv"), func(w io.Writer) { writeBlockSummaries(w, trees) })
+}
+
+// writeFile creates a file and fills it through a buffered writer.
+func writeFile(path string, write func(io.Writer)) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	buf := bufio.NewWriter(out)
+	write(buf)
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", path)
+	return nil
+}
+
+// graphEdge is a direction of a link of the peer graph, from A to B, with the
+// parameters of that direction. Every link yields an edge in both directions.
+type graphEdge struct {
+	A, B      *emu.Node
+	Latency   uint64
+	Bandwidth uint64
+}
+
+// graphNodes returns the nodes of the config ordered by identity, and both
+// directions of the links between them.
+func graphNodes() ([]*emu.Node, []graphEdge) {
+	graph := emu.PeerGraph()
+
+	addrs := make([]common.Address, 0, len(graph))
+	for addr := range graph {
+		addrs = append(addrs, addr)
+	}
+	emu.SortByIdentity(addrs)
+
+	var (
+		nodes = make([]*emu.Node, len(addrs))
+		edges []graphEdge
+	)
+	for i, addr := range addrs {
+		nodes[i] = emu.Global.Nodes[addr]
+
+		peers := make([]common.Address, 0, len(graph[addr]))
+		for peer := range graph[addr] {
+			peers = append(peers, peer)
+		}
+		emu.SortByIdentity(peers)
+		for _, peer := range peers {
+			link := emu.GetLink(addr, peer)
+			edges = append(edges, graphEdge{
+				A:         nodes[i],
+				B:         emu.Global.Nodes[peer],
+				Latency:   link.Latency,
+				Bandwidth: link.Bandwidth,
+			})
+		}
+	}
+	return nodes, edges
+}
+
+// profileName returns the name of the profile of a node, empty if it has none.
+func profileName(node *emu.Node) string {
+	if node.Profile == nil {
+		return ""
+	}
+	return node.Profile.Name
+}
+
+func writeGraphML(w io.Writer) {
+	nodes, edges := graphNodes()
+
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="address" for="node" attr.name="address" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="profile" for="node" attr.name="profile" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="validator" for="node" attr.name="validator" attr.type="boolean"/>`)
+	fmt.Fprintln(w, `  <key id="latency" for="edge" attr.name="latency" attr.type="long"/>`)
+	fmt.Fprintln(w, `  <key id="bandwidth" for="edge" attr.name="bandwidth" attr.type="long"/>`)
+	fmt.Fprintln(w, `  <graph id="peers" edgedefault="directed">`)
+	for _, node := range nodes {
+		fmt.Fprintf(w, "    <node id=\"n%d\">\n", node.Identity)
+		fmt.Fprintf(w, "      <data key=\"address\">%s</data>\n", node.Address.Hex())
+		if name := profileName(node); name != "" {
+			fmt.Fprintf(w, "      <data key=\"profile\">%s</data>\n", name)
+		}
+		fmt.Fprintf(w, "      <data key=\"validator\">%t</data>\n", node.Validator)
+		fmt.Fprintln(w, "    </node>")
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(w, "    <edge source=\"n%d\" target=\"n%d\">\n", edge.A.Identity, edge.B.Identity)
+		fmt.Fprintf(w, "      <data key=\"latency\">%d</data>\n", edge.Latency)
+		fmt.Fprintf(w, "      <data key=\"bandwidth\">%d</data>\n", edge.Bandwidth)
+		fmt.Fprintln(w, "    </edge>")
+	}
+	fmt.Fprintln(w, "  </graph>")
+	fmt.Fprintln(w, "</graphml>")
+}
+
+func writeDOT(w io.Writer) {
+	nodes, edges := graphNodes()
+
+	fmt.Fprintln(w, "digraph peers {")
+	for _, node := range nodes {
+		fmt.Fprintf(w, "  n%d [label=\"%d\", address=\"%s\", profile=\"%s\", validator=%t];\n", node.Identity, node.Identity, node.Address.Hex(), profileName(node), node.Validator)
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(w, "  n%d -> n%d [weight=%d, label=\"%dms\", bandwidth=%d];\n", edge.A.Identity, edge.B.Identity, edge.Latency, edge.Latency, edge.Bandwidth)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func writeGraphJSON(w io.Writer) {
+	type jsonNode struct {
+		Identity  uint64         `json:"identity"`
+		Address   common.Address `json:"address"`
+		Profile   string         `json:"profile,omitempty"`
+		Validator bool           `json:"validator,omitempty"`
+	}
+	type jsonEdge struct {
+		Source    uint64 `json:"source"`
+		Target    uint64 `json:"target"`
+		Latency   uint64 `json:"latency"`
+		Bandwidth uint64 `json:"bandwidth"`
+	}
+	var (
+		nodes, edges = graphNodes()
+		graph        = struct {
+			Nodes []jsonNode `json:"nodes"`
+			Edges []jsonEdge `json:"edges"`
+		}{
+			Nodes: make([]jsonNode, 0, len(nodes)),
+			Edges: make([]jsonEdge, 0, len(edges)),
+		}
+	)
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, jsonNode{node.Identity, node.Address, profileName(node), node.Validator})
+	}
+	for _, edge := range edges {
+		graph.Edges = append(graph.Edges, jsonEdge{edge.A.Identity, edge.B.Identity, edge.Latency, edge.Bandwidth})
+	}
+	blob, _ := json.MarshalIndent(graph, "", "  ")
+	w.Write(append(blob, '\n'))
+}
+
+// readTrace loads a message trace, as JSON lines if the file ends in .jsonl and
+// as CSV otherwise.
+func readTrace(path string) ([]*ethproto.TraceEntry, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	format := "csv"
+	if filepath.Ext(path) == ".jsonl" {
+		format = "jsonl"
+	}
+	return ethproto.ReadTrace(bufio.NewReader(in), format)
+}
+
+// blockTransmission is the receipt of a block, or of its announcement, by a
+// node from one of its peers.
+type blockTransmission struct {
+	From, To  uint64
+	Msg       string
+	Delay     int64 // Microseconds since the block was first sent
+	Hops      int   // Hops from the origin along the sending path, -1 if unknown
+	Redundant bool  // Whether the node already knew the block
+}
+
+// propagationTree is the reconstructed propagation of a block.
+type propagationTree struct {
+	Hash          string
+	Origin        uint64
+	Start         int64 // Time the block was first sent in microseconds
+	Transmissions []*blockTransmission
+	Announcements []*blockTransmission
+	Reached       map[uint64]*blockTransmission // First delivery by node
+}
+
+// blockMsgs are the messages propagating blocks, which start their trees.
+var blockMsgs = map[string]bool{"NewBlock": true, "NewCompactBlock": true, "NewBlockHashes": true}
+
+// deliveryMsgs are the messages delivering blocks, which form their trees.
+// Announced blocks are delivered by the header fetched in response.
+var deliveryMsgs = map[string]bool{"NewBlock": true, "NewCompactBlock": true, "BlockHeaders": true}
+
+// propagationTrees reconstructs the propagation trees of all blocks in a trace.
+// The origin of a block is the node sending or announcing it first, every other
+// node joins the tree through the peer it first received the block from.
+// Announcements are collected apart, as they do not deliver the block.
+func propagationTrees(entries []*ethproto.TraceEntry) []*propagationTree {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time < entries[j].Time })
+
+	var (
+		trees  []*propagationTree
+		byHash = make(map[string]*propagationTree)
+	)
+	for _, entry := range entries {
+		if (!blockMsgs[entry.Msg] && !deliveryMsgs[entry.Msg]) || entry.IDs == "" {
+			continue
+		}
+		for _, hash := range strings.Split(entry.IDs, ";") {
+			tree, ok := byHash[hash]
+			if !ok {
+				if entry.Dir != "send" || !blockMsgs[entry.Msg] {
+					continue // Sent before the trace started, or synced
+				}
+				tree = &propagationTree{
+					Hash:    hash,
+					Origin:  entry.From,
+					Start:   entry.Time,
+					Reached: make(map[uint64]*blockTransmission),
+				}
+				trees = append(trees, tree)
+				byHash[hash] = tree
+			}
+			if entry.Dir != "recv" {
+				continue
+			}
+			recv := &blockTransmission{
+				From:  entry.From,
+				To:    entry.To,
+				Msg:   entry.Msg,
+				Delay: entry.Time - tree.Start,
+				Hops:  -1,
+			}
+			if entry.From == tree.Origin {
+				recv.Hops = 1
+			} else if sender, ok := tree.Reached[entry.From]; ok && sender.Hops >= 0 {
+				recv.Hops = sender.Hops + 1
+			}
+			if !deliveryMsgs[entry.Msg] {
+				tree.Announcements = append(tree.Announcements, recv)
+				continue
+			}
+			if _, known := tree.Reached[entry.To]; known || entry.To == tree.Origin {
+				recv.Redundant = true
+			} else {
+				tree.Reached[entry.To] = recv
+			}
+			tree.Transmissions = append(tree.Transmissions, recv)
+		}
+	}
+	return trees
+}
+
+func writePropagation(w io.Writer, trees []*propagationTree) {
+	fmt.Fprintln(w, "block,from,to,msg,delay,hops,redundant")
+	for _, tree := range trees {
+		for _, recv := range tree.Transmissions {
+			fmt.Fprintf(w, "%s,%d,%d,%s,%.3f,%d,%t\n", tree.Hash, recv.From, recv.To, recv.Msg, float64(recv.Delay)/1000, recv.Hops, recv.Redundant)
+		}
+	}
+}
+
+func writeAnnouncements(w io.Writer, trees []*propagationTree) {
+	fmt.Fprintln(w, "block,from,to,delay,hops")
+	for _, tree := range trees {
+		for _, recv := range tree.Announcements {
+			fmt.Fprintf(w, "%s,%d,%d,%.3f,%d\n", tree.Hash, recv.From, recv.To, float64(recv.Delay)/1000, recv.Hops)
+		}
+	}
+}
+
+func writeBlockSummaries(w io.Writer, trees []*propagationTree) {
+	fmt.Fprintln(w, "block,origin,reached,transmissions,redundant,announcements,maxhops,coverage")
+	for _, tree := range trees {
+		var (
+			redundant int
+			maxHops   int
+			coverage  int64
+		)
+		for _, recv := range tree.Transmissions {
+			if recv.Redundant {
+				redundant++
+			}
+		}
+		for _, recv := range tree.Reached {
+			if recv.Hops > maxHops {
+				maxHops = recv.Hops
+			}
+			if recv.Delay > coverage {
+				coverage = recv.Delay
+			}
+		}
+		fmt.Fprintf(w, "%s,%d,%d,%d,%d,%d,%d,%.3f\n", tree.Hash, tree.Origin, len(tree.Reached)+1, len(tree.Transmissions), redundant, len(tree.Announcements), maxHops, float64(coverage)/1000)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// derivedKeys derives the p2p key and the account keys of a node from the seed of
+// the network, the account of the node coming first. Networks generated with
+// keystores have no derived keys.
+func derivedKeys(node *emu.Node) (*ecdsa.PrivateKey, []*ecdsa.PrivateKey, error) {
+	if len(emu.Global.Seed) == 0 {
+		return nil, nil, nil
+	}
+	nodeKey, err := emu.NodeKey(node.Identity)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := emu.AccountKey(node.Identity)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := []*ecdsa.PrivateKey{key}
+	for i := range node.Accounts {
+		key, err := emu.WorkloadKey(node.Identity, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+	}
+	return nodeKey, keys, nil
+}
+
+// errNoPassphrase is returned when a key wallet is asked to sign with a
+// passphrase, which it has no use for.
+var errNoPassphrase = errors.New("key wallet does not use passphrases")
+
+// keyWallet is an always unlocked wallet holding its keys in memory. It lets
+// nodes sign without a keystore.
+type keyWallet struct {
+	keys     map[common.Address]*ecdsa.PrivateKey
+	accounts []accounts.Account
+}
+
+// newKeyBackend creates an account backend serving a wallet with the given keys,
+// the first of which is the default account.
+func newKeyBackend(keys ...*ecdsa.PrivateKey) *keyBackend {
+	wallet := &keyWallet{keys: make(map[common.Address]*ecdsa.PrivateKey)}
+	for _, key := range keys {
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		wallet.keys[address] = key
+		wallet.accounts = append(wallet.accounts, accounts.Account{
+			Address: address,
+			URL:     accounts.URL{Scheme: "key", Path: address.Hex()},
+		})
+	}
+	return &keyBackend{wallet: wallet}
+}
+
+func (w *keyWallet) URL() accounts.URL            { return w.accounts[0].URL }
+func (w *keyWallet) Status() (string, error)      { return "Unlocked", nil }
+func (w *keyWallet) Open(passphrase string) error { return nil }
+func (w *keyWallet) Close() error                 { return nil }
+
+func (w *keyWallet) Accounts() []accounts.Account {
+	return append([]accounts.Account{}, w.accounts...)
+}
+
+func (w *keyWallet) Contains(account accounts.Account) bool {
+	_, ok := w.keys[account.Address]
+	return ok
+}
+
+func (w *keyWallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+func (w *keyWallet) SelfDerive(bases []accounts.DerivationPath, chain ethereum.ChainStateReader) {}
+
+// signHash signs a hash with the key of the wallet.
+func (w *keyWallet) signHash(account accounts.Account, hash []byte) ([]byte, error) {
+	key, ok := w.keys[account.Address]
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return crypto.Sign(hash, key)
+}
+
+// SignData signs the keccak256 hash of the given data.
+func (w *keyWallet) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	return w.signHash(account, crypto.Keccak256(data))
+}
+
+func (w *keyWallet) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	return nil, errNoPassphrase
+}
+
+// SignText signs the hash of the given text in the Ethereum signed message format.
+func (w *keyWallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return w.signHash(account, accounts.TextHash(text))
+}
+
+func (w *keyWallet) SignTextWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, errNoPassphrase
+}
+
+// SignTx signs the given transaction with the key of the wallet.
+func (w *keyWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, ok := w.keys[account.Address]
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+}
+
+func (w *keyWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, errNoPassphrase
+}
+
+// keyBackend is an account backend serving a fixed key wallet.
+type keyBackend struct {
+	wallet *keyWallet
+	feed   event.Feed // Never fires, the wallet is fixed
+}
+
+func (b *keyBackend) Wallets() []accounts.Wallet {
+	return []accounts.Wallet{b.wallet}
+}
+
+func (b *keyBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return b.feed.Subscribe(sink)
+}
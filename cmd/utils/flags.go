@@ -28,6 +28,7 @@ import (
 	godebug "runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
@@ -43,6 +44,7 @@ import (
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/internal/flags"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -636,6 +638,219 @@ var (
 		Value:    20,
 		Category: flags.EmuCategory,
 	}
+	MnemonicFlag = &cli.StringFlag{
+		Name:     "mnemonic",
+		Usage:    "Mnemonic sentence deriving the keys of all nodes (random seed if neither this nor --key.seed is set)",
+		Category: flags.EmuCategory,
+	}
+	KeySeedFlag = &cli.StringFlag{
+		Name:     "key.seed",
+		Usage:    "Hex encoded seed deriving the keys of all nodes",
+		Category: flags.EmuCategory,
+	}
+	AccountsFlag = &cli.IntFlag{
+		Name:     "accounts",
+		Usage:    "Number of extra funded workload accounts derived for each node",
+		Value:    0,
+		Category: flags.EmuCategory,
+	}
+	ProfilesFlag = &cli.StringFlag{
+		Name:     "profiles",
+		Usage:    "Fractions of nodes running a predefined configuration profile, e.g. archive=0.1,small-mempool=0.3,low-peer=0.2",
+		Category: flags.EmuCategory,
+	}
+	HashrateFlag = &cli.Uint64Flag{
+		Name:     "hashrate",
+		Usage:    "Simulated proof-of-work hashrate of a node in hashes per second (0 = seal on demand)",
+		Value:    0,
+		Category: flags.EmuCategory,
+	}
+	UploadFlag = &cli.Uint64Flag{
+		Name:     "upload",
+		Usage:    "Upload capacity of a node in bytes per millisecond, shared fairly by its transfers (0 = unlimited)",
+		Category: flags.EmuCategory,
+	}
+	DownloadFlag = &cli.Uint64Flag{
+		Name:     "download",
+		Usage:    "Download capacity of a node in bytes per millisecond, shared fairly by its transfers (0 = unlimited)",
+		Category: flags.EmuCategory,
+	}
+	ClockOffsetFlag = &cli.DurationFlag{
+		Name:     "clock.offset",
+		Usage:    "Largest offset of the clock of a node from the host clock, drawn at random per node (0 = synchronised clocks)",
+		Category: flags.EmuCategory,
+	}
+	ClockDriftFlag = &cli.Float64Flag{
+		Name:     "clock.drift",
+		Usage:    "Largest drift of the clock of a node in parts per million, drawn at random per node (0 = no drift)",
+		Category: flags.EmuCategory,
+	}
+	CPUGasCostFlag = &cli.Float64Flag{
+		Name:     "cpu.gascost",
+		Usage:    "Emulated block validation time of a node in nanoseconds per unit of gas (0 = host time)",
+		Category: flags.EmuCategory,
+	}
+	CPUTxCostFlag = &cli.Float64Flag{
+		Name:     "cpu.txcost",
+		Usage:    "Emulated signature recovery time of a node in microseconds per transaction (0 = host time)",
+		Category: flags.EmuCategory,
+	}
+	CPUSlowdownFlag = &cli.Float64Flag{
+		Name:     "cpu.slowdown",
+		Usage:    "Factor the modelled processing times of a node are stretched by, needs --cpu.gascost or --cpu.txcost (0 = no slowdown)",
+		Category: flags.EmuCategory,
+	}
+	ConsensusFlag = &cli.StringFlag{
+		Name:     "consensus",
+		Usage:    "Consensus engine of the emulated chain (ethash, bft)",
+		Value:    "ethash",
+		Category: flags.EmuCategory,
+	}
+	BFTValidatorsFlag = &cli.IntFlag{
+		Name:     "bft.validators",
+		Usage:    "Number of nodes in the BFT validator set (0 = all nodes)",
+		Value:    0,
+		Category: flags.EmuCategory,
+	}
+	ControlAddrFlag = &cli.StringFlag{
+		Name:     "control.addr",
+		Usage:    "Listen address of the emulator control RPC serving the emu namespace and the APIs of all nodes (empty = disabled)",
+		Category: flags.EmuCategory,
+	}
+	EmuDBFlag = &cli.StringFlag{
+		Name:     "emu.db",
+		Usage:    "Database of the emulated nodes, memory needs no init and writes the genesis at startup (disk, memory)",
+		Value:    "disk",
+		Category: flags.EmuCategory,
+	}
+	EmuDBCapFlag = &cli.IntFlag{
+		Name:     "emu.db.cap",
+		Usage:    "Size cap in megabytes of the in-memory database of a node (0 = unbounded)",
+		Value:    0,
+		Category: flags.EmuCategory,
+	}
+	EmuDBSpillFlag = &cli.BoolFlag{
+		Name:     "emu.db.spill",
+		Usage:    "Move in-memory databases exceeding their cap to a temporary folder on disk instead of failing",
+		Category: flags.EmuCategory,
+	}
+	BlockPropagationFlag = &cli.StringFlag{
+		Name:     "emu.propagation.block",
+		Usage:    "Policy choosing the peers to push new blocks to, the rest get announcements (sqrt, all, k:<n>, announce, early, tree)",
+		Value:    "sqrt",
+		Category: flags.EmuCategory,
+	}
+	TxPropagationFlag = &cli.StringFlag{
+		Name:     "emu.propagation.tx",
+		Usage:    "Policy choosing the peers to send or announce transactions to (sqrt, flood, announce, fanout:<n>, dandelion:<n>)",
+		Value:    "sqrt",
+		Category: flags.EmuCategory,
+	}
+	CompactBlocksFlag = &cli.BoolFlag{
+		Name:     "emu.compact",
+		Usage:    "Advertise eth/69 and push blocks in compact form to peers supporting it, which rebuild them from their pools",
+		Category: flags.EmuCategory,
+	}
+	EthVersionsFlag = &cli.StringFlag{
+		Name:     "emu.ethversions",
+		Usage:    "Comma separated eth protocol versions to advertise (66, 67, 68), all if empty",
+		Category: flags.EmuCategory,
+	}
+	TraceFlag = &cli.StringFlag{
+		Name:     "emu.trace",
+		Usage:    "File to log every eth message exchanged between nodes into, as JSON lines if it ends in .jsonl, CSV otherwise (empty = disabled)",
+		Category: flags.EmuCategory,
+	}
+	TxTrackFlag = &cli.BoolFlag{
+		Name:     "emu.txtrack",
+		Usage:    "Follow the lifecycle of every transaction across all nodes and log it to txlife.csv for the report command",
+		Category: flags.EmuCategory,
+	}
+	DiscoveryFlag = &cli.StringFlag{
+		Name:     "emu.discovery",
+		Usage:    "Mode of finding peers beyond the static topology, which is then left unwired (none, random, kademlia: closest nodes to random targets by a global XOR sort, no routing tables)",
+		Value:    "none",
+		Category: flags.EmuCategory,
+	}
+	DialRatioFlag = &cli.IntFlag{
+		Name:     "emu.dialratio",
+		Usage:    "Ratio of inbound to dialed connections of discovering nodes, 3 allowing a third of the peers to be dialed",
+		Value:    3,
+		Category: flags.EmuCategory,
+	}
+	ChurnRateFlag = &cli.Float64Flag{
+		Name:     "emu.churn.rate",
+		Usage:    "Fraction of the connections of every node dropped per churn interval, rewired to random nodes without discovery (0 = no churn)",
+		Category: flags.EmuCategory,
+	}
+	ChurnIntervalFlag = &cli.DurationFlag{
+		Name:     "emu.churn.interval",
+		Usage:    "Time between two rounds of connection churn",
+		Value:    10 * time.Second,
+		Category: flags.EmuCategory,
+	}
+	EvictionFlag = &cli.StringFlag{
+		Name:     "emu.eviction",
+		Usage:    "Policy choosing the peers dropped by churn (random, oldest, lowest-score)",
+		Value:    "random",
+		Category: flags.EmuCategory,
+	}
+	ScoreEvictionFlag = &cli.BoolFlag{
+		Name:     "emu.scoreeviction",
+		Usage:    "Evict the lowest scoring peer for new connections when all slots are taken",
+		Category: flags.EmuCategory,
+	}
+	TopologyFormatFlag = &cli.StringFlag{
+		Name:     "topology.format",
+		Usage:    "Format of the exported peer graph (graphml, dot, json)",
+		Value:    "graphml",
+		Category: flags.EmuCategory,
+	}
+	ReportTxLogFlag = &cli.StringFlag{
+		Name:     "report.txlog",
+		Usage:    "Transaction lifecycle log of the run to report on",
+		Value:    "txlife.csv",
+		Category: flags.EmuCategory,
+	}
+	ReportFractionFlag = &cli.Float64Flag{
+		Name:     "report.fraction",
+		Usage:    "Fraction of nodes a transaction has to reach to count as propagated",
+		Value:    0.9,
+		Category: flags.EmuCategory,
+	}
+	ReportDepthFlag = &cli.Uint64Flag{
+		Name:     "report.depth",
+		Usage:    "Number of confirmations on the submitting node a transaction needs to count as confirmed (1 = included)",
+		Value:    1,
+		Category: flags.EmuCategory,
+	}
+	LeanFlag = &cli.BoolFlag{
+		Name:     "emu.lean",
+		Usage:    "Run nodes without keystore, IPC and RPC servers, reachable only through the control endpoint at /node/<id>",
+		Category: flags.EmuCategory,
+	}
+	SharedCacheFlag = &cli.IntFlag{
+		Name:     "cache.shared",
+		Usage:    "Number of recovered senders, decoded transactions and headers kept in a process-wide cache shared by all nodes (0 = disabled)",
+		Value:    0,
+		Category: flags.EmuCategory,
+	}
+	MetricsAddrFlag = &cli.StringFlag{
+		Name:     "metrics.addr",
+		Usage:    "Listen address of the Prometheus endpoint exposing the metrics of all nodes (empty = disabled)",
+		Category: flags.EmuCategory,
+	}
+	MetricsSampleFlag = &cli.StringFlag{
+		Name:     "metrics.sample",
+		Usage:    "File to periodically sample the metrics of all nodes into, as JSON lines if it ends in .jsonl, CSV otherwise (empty = disabled)",
+		Category: flags.EmuCategory,
+	}
+	MetricsIntervalFlag = &cli.DurationFlag{
+		Name:     "metrics.interval",
+		Usage:    "Time between two metric samples",
+		Value:    time.Second,
+		Category: flags.EmuCategory,
+	}
 )
 
 var (
@@ -879,6 +1094,17 @@ func setEtherbase(ctx *cli.Context, cfg *ethconfig.Config, emu *emu.Node) {
 	cfg.Miner.Etherbase = common.BytesToAddress(b)
 }
 
+// setEthash applies the simulated proof-of-work hashrate, preferring the one
+// assigned to the emulated node over the command line flag.
+func setEthash(ctx *cli.Context, cfg *ethconfig.Config, emu *emu.Node) {
+	if ctx.IsSet(HashrateFlag.Name) {
+		cfg.Ethash.Hashrate = float64(ctx.Uint64(HashrateFlag.Name))
+	}
+	if emu != nil && emu.Hashrate > 0 {
+		cfg.Ethash.Hashrate = float64(emu.Hashrate)
+	}
+}
+
 func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config, emu *emu.Node) {
 	setNodeKey(ctx, cfg)
 	setListenAddress(ctx, cfg, emu)
@@ -890,6 +1116,28 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config, emu *emu.Node) {
 	if ctx.IsSet(MaxPendingPeersFlag.Name) {
 		cfg.MaxPendingPeers = ctx.Int(MaxPendingPeersFlag.Name)
 	}
+	if ctx.IsSet(DialRatioFlag.Name) {
+		cfg.DialRatio = ctx.Int(DialRatioFlag.Name)
+	}
+	if ctx.IsSet(EvictionFlag.Name) {
+		cfg.Eviction = ctx.String(EvictionFlag.Name)
+	}
+	if ctx.IsSet(ScoreEvictionFlag.Name) {
+		cfg.ScoreEviction = ctx.Bool(ScoreEvictionFlag.Name)
+	}
+	if emu != nil {
+		cfg.Metrics = metrics.Node(int(emu.Identity))
+		setDiscovery(ctx, cfg, emu.Address)
+	}
+}
+
+// setDiscovery configures the source of dial candidates of an emulated node.
+func setDiscovery(ctx *cli.Context, cfg *p2p.Config, addr common.Address) {
+	discovery, err := emu.NewDiscovery(ctx.String(DiscoveryFlag.Name), addr)
+	if err != nil {
+		Fatalf("%v", err)
+	}
+	cfg.Discovery = discovery
 }
 
 // SetNodeConfig applies node-related command line flags to the config.
@@ -901,6 +1149,7 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config, emu *emu.Node) {
 	setWS(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	SetDataDir(ctx, cfg, emu)
+	setDBEngine(ctx, cfg)
 
 	if ctx.IsSet(JWTSecretFlag.Name) {
 		cfg.JWTSecret = ctx.String(JWTSecretFlag.Name)
@@ -920,12 +1169,36 @@ func SetDataDir(ctx *cli.Context, cfg *node.Config, emu *emu.Node) {
 		if emu != nil {
 			base := ctx.String(DataDirFlag.Name)
 			cfg.DataDir = path.Join(base, fmt.Sprintf("emu%06d", emu.Identity))
+			cfg.SharedDatabase = sharedDatabase(base)
 		} else {
 			cfg.DataDir = ctx.String(DataDirFlag.Name)
 		}
 	}
 }
 
+// setDBEngine configures the database engine of the node from the set command
+// line flags.
+func setDBEngine(ctx *cli.Context, cfg *node.Config) {
+	switch engine := ctx.String(EmuDBFlag.Name); engine {
+	case "disk":
+	case "memory":
+		cfg.DBEngine = engine
+		cfg.DatabaseMemoryCap = ctx.Int(EmuDBCapFlag.Name)
+		cfg.DatabaseSpill = ctx.Bool(EmuDBSpillFlag.Name)
+	default:
+		Fatalf("Invalid database engine %q (disk, memory)", engine)
+	}
+}
+
+// sharedDatabase returns the folder of the databases shared by all emulated
+// nodes, empty if every node holds its own copy of the genesis.
+func sharedDatabase(base string) string {
+	if !emu.Global.Shared {
+		return ""
+	}
+	return path.Join(base, emu.SHARED_DIR)
+}
+
 func setGPO(ctx *cli.Context, cfg *gasprice.Config, light bool) {
 	// If we are running the light client, apply another group
 	// settings for gas oracle.
@@ -1065,6 +1338,7 @@ func SetEthConfig(ctx *cli.Context, cfg *ethconfig.Config, emu *emu.Node) {
 	setGPO(ctx, &cfg.GPO, ctx.String(SyncModeFlag.Name) == "light")
 	setTxPool(ctx, &cfg.TxPool)
 	setMiner(ctx, &cfg.Miner)
+	setEthash(ctx, cfg, emu)
 
 	// Ensure Go's GC ignores the database cache for trigger percentage
 	cache := ctx.Int(CacheFlag.Name)
@@ -1079,6 +1353,28 @@ func SetEthConfig(ctx *cli.Context, cfg *ethconfig.Config, emu *emu.Node) {
 	if ctx.IsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.Uint64(NetworkIdFlag.Name)
 	}
+	if ctx.IsSet(BlockPropagationFlag.Name) {
+		cfg.BlockPropagation = ctx.String(BlockPropagationFlag.Name)
+	}
+	if ctx.IsSet(TxPropagationFlag.Name) {
+		cfg.TxPropagation = ctx.String(TxPropagationFlag.Name)
+	}
+	if ctx.IsSet(CompactBlocksFlag.Name) {
+		cfg.CompactBlocks = ctx.Bool(CompactBlocksFlag.Name)
+	}
+	if ctx.IsSet(EthVersionsFlag.Name) {
+		cfg.ProtocolVersions = nil
+		for _, field := range strings.Split(ctx.String(EthVersionsFlag.Name), ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			version, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				Fatalf("Option %q: invalid eth version %q", EthVersionsFlag.Name, field)
+			}
+			cfg.ProtocolVersions = append(cfg.ProtocolVersions, uint(version))
+		}
+	}
 	if ctx.IsSet(CacheFlag.Name) || ctx.IsSet(CacheDatabaseFlag.Name) {
 		cfg.DatabaseCache = ctx.Int(CacheFlag.Name) * ctx.Int(CacheDatabaseFlag.Name) / 100
 	}
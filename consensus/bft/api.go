@@ -0,0 +1,69 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// API is a user facing RPC API to inspect the validators and the progress of
+// the agreement.
+type API struct {
+	chain consensus.ChainHeaderReader
+	bft   *BFT
+}
+
+// GetValidators retrieves the validator set.
+func (api *API) GetValidators() []common.Address {
+	return api.bft.Validators()
+}
+
+// GetSigners retrieves the validators that committed the block at the given
+// number, or at the head if none is given.
+func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
+	header := api.chain.CurrentHeader()
+	if number != nil && *number != rpc.LatestBlockNumber {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if header.Number.Sign() == 0 {
+		return []common.Address{}, nil
+	}
+	commit, err := decodeCommit(header)
+	if err != nil {
+		return nil, err
+	}
+	hash := SealHash(header)
+	signers := make([]common.Address, 0, len(commit.Seals))
+	for _, seal := range commit.Seals {
+		signer, err := recoverSigner(votePayload(msgPrecommit, header.Number.Uint64(), commit.Round, hash), seal)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// Status retrieves the height, round and step the local node is at.
+func (api *API) Status() *Status {
+	return api.bft.core.status()
+}
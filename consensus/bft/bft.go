@@ -0,0 +1,564 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bft implements a leader-based Byzantine fault tolerant consensus
+// engine with immediate finality, modelled after Tendermint's propose, prevote
+// and precommit rounds.
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	"golang.org/x/crypto/sha3"
+)
+
+// BFT protocol constants.
+var (
+	defaultPeriod       = uint64(1)    // Default minimum number of seconds between blocks
+	defaultRoundTimeout = uint64(2000) // Default base timeout of a round step in milliseconds
+
+	allowedFutureBlockTime = uint64(15) // Max seconds from current time allowed for blocks, before they're considered future blocks
+
+	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for proposer vanity
+
+	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+
+	blockDifficulty = big.NewInt(1) // Every finalized block carries the same weight
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a
+	// block that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errMissingVanity is returned if a block's extra-data section is shorter than
+	// 32 bytes, which is required to store the proposer vanity.
+	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
+
+	// errInvalidCommit is returned if the commit seals appended to the extra-data
+	// section cannot be decoded.
+	errInvalidCommit = errors.New("invalid commit seals")
+
+	// errInsufficientCommit is returned if a block is not backed by precommits
+	// of a quorum of distinct validators.
+	errInsufficientCommit = errors.New("insufficient commit seals")
+
+	// errUnauthorizedValidator is returned if a header is proposed or committed
+	// by an entity that is not part of the validator set.
+	errUnauthorizedValidator = errors.New("unauthorized validator")
+
+	// errInvalidMixDigest is returned if a block's mix digest is non-zero.
+	errInvalidMixDigest = errors.New("non-zero mix digest")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is not 1.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+)
+
+// SignerFn hashes and signs the data to be signed by a backing account.
+type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
+
+// ImportFn inserts a decided block into the local chain and relays it.
+type ImportFn func(block *types.Block)
+
+// ProcessFn executes a proposed block against the state of its parent, failing
+// if the block is invalid.
+type ProcessFn func(block *types.Block) error
+
+// commitExtra is the consensus data appended to the vanity of a finalized
+// block's extra-data: the round it was decided in and the precommit signatures
+// of the validators that decided it.
+type commitExtra struct {
+	Round uint64
+	Seals [][]byte
+}
+
+// BFT is a leader-based BFT consensus engine. Validators take turns proposing
+// blocks, and a block is final as soon as a quorum of them has prevoted and
+// precommitted it within a single round.
+type BFT struct {
+	config     *params.BFTConfig // Consensus engine configuration parameters
+	validators []common.Address  // Fixed validator set, ordered by proposer rotation
+	db         ethdb.Database    // Database the engine was created for
+
+	core  *core    // Round state machine driving the agreement
+	peers *peerSet // Peers connected on the bft sub-protocol
+
+	chain     consensus.ChainHeaderReader // Chain reader captured from the sealing requests
+	signer    common.Address              // Ethereum address of the signing key
+	signFn    SignerFn                    // Signer function to authorize votes with
+	importFn  ImportFn                    // Importer of blocks decided without a local sealing task
+	processFn ProcessFn                   // Executor of proposals before they are prevoted
+	lock      sync.RWMutex                // Protects the chain, signer, importer and processor fields
+}
+
+// New creates a BFT consensus engine with the validator set defined in the
+// genesis chain configuration.
+func New(config *params.BFTConfig, db ethdb.Database) *BFT {
+	// Set any missing consensus parameters to their defaults
+	conf := *config
+	if conf.Period == 0 {
+		conf.Period = defaultPeriod
+	}
+	if conf.RoundTimeout == 0 {
+		conf.RoundTimeout = defaultRoundTimeout
+	}
+	b := &BFT{
+		config:     &conf,
+		validators: conf.Validators,
+		db:         db,
+		peers:      newPeerSet(),
+	}
+	b.core = newCore(b)
+	return b
+}
+
+// Authorize injects a private key into the consensus engine to participate in
+// the agreement as the given validator.
+func (b *BFT) Authorize(signer common.Address, signFn SignerFn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.signer = signer
+	b.signFn = signFn
+}
+
+// SetImporter injects the function decided blocks are inserted into the local
+// chain with, unless the local miner seals them.
+func (b *BFT) SetImporter(importFn ImportFn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.importFn = importFn
+}
+
+// SetProcessor injects the function proposals are executed with before the
+// local validator prevotes them.
+func (b *BFT) SetProcessor(processFn ProcessFn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.processFn = processFn
+}
+
+// processor retrieves the function executing proposals, nil if not set.
+func (b *BFT) processor() ProcessFn {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.processFn
+}
+
+// importer retrieves the function inserting decided blocks, nil if not set.
+func (b *BFT) importer() ImportFn {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.importFn
+}
+
+// Validators returns the fixed validator set of the engine.
+func (b *BFT) Validators() []common.Address {
+	return append([]common.Address{}, b.validators...)
+}
+
+// isValidator reports whether the given address is part of the validator set.
+func (b *BFT) isValidator(addr common.Address) bool {
+	for _, validator := range b.validators {
+		if validator == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// proposer returns the validator in charge of proposing in the given round.
+func (b *BFT) proposer(height, round uint64) common.Address {
+	return b.validators[(height+round)%uint64(len(b.validators))]
+}
+
+// quorum returns the number of distinct validators needed to decide, tolerating
+// up to a third of them being faulty.
+func (b *BFT) quorum() int {
+	n := len(b.validators)
+	return n - (n-1)/3
+}
+
+// setChain remembers the chain reader the protocol handlers validate against.
+func (b *BFT) setChain(chain consensus.ChainHeaderReader) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.chain = chain
+}
+
+// getChain retrieves the chain reader, nil if no sealing was requested yet.
+func (b *BFT) getChain() consensus.ChainHeaderReader {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.chain
+}
+
+// Author implements consensus.Engine, returning the validator that proposed
+// the block.
+func (b *BFT) Author(header *types.Header) (common.Address, error) {
+	return header.Coinbase, nil
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (b *BFT) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return b.verifyHeader(chain, header, nil, seal)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (b *BFT) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := b.verifyHeader(chain, header, headers[:i], seals[i])
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database.
+func (b *BFT) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, seal bool) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future, tolerating the clock
+	// drift between validators
+	if header.Time > uint64(consensus.Now(chain).Unix())+allowedFutureBlockTime {
+		return consensus.ErrFutureBlock
+	}
+	// Check that the extra-data contains the vanity
+	if len(header.Extra) < extraVanity {
+		return errMissingVanity
+	}
+	// Ensure that the mix digest is zero as we don't have fork protection currently
+	if header.MixDigest != (common.Hash{}) {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in BFT
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	// Ensure that the block's difficulty is meaningful (may not be correct at this point)
+	if number > 0 && (header.Difficulty == nil || header.Difficulty.Cmp(blockDifficulty) != 0) {
+		return errInvalidDifficulty
+	}
+	// Verify that the gas limit is <= 2^63-1
+	if header.GasLimit > params.MaxGasLimit {
+		return fmt.Errorf("invalid gasLimit: have %v, max %v", header.GasLimit, params.MaxGasLimit)
+	}
+	if chain.Config().IsShanghai(header.Time) {
+		return fmt.Errorf("bft does not support shanghai fork")
+	}
+	if chain.Config().IsCancun(header.Time) {
+		return fmt.Errorf("bft does not support cancun fork")
+	}
+	// The genesis block is the always valid dead-end
+	if number == 0 {
+		return nil
+	}
+	// Ensure that the block's timestamp isn't too close to its parent
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Time+b.config.Period > header.Time {
+		return errInvalidTimestamp
+	}
+	// Verify that the gasUsed is <= gasLimit
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
+	}
+	if !chain.Config().IsLondon(header.Number) {
+		// Verify BaseFee not present before EIP-1559 fork.
+		if header.BaseFee != nil {
+			return fmt.Errorf("invalid baseFee before fork: have %d, want <nil>", header.BaseFee)
+		}
+		if err := misc.VerifyGaslimit(parent.GasLimit, header.GasLimit); err != nil {
+			return err
+		}
+	} else if err := misc.VerifyEip1559Header(chain.Config(), parent, header); err != nil {
+		// Verify the header's EIP-1559 attributes.
+		return err
+	}
+	// Only validators may propose blocks
+	if !b.isValidator(header.Coinbase) {
+		return errUnauthorizedValidator
+	}
+	if !seal {
+		return nil
+	}
+	return b.verifyCommit(header)
+}
+
+// verifyCommit checks that the header is backed by precommits from a quorum of
+// distinct validators, making the block final.
+func (b *BFT) verifyCommit(header *types.Header) error {
+	commit, err := decodeCommit(header)
+	if err != nil {
+		return err
+	}
+	var (
+		hash    = SealHash(header)
+		payload = votePayload(msgPrecommit, header.Number.Uint64(), commit.Round, hash)
+		signers = make(map[common.Address]struct{})
+	)
+	for _, seal := range commit.Seals {
+		signer, err := recoverSigner(payload, seal)
+		if err != nil {
+			return errInvalidCommit
+		}
+		if !b.isValidator(signer) {
+			return errUnauthorizedValidator
+		}
+		signers[signer] = struct{}{}
+	}
+	if len(signers) < b.quorum() {
+		return errInsufficientCommit
+	}
+	return nil
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (b *BFT) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing all the consensus fields of the
+// header for running the transactions on top.
+func (b *BFT) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	header.Nonce = types.BlockNonce{}
+	header.MixDigest = common.Hash{}
+	header.Difficulty = new(big.Int).Set(blockDifficulty)
+
+	// Keep only the vanity, the commit seals are appended once decided
+	if len(header.Extra) < extraVanity {
+		header.Extra = append(header.Extra, bytes.Repeat([]byte{0x00}, extraVanity-len(header.Extra))...)
+	}
+	header.Extra = header.Extra[:extraVanity]
+
+	// Ensure the timestamp has the correct delay
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Time = parent.Time + b.config.Period
+	if now := uint64(consensus.Now(chain).Unix()); header.Time < now {
+		header.Time = now
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine. There is no post-transaction consensus
+// rule in BFT, do nothing here.
+func (b *BFT) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, withdrawals []*types.Withdrawal) {
+	// No block rewards in BFT, so the state remains as is
+}
+
+// FinalizeAndAssemble implements consensus.Engine, setting the final state and
+// assembling the block.
+func (b *BFT) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt, withdrawals []*types.Withdrawal) (*types.Block, error) {
+	if len(withdrawals) > 0 {
+		return nil, errors.New("bft does not support withdrawals")
+	}
+	// Finalize block
+	b.Finalize(chain, header, state, txs, uncles, nil)
+
+	// Assign the final state root to header.
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+
+	// Assemble and return the final block for sealing.
+	return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil)), nil
+}
+
+// Seal implements consensus.Engine, handing the block to the agreement as the
+// local candidate for its height. The sealed block is returned on the node whose
+// candidate was decided, all other validators import it themselves. Closing
+// stop withdraws the candidate. Nodes outside the validator set only use it to
+// follow the height and relay votes.
+func (b *BFT) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	b.setChain(chain)
+	return b.core.submit(&sealTask{block: block, results: results, stop: stop})
+}
+
+// AutoSeal implements consensus.AutoSealer. Validators take part in every
+// height, so each new sealing task is handed to the agreement right away.
+func (b *BFT) AutoSeal() bool {
+	return true
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (b *BFT) SealHash(header *types.Header) common.Hash {
+	return SealHash(header)
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. Every finalized block
+// has the same difficulty.
+func (b *BFT) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	return new(big.Int).Set(blockDifficulty)
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to query
+// the validator set and the state of the agreement.
+func (b *BFT) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "bft",
+		Service:   &API{chain: chain, bft: b},
+	}}
+}
+
+// Close implements consensus.Engine, terminating the round state machine.
+func (b *BFT) Close() error {
+	b.core.close()
+	return nil
+}
+
+// sign signs the given payload with the local validator key.
+func (b *BFT) sign(payload []byte) (common.Address, []byte, error) {
+	b.lock.RLock()
+	signer, signFn := b.signer, b.signFn
+	b.lock.RUnlock()
+
+	if signFn == nil {
+		return common.Address{}, nil, errUnauthorizedValidator
+	}
+	sig, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeBFT, payload)
+	return signer, sig, err
+}
+
+// SealHash returns the hash of a block prior to it being sealed, i.e. without
+// the commit seals appended after the extra-data vanity.
+func SealHash(header *types.Header) (hash common.Hash) {
+	hasher := sha3.NewLegacyKeccak256()
+	encodeSealHeader(hasher, header)
+	hasher.(crypto.KeccakState).Read(hash[:])
+	return hash
+}
+
+func encodeSealHeader(w io.Writer, header *types.Header) {
+	extra := header.Extra
+	if len(extra) > extraVanity {
+		extra = extra[:extraVanity]
+	}
+	enc := []interface{}{
+		header.ParentHash,
+		header.UncleHash,
+		header.Coinbase,
+		header.Root,
+		header.TxHash,
+		header.ReceiptHash,
+		header.Bloom,
+		header.Difficulty,
+		header.Number,
+		header.GasLimit,
+		header.GasUsed,
+		header.Time,
+		extra,
+		header.MixDigest,
+		header.Nonce,
+	}
+	if header.BaseFee != nil {
+		enc = append(enc, header.BaseFee)
+	}
+	if header.WithdrawalsHash != nil {
+		panic("unexpected withdrawal hash value in bft")
+	}
+	if err := rlp.Encode(w, enc); err != nil {
+		panic("can't encode: " + err.Error())
+	}
+}
+
+// decodeCommit extracts the commit seals from a finalized header.
+func decodeCommit(header *types.Header) (*commitExtra, error) {
+	if len(header.Extra) < extraVanity {
+		return nil, errMissingVanity
+	}
+	if len(header.Extra) == extraVanity {
+		return nil, errInsufficientCommit
+	}
+	commit := new(commitExtra)
+	if err := rlp.DecodeBytes(header.Extra[extraVanity:], commit); err != nil {
+		return nil, errInvalidCommit
+	}
+	return commit, nil
+}
+
+// withCommit returns a copy of the block with the given commit seals appended
+// to its extra-data vanity.
+func withCommit(block *types.Block, round uint64, seals [][]byte) (*types.Block, error) {
+	blob, err := rlp.EncodeToBytes(&commitExtra{Round: round, Seals: seals})
+	if err != nil {
+		return nil, err
+	}
+	header := block.Header()
+	header.Extra = append(header.Extra[:extraVanity:extraVanity], blob...)
+	return block.WithSeal(header), nil
+}
@@ -0,0 +1,684 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	inboundQueueSize = 256  // Number of consensus messages buffered before the peers block
+	seenMessages     = 8192 // Number of recent message hashes to deduplicate gossip with
+	maxBacklog       = 4096 // Maximum number of messages for future heights to retain
+)
+
+var errEngineClosed = errors.New("bft engine closed")
+
+// step is a phase of a consensus round.
+type step int
+
+const (
+	stepPropose step = iota
+	stepPrevote
+	stepPrecommit
+	stepCommit
+)
+
+func (s step) String() string {
+	switch s {
+	case stepPropose:
+		return "propose"
+	case stepPrevote:
+		return "prevote"
+	case stepPrecommit:
+		return "precommit"
+	default:
+		return "commit"
+	}
+}
+
+// timeoutKind identifies which round step a timeout was scheduled for.
+type timeoutKind int
+
+const (
+	timeoutProposeAt timeoutKind = iota // Local proposal is due once its timestamp is reached
+	timeoutPropose                      // No valid proposal arrived in time
+	timeoutPrevote                      // Prevotes were split across blocks
+	timeoutPrecommit                    // Precommits were split across blocks
+)
+
+// sealTask is a local block candidate handed over by the miner.
+type sealTask struct {
+	block   *types.Block
+	results chan<- *types.Block
+	stop    <-chan struct{}
+}
+
+// inbound is a consensus message waiting to be processed.
+type inbound struct {
+	msg    *message
+	origin enode.ID
+}
+
+// timeout is a fired round step timer.
+type timeout struct {
+	kind   timeoutKind
+	height uint64
+	round  uint64
+}
+
+// roundState holds the proposal and votes seen within a single round.
+type roundState struct {
+	proposal   *types.Block
+	proposed   bool // Whether the local node already proposed in this round
+	prevotes   map[common.Address]common.Hash
+	precommits map[common.Address]common.Hash
+	seals      map[common.Address][]byte // Precommit signatures forming the commit
+	timedOut   map[timeoutKind]bool      // Step timers already scheduled in this round
+}
+
+func newRoundState() *roundState {
+	return &roundState{
+		prevotes:   make(map[common.Address]common.Hash),
+		precommits: make(map[common.Address]common.Hash),
+		seals:      make(map[common.Address][]byte),
+		timedOut:   make(map[timeoutKind]bool),
+	}
+}
+
+// majority returns the hash a quorum of the given votes agree on, if any.
+func majority(votes map[common.Address]common.Hash, quorum int) (common.Hash, bool) {
+	counts := make(map[common.Hash]int)
+	for _, hash := range votes {
+		if counts[hash]++; counts[hash] >= quorum {
+			return hash, true
+		}
+	}
+	return common.Hash{}, false
+}
+
+// Status is a summary of the agreement progress of the local node.
+type Status struct {
+	Height   uint64         `json:"height"`
+	Round    uint64         `json:"round"`
+	Step     string         `json:"step"`
+	Proposer common.Address `json:"proposer"`
+	Locked   *common.Hash   `json:"locked"`
+	Peers    int            `json:"peers"`
+}
+
+// core is the round state machine of a validator. All state is owned by the
+// loop goroutine, the rest of the engine only talks to it through channels.
+type core struct {
+	bft *BFT
+
+	taskCh    chan *sealTask
+	cancelCh  chan *sealTask
+	msgCh     chan inbound
+	timeoutCh chan timeout
+	statusCh  chan chan *Status
+	closeCh   chan struct{}
+
+	height      uint64
+	round       uint64
+	step        step
+	decided     bool
+	rounds      map[uint64]*roundState
+	locked      *types.Block
+	lockedRound uint64
+	tasks       map[common.Hash]*sealTask // Local candidates of the current height
+	candidate   *sealTask                 // Most recent local candidate
+
+	backlog     map[uint64][]*message // Messages of future heights
+	backlogSize int
+	seen        lru.BasicLRU[common.Hash, struct{}]
+}
+
+func newCore(bft *BFT) *core {
+	c := &core{
+		bft:       bft,
+		taskCh:    make(chan *sealTask),
+		cancelCh:  make(chan *sealTask),
+		msgCh:     make(chan inbound, inboundQueueSize),
+		timeoutCh: make(chan timeout),
+		statusCh:  make(chan chan *Status),
+		closeCh:   make(chan struct{}),
+		rounds:    make(map[uint64]*roundState),
+		tasks:     make(map[common.Hash]*sealTask),
+		backlog:   make(map[uint64][]*message),
+		seen:      lru.NewBasicLRU[common.Hash, struct{}](seenMessages),
+	}
+	go c.loop()
+	return c
+}
+
+// submit hands a local block candidate to the state machine.
+func (c *core) submit(task *sealTask) error {
+	select {
+	case c.taskCh <- task:
+		return nil
+	case <-c.closeCh:
+		return errEngineClosed
+	}
+}
+
+// deliver hands a consensus message received from the given peer to the state
+// machine.
+func (c *core) deliver(msg *message, origin enode.ID) {
+	select {
+	case c.msgCh <- inbound{msg: msg, origin: origin}:
+	case <-c.closeCh:
+	}
+}
+
+// status retrieves a summary of the agreement progress.
+func (c *core) status() *Status {
+	req := make(chan *Status, 1)
+	select {
+	case c.statusCh <- req:
+		return <-req
+	case <-c.closeCh:
+		return nil
+	}
+}
+
+// close terminates the state machine.
+func (c *core) close() {
+	select {
+	case <-c.closeCh:
+	default:
+		close(c.closeCh)
+	}
+}
+
+func (c *core) loop() {
+	for {
+		select {
+		case task := <-c.taskCh:
+			c.handleTask(task)
+		case task := <-c.cancelCh:
+			c.cancelTask(task)
+		case in := <-c.msgCh:
+			c.handleMessage(in.msg, in.origin)
+		case ev := <-c.timeoutCh:
+			c.handleTimeout(ev)
+		case req := <-c.statusCh:
+			req <- c.snapshot()
+		case <-c.closeCh:
+			return
+		}
+	}
+}
+
+// snapshot assembles the current status.
+func (c *core) snapshot() *Status {
+	status := &Status{
+		Height: c.height,
+		Round:  c.round,
+		Step:   c.step.String(),
+	}
+	if len(c.bft.validators) > 0 {
+		status.Proposer = c.bft.proposer(c.height, c.round)
+	}
+	if c.locked != nil {
+		hash := SealHash(c.locked.Header())
+		status.Locked = &hash
+	}
+	c.bft.peers.lock.RLock()
+	status.Peers = len(c.bft.peers.peers)
+	c.bft.peers.lock.RUnlock()
+
+	return status
+}
+
+// handleTask records a new local candidate, moving to its height if the local
+// chain progressed.
+func (c *core) handleTask(task *sealTask) {
+	number := task.block.NumberU64()
+	if number < c.height || (number == c.height && c.decided) {
+		return
+	}
+	if number > c.height {
+		c.newHeight(number)
+	}
+	c.tasks[SealHash(task.block.Header())] = task
+	c.candidate = task
+	c.tryPropose()
+
+	// Withdraw the candidate once the miner abandons it
+	go func() {
+		select {
+		case <-task.stop:
+		case <-c.closeCh:
+			return
+		}
+		select {
+		case c.cancelCh <- task:
+		case <-c.closeCh:
+		}
+	}()
+}
+
+// cancelTask withdraws a local candidate abandoned by the miner. A block
+// already proposed from it may still be decided, and is then imported like
+// any remote one.
+func (c *core) cancelTask(task *sealTask) {
+	hash := SealHash(task.block.Header())
+	if c.tasks[hash] == task {
+		delete(c.tasks, hash)
+	}
+	if c.candidate == task {
+		c.candidate = nil
+	}
+}
+
+// newHeight resets the state machine to agree on the block at the given height.
+func (c *core) newHeight(height uint64) {
+	c.height = height
+	c.decided = false
+	c.rounds = make(map[uint64]*roundState)
+	c.locked, c.lockedRound = nil, 0
+	c.tasks = make(map[common.Hash]*sealTask)
+	c.candidate = nil
+
+	c.enterRound(0)
+
+	// Replay anything that arrived while the local chain was lagging behind
+	backlog := c.backlog[height]
+	for number, msgs := range c.backlog {
+		if number <= height {
+			c.backlogSize -= len(msgs)
+			delete(c.backlog, number)
+		}
+	}
+	for _, msg := range backlog {
+		c.process(msg)
+	}
+}
+
+// enterRound starts the given round of the current height.
+func (c *core) enterRound(round uint64) {
+	c.round, c.step = round, stepPropose
+	c.schedule(timeoutPropose, c.timeout(round))
+	c.tryPropose()
+}
+
+// timeout returns the step timeout of a round, growing with every failed round
+// so that eventually all honest validators overlap.
+func (c *core) timeout(round uint64) time.Duration {
+	base := time.Duration(c.bft.config.RoundTimeout) * time.Millisecond
+	return base + base*time.Duration(round)/2
+}
+
+// schedule arms a step timer of the current round.
+func (c *core) schedule(kind timeoutKind, delay time.Duration) {
+	ev := timeout{kind: kind, height: c.height, round: c.round}
+	time.AfterFunc(delay, func() {
+		select {
+		case c.timeoutCh <- ev:
+		case <-c.closeCh:
+		}
+	})
+}
+
+func (c *core) handleTimeout(ev timeout) {
+	if ev.height != c.height || ev.round != c.round || c.decided {
+		return
+	}
+	switch ev.kind {
+	case timeoutProposeAt:
+		c.tryPropose()
+	case timeoutPropose:
+		if c.step == stepPropose {
+			c.prevote()
+		}
+	case timeoutPrevote:
+		if c.step == stepPrevote {
+			c.precommit(common.Hash{})
+		}
+	case timeoutPrecommit:
+		if c.step == stepPrecommit {
+			c.enterRound(c.round + 1)
+		}
+	}
+}
+
+// roundState retrieves the state of the given round, creating it if needed.
+func (c *core) roundState(round uint64) *roundState {
+	rs := c.rounds[round]
+	if rs == nil {
+		rs = newRoundState()
+		c.rounds[round] = rs
+	}
+	return rs
+}
+
+// tryPropose proposes a block if the local validator leads the current round.
+func (c *core) tryPropose() {
+	if c.step != stepPropose || c.decided {
+		return
+	}
+	self := c.self()
+	if self == (common.Address{}) || c.bft.proposer(c.height, c.round) != self {
+		return
+	}
+	rs := c.roundState(c.round)
+	if rs.proposed {
+		return
+	}
+	// Re-propose a locked block, otherwise the freshest local candidate
+	block := c.locked
+	if block == nil {
+		if c.candidate == nil {
+			return
+		}
+		block = c.candidate.block
+	}
+	if wait := time.Until(time.Unix(int64(block.Time()), 0)); wait > 0 {
+		c.schedule(timeoutProposeAt, wait)
+		return
+	}
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		log.Error("Failed to encode proposal", "err", err)
+		return
+	}
+	rs.proposed = true
+	c.send(msgProposal, SealHash(block.Header()), blob)
+}
+
+// prevote casts the prevote of the current round and moves to its prevote step.
+func (c *core) prevote() {
+	c.step = stepPrevote
+
+	var hash common.Hash
+	if c.locked != nil {
+		hash = SealHash(c.locked.Header())
+	} else if proposal := c.roundState(c.round).proposal; proposal != nil {
+		hash = SealHash(proposal.Header())
+	}
+	c.send(msgPrevote, hash, nil)
+	c.check(c.round)
+}
+
+// precommit casts the precommit of the current round and moves to its
+// precommit step.
+func (c *core) precommit(hash common.Hash) {
+	c.step = stepPrecommit
+	c.send(msgPrecommit, hash, nil)
+	c.check(c.round)
+}
+
+// self returns the address of the local validator, or the zero address if the
+// node doesn't take part in the agreement.
+func (c *core) self() common.Address {
+	c.bft.lock.RLock()
+	defer c.bft.lock.RUnlock()
+
+	if c.bft.signFn == nil || !c.bft.isValidator(c.bft.signer) {
+		return common.Address{}
+	}
+	return c.bft.signer
+}
+
+// send signs a consensus message of the current round, processes it locally
+// and gossips it to all peers.
+func (c *core) send(code uint64, hash common.Hash, block []byte) {
+	if c.self() == (common.Address{}) {
+		return
+	}
+	msg := &message{
+		Code:   code,
+		Height: c.height,
+		Round:  c.round,
+		Hash:   hash,
+		Block:  block,
+	}
+	sender, sig, err := c.bft.sign(msg.payload())
+	if err != nil {
+		log.Warn("Failed to sign consensus message", "err", err)
+		return
+	}
+	msg.Signature = sig
+	if msg.blob, err = rlp.EncodeToBytes(msg); err != nil {
+		log.Error("Failed to encode consensus message", "err", err)
+		return
+	}
+	msg.sender = sender
+	if code == msgProposal {
+		if msg.block, err = decodeMessageBlock(block); err != nil {
+			return
+		}
+	}
+	c.process(msg)
+}
+
+// decodeMessageBlock decodes the block carried by a local proposal.
+func decodeMessageBlock(blob []byte) (*types.Block, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(blob, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// handleMessage processes a message received from a remote peer.
+func (c *core) handleMessage(msg *message, origin enode.ID) {
+	hash := crypto.Keccak256Hash(msg.blob)
+	if c.seen.Contains(hash) {
+		return
+	}
+	c.seen.Add(hash, struct{}{})
+
+	if msg.Height < c.height || !c.bft.isValidator(msg.sender) {
+		return
+	}
+	c.bft.peers.broadcast(msg.blob, origin)
+
+	if msg.Height > c.height {
+		if c.backlogSize < maxBacklog {
+			c.backlog[msg.Height] = append(c.backlog[msg.Height], msg)
+			c.backlogSize++
+		}
+		return
+	}
+	c.process(msg)
+}
+
+// process applies a message of the current height to the round state.
+func (c *core) process(msg *message) {
+	if msg.sender == c.self() {
+		// Local messages skip the inbound path, so gossip them here
+		hash := crypto.Keccak256Hash(msg.blob)
+		if !c.seen.Contains(hash) {
+			c.seen.Add(hash, struct{}{})
+			c.bft.peers.broadcast(msg.blob, enode.ID{})
+		}
+	}
+	if c.decided {
+		return
+	}
+	rs := c.roundState(msg.Round)
+	switch msg.Code {
+	case msgProposal:
+		if msg.sender != c.bft.proposer(c.height, msg.Round) || rs.proposal != nil {
+			return
+		}
+		if msg.sender != c.self() {
+			if err := c.validate(msg.block); err != nil {
+				log.Debug("Rejected BFT proposal", "number", msg.Height, "round", msg.Round, "err", err)
+
+				// Prevote nil right away rather than waiting for the proposal timeout
+				if msg.Round == c.round && c.step == stepPropose {
+					c.prevote()
+				}
+				return
+			}
+		}
+		rs.proposal = msg.block
+		if msg.Round == c.round && c.step == stepPropose {
+			c.prevote()
+			return
+		}
+	case msgPrevote:
+		if _, ok := rs.prevotes[msg.sender]; ok {
+			return
+		}
+		rs.prevotes[msg.sender] = msg.Hash
+	case msgPrecommit:
+		if _, ok := rs.precommits[msg.sender]; ok {
+			return
+		}
+		rs.precommits[msg.sender] = msg.Hash
+		rs.seals[msg.sender] = msg.Signature
+	}
+	c.check(msg.Round)
+}
+
+// validate checks a remote proposal against the local chain, executing it on
+// top of its parent state if a processor is set. Local proposals were built by
+// the local miner and need no checking.
+func (c *core) validate(block *types.Block) error {
+	chain := c.bft.getChain()
+	if chain == nil {
+		return errUnknownBlock
+	}
+	if err := c.bft.verifyHeader(chain, block.Header(), nil, false); err != nil {
+		return err
+	}
+	if processFn := c.bft.processor(); processFn != nil {
+		return processFn(block)
+	}
+	return nil
+}
+
+// blockFor looks up a known block by its seal hash.
+func (c *core) blockFor(hash common.Hash) *types.Block {
+	if c.locked != nil && SealHash(c.locked.Header()) == hash {
+		return c.locked
+	}
+	for _, rs := range c.rounds {
+		if rs.proposal != nil && SealHash(rs.proposal.Header()) == hash {
+			return rs.proposal
+		}
+	}
+	return nil
+}
+
+// check advances the state machine based on the votes of the given round.
+func (c *core) check(round uint64) {
+	if c.decided {
+		return
+	}
+	var (
+		rs     = c.roundState(round)
+		quorum = c.bft.quorum()
+	)
+	// Decide as soon as a quorum precommitted a known block in any round
+	if hash, ok := majority(rs.precommits, quorum); ok && hash != (common.Hash{}) {
+		if block := c.blockFor(hash); block != nil {
+			c.commit(round, hash, block)
+			return
+		}
+	}
+	// Catch up with a later round once more than a third of validators is in it
+	if round > c.round {
+		participants := make(map[common.Address]struct{})
+		for addr := range rs.prevotes {
+			participants[addr] = struct{}{}
+		}
+		for addr := range rs.precommits {
+			participants[addr] = struct{}{}
+		}
+		if len(participants) > len(c.bft.validators)-quorum {
+			c.enterRound(round)
+		}
+		return
+	}
+	if round != c.round {
+		return
+	}
+	switch c.step {
+	case stepPrevote:
+		if hash, ok := majority(rs.prevotes, quorum); ok {
+			if hash == (common.Hash{}) {
+				// A quorum saw no acceptable proposal, release any lock
+				c.locked = nil
+				c.precommit(hash)
+				return
+			}
+			if block := c.blockFor(hash); block != nil {
+				c.locked, c.lockedRound = block, round
+				c.precommit(hash)
+			}
+			return
+		}
+		if len(rs.prevotes) >= quorum && !rs.timedOut[timeoutPrevote] {
+			rs.timedOut[timeoutPrevote] = true
+			c.schedule(timeoutPrevote, c.timeout(round))
+		}
+	case stepPrecommit:
+		if len(rs.precommits) >= quorum && !rs.timedOut[timeoutPrecommit] {
+			rs.timedOut[timeoutPrecommit] = true
+			c.schedule(timeoutPrecommit, c.timeout(round))
+		}
+	}
+}
+
+// commit finalizes the block decided in the given round. The node that created
+// the block hands it back to its miner, as the block is tied to that miner's
+// pending sealing task. Every other validator holds the block and the commit
+// too, so it imports and relays the sealed block itself rather than relying on
+// the proposer being alive.
+func (c *core) commit(round uint64, hash common.Hash, block *types.Block) {
+	c.decided, c.step = true, stepCommit
+
+	rs := c.roundState(round)
+	seals := make([][]byte, 0, len(rs.seals))
+	for _, addr := range c.bft.validators {
+		if vote, ok := rs.precommits[addr]; ok && vote == hash {
+			seals = append(seals, rs.seals[addr])
+		}
+	}
+	sealed, err := withCommit(block, round, seals)
+	if err != nil {
+		log.Error("Failed to assemble commit", "err", err)
+		return
+	}
+	log.Info("BFT block decided", "number", c.height, "round", round, "sealhash", hash, "seals", len(seals))
+
+	if task := c.tasks[hash]; task != nil {
+		select {
+		case task.results <- sealed:
+			return
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", hash)
+		}
+	}
+	if importFn := c.bft.importer(); importFn != nil {
+		go importFn(sealed)
+	}
+}
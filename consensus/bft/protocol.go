@@ -0,0 +1,242 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// ProtocolName is the official short name of the `bft` protocol used during
+	// devp2p capability negotiation.
+	ProtocolName = "bft"
+
+	// ProtocolVersion is the only supported version of the `bft` protocol.
+	ProtocolVersion = 1
+
+	// protocolLength is the number of implemented messages.
+	protocolLength = 1
+
+	// maxMessageSize is the maximum cap on the size of a protocol message.
+	maxMessageSize = 10 * 1024 * 1024
+
+	// maxQueuedMessages is the maximum number of messages queued for a single
+	// peer before new ones are dropped.
+	maxQueuedMessages = 1024
+)
+
+// ConsensusMsg is the single message code of the `bft` protocol, carrying any
+// of the signed consensus messages.
+const ConsensusMsg = 0x00
+
+// Consensus message types exchanged between the validators.
+const (
+	msgProposal = iota
+	msgPrevote
+	msgPrecommit
+)
+
+var (
+	errMsgTooLarge   = errors.New("message too long")
+	errInvalidMsg    = errors.New("invalid consensus message")
+	errInvalidMsgSig = errors.New("invalid consensus message signature")
+)
+
+// message is a signed consensus message. Proposals carry the proposed block,
+// votes only the seal hash of the block voted for (zero hash for nil votes).
+type message struct {
+	Code      uint64
+	Height    uint64
+	Round     uint64
+	Hash      common.Hash
+	Block     []byte // RLP encoded block of proposals, empty for votes
+	Signature []byte
+
+	sender common.Address // Recovered signer of the message
+	block  *types.Block   // Decoded block of proposals
+	blob   []byte         // Original encoding to relay the message as is
+}
+
+// payload returns the data the sender signed.
+func (m *message) payload() []byte {
+	return votePayload(m.Code, m.Height, m.Round, m.Hash)
+}
+
+// votePayload assembles the signed data of a consensus message.
+func votePayload(code, height, round uint64, hash common.Hash) []byte {
+	blob, _ := rlp.EncodeToBytes([]interface{}{code, height, round, hash})
+	return blob
+}
+
+// recoverSigner retrieves the address that signed the given payload.
+func recoverSigner(payload []byte, sig []byte) (common.Address, error) {
+	pubkey, err := crypto.Ecrecover(crypto.Keccak256(payload), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+	return signer, nil
+}
+
+// decodeMessage decodes a consensus message and authenticates its sender.
+func decodeMessage(blob []byte) (*message, error) {
+	msg := &message{blob: blob}
+	if err := rlp.DecodeBytes(blob, msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidMsg, err)
+	}
+	if msg.Code > msgPrecommit {
+		return nil, fmt.Errorf("%w: unknown type %d", errInvalidMsg, msg.Code)
+	}
+	sender, err := recoverSigner(msg.payload(), msg.Signature)
+	if err != nil {
+		return nil, errInvalidMsgSig
+	}
+	msg.sender = sender
+
+	if msg.Code == msgProposal {
+		block := new(types.Block)
+		if err := rlp.DecodeBytes(msg.Block, block); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidMsg, err)
+		}
+		if SealHash(block.Header()) != msg.Hash || block.NumberU64() != msg.Height {
+			return nil, fmt.Errorf("%w: proposal mismatch", errInvalidMsg)
+		}
+		msg.block = block
+	}
+	return msg, nil
+}
+
+// peer is a remote node connected on the `bft` protocol.
+type peer struct {
+	id    enode.ID
+	rw    p2p.MsgReadWriter
+	queue chan []byte
+	term  chan struct{}
+}
+
+// peerSet tracks the peers connected on the `bft` protocol.
+type peerSet struct {
+	peers map[enode.ID]*peer
+	lock  sync.RWMutex
+}
+
+func newPeerSet() *peerSet {
+	return &peerSet{peers: make(map[enode.ID]*peer)}
+}
+
+// broadcast queues the encoded message for all peers except the origin.
+func (ps *peerSet) broadcast(blob []byte, origin enode.ID) {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	for id, p := range ps.peers {
+		if id == origin {
+			continue
+		}
+		select {
+		case p.queue <- blob:
+		default:
+			log.Debug("Dropping consensus message to slow peer", "peer", id)
+		}
+	}
+}
+
+// Protocols returns the `bft` sub-protocol the validators exchange their
+// proposals and votes on. It needs to be registered on the p2p stack next to
+// the `eth` protocol.
+func (b *BFT) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    ProtocolName,
+		Version: ProtocolVersion,
+		Length:  protocolLength,
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			return b.runPeer(p, rw)
+		},
+		NodeInfo: func() interface{} {
+			return b.core.status()
+		},
+	}}
+}
+
+// runPeer registers a peer and keeps processing its messages until the
+// connection is torn down.
+func (b *BFT) runPeer(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	peer := &peer{
+		id:    p.ID(),
+		rw:    rw,
+		queue: make(chan []byte, maxQueuedMessages),
+		term:  make(chan struct{}),
+	}
+	b.peers.lock.Lock()
+	b.peers.peers[peer.id] = peer
+	b.peers.lock.Unlock()
+
+	defer func() {
+		b.peers.lock.Lock()
+		delete(b.peers.peers, peer.id)
+		b.peers.lock.Unlock()
+		close(peer.term)
+	}()
+	go func() {
+		for {
+			select {
+			case blob := <-peer.queue:
+				if err := p2p.Send(rw, ConsensusMsg, rlp.RawValue(blob)); err != nil {
+					return
+				}
+			case <-peer.term:
+				return
+			}
+		}
+	}()
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > maxMessageSize {
+			return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
+		}
+		var blob rlp.RawValue
+		err = msg.Decode(&blob)
+		msg.Discard()
+		if err != nil {
+			return err
+		}
+		packet, err := decodeMessage(blob)
+		if err != nil {
+			return err
+		}
+		// Consensus messages go through the same emulated link as eth ones
+		emu.Transmit(p.ID(), p.LocalID(), uint64(msg.Size), packet.Code == msgProposal)
+		emu.WaitResumed(p.LocalID(), p.Closed())
+
+		b.core.deliver(packet, peer.id)
+	}
+}
@@ -19,10 +19,12 @@ package consensus
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -49,6 +51,21 @@ type ChainHeaderReader interface {
 	GetTd(hash common.Hash, number uint64) *big.Int
 }
 
+// Clocked is implemented by chains running on the clock of an emulated node.
+type Clocked interface {
+	// Clock retrieves the clock of the node, nil for the host clock.
+	Clock() *emu.Clock
+}
+
+// Now returns the current time on the clock of the node running the chain, the
+// host time unless the chain has a clock of its own.
+func Now(chain ChainHeaderReader) time.Time {
+	if clocked, ok := chain.(Clocked); ok {
+		return clocked.Clock().Now()
+	}
+	return time.Now()
+}
+
 // ChainReader defines a small collection of methods needed to access the local
 // blockchain during header and/or uncle verification.
 type ChainReader interface {
@@ -128,3 +145,13 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// AutoSealer is a consensus engine that decides on its own when sealing work
+// is done, rather than sealing only when the miner is explicitly told to work.
+type AutoSealer interface {
+	Engine
+
+	// AutoSeal returns whether every new sealing task should be handed to the
+	// engine as soon as it is available.
+	AutoSeal() bool
+}
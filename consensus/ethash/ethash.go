@@ -18,30 +18,104 @@
 package ethash
 
 import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// Config are the configuration parameters of the ethash.
+type Config struct {
+	// Hashrate is the simulated number of hashes per second this miner
+	// contributes. Zero disables the simulation and seals blocks instantly
+	// whenever the miner is explicitly asked to work.
+	Hashrate float64
+}
+
 // Ethash is a consensus engine based on proof-of-work implementing the ethash
-// algorithm.
+// algorithm. Instead of actually searching for a nonce, the engine draws the
+// time to find a solution from the distribution a miner with the configured
+// hashrate would experience at the block's difficulty.
 type Ethash struct {
+	config Config
+
+	rand    *rand.Rand    // Properly seeded random source for sealing delays
+	sealing atomic.Int32  // Number of sealing operations currently in progress
+	lock    sync.Mutex    // Ensures thread safety for the config and random source
+	abortCh chan struct{} // Channel to abort in-flight sealers when mining stops
+	closeCh chan struct{} // Channel to notify in-flight sealers to exit
+	closed  atomic.Bool   // Whether the engine has already been closed
 }
 
-// New creates a full sized ethash PoW scheme and starts a background thread for
-// remote mining, also optionally notifying a batch of remote services of new work
-// packages.
-func New() *Ethash {
-	return &Ethash{}
+// New creates a full sized ethash PoW scheme with the given simulated hashrate.
+func New(config Config) *Ethash {
+	return &Ethash{
+		config:  config,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		abortCh: make(chan struct{}),
+		closeCh: make(chan struct{}),
+	}
 }
 
 // Close closes the exit channel to notify all backend threads exiting.
 func (ethash *Ethash) Close() error {
+	if ethash.closed.CompareAndSwap(false, true) {
+		close(ethash.closeCh)
+	}
 	return nil
 }
 
+// Hashrate implements PoW, returning the simulated hashrate of the local miner
+// if it's currently searching for a seal, or zero otherwise.
+func (ethash *Ethash) Hashrate() float64 {
+	if ethash.sealing.Load() == 0 {
+		return 0
+	}
+	ethash.lock.Lock()
+	defer ethash.lock.Unlock()
+
+	return ethash.config.Hashrate
+}
+
+// SetHashrate changes the simulated hashrate of the local miner. The new rate
+// takes effect from the next sealing operation onwards.
+func (ethash *Ethash) SetHashrate(rate float64) {
+	ethash.lock.Lock()
+	defer ethash.lock.Unlock()
+
+	ethash.config.Hashrate = rate
+}
+
+// SetThreads updates the number of mining threads. The simulated search does
+// not consume any CPU, so the only meaningful setting is a negative one, which
+// aborts all in-flight sealing operations as the local miner is stopped.
+func (ethash *Ethash) SetThreads(threads int) {
+	if threads >= 0 {
+		return
+	}
+	ethash.lock.Lock()
+	defer ethash.lock.Unlock()
+
+	close(ethash.abortCh)
+	ethash.abortCh = make(chan struct{})
+}
+
+// AutoSeal implements consensus.AutoSealer, reporting whether the engine
+// searches for seals on its own as soon as a sealing task is available.
+func (ethash *Ethash) AutoSeal() bool {
+	ethash.lock.Lock()
+	defer ethash.lock.Unlock()
+
+	return ethash.config.Hashrate > 0
+}
+
 // APIs implements consensus.Engine, returning the user facing RPC APIs.
 func (ethash *Ethash) APIs(chain consensus.ChainHeaderReader) []rpc.API {
-	// In order to ensure backward compatibility, we exposes ethash RPC APIs
-	// to both eth and ethash namespaces.
-	return []rpc.API{}
+	return []rpc.API{{
+		Namespace: "ethash",
+		Service:   &API{ethash},
+	}}
 }
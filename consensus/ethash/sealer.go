@@ -17,13 +17,75 @@
 package ethash
 
 import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
 )
 
 // Seal implements consensus.Engine, attempting to find a nonce that satisfies
 // the block's difficulty requirements.
 func (ethash *Ethash) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
-	results <- block
+	ethash.lock.Lock()
+	rate, abort := ethash.config.Hashrate, ethash.abortCh
+	ethash.lock.Unlock()
+
+	// Without any simulated hashpower, seal the block right away
+	if rate <= 0 {
+		results <- block
+		return nil
+	}
+	delay := ethash.sealDelay(block.Difficulty(), rate)
+
+	ethash.sealing.Add(1)
+	go func() {
+		defer ethash.sealing.Add(-1)
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-stop:
+			// Sealing aborted, the search restarts on the next task
+			return
+		case <-abort:
+			return
+		case <-ethash.closeCh:
+			return
+		case <-timer.C:
+		}
+		ethash.lock.Lock()
+		var (
+			header = block.Header()
+			nonce  = ethash.rand.Uint64()
+			digest common.Hash
+		)
+		ethash.rand.Read(digest[:])
+		ethash.lock.Unlock()
+
+		header.Nonce = types.EncodeNonce(nonce)
+		header.MixDigest = digest
+
+		select {
+		case results <- block.WithSeal(header):
+		default:
+			log.Warn("Sealing result is not read by miner", "mode", "simulated", "sealhash", ethash.SealHash(block.Header()))
+		}
+	}()
 	return nil
 }
+
+// sealDelay draws the time a miner with the given hashrate needs to find a
+// valid nonce for the given difficulty. Nonce search is a Poisson process, so
+// the waiting time is exponentially distributed with mean difficulty/hashrate.
+func (ethash *Ethash) sealDelay(difficulty *big.Int, rate float64) time.Duration {
+	ethash.lock.Lock()
+	sample := ethash.rand.ExpFloat64()
+	ethash.lock.Unlock()
+
+	expected, _ := new(big.Float).SetInt(difficulty).Float64()
+	return time.Duration(sample * expected / rate * float64(time.Second))
+}
@@ -40,11 +40,13 @@ import (
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/syncx"
 	"github.com/ethereum/go-ethereum/internal/version"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
@@ -134,9 +136,19 @@ var defaultCacheConfig = &CacheConfig{
 type BlockChain struct {
 	id          int
 	blockLog    *os.File
+	logLabel    string              // Appended to the block log rows, e.g. the propagation policy
+	clock       *emu.Clock          // Clock of the node judging block timestamps
+	cpu         *emu.CPU            // Processing model of the node, nil for host speed
 	chainConfig *params.ChainConfig // Chain & network configuration
 	cacheConfig *CacheConfig        // Cache configuration for pruning
 
+	// Metrics of the chain, reported under the emulated node id
+	headBlockGauge    *metrics.Gauge
+	blockInsertTimer  *metrics.Histogram
+	reorgExecuteMeter *metrics.Counter
+	reorgAddMeter     *metrics.Counter
+	reorgDropMeter    *metrics.Counter
+
 	db            ethdb.Database                   // Low level persistent database to store final content in
 	snaps         *snapshot.Tree                   // Snapshot tree for fast trie leaf access
 	triegc        *prque.Prque[int64, common.Hash] // Priority queue mapping block numbers to tries to gc
@@ -197,7 +209,7 @@ type BlockChain struct {
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialises the default Ethereum Validator
 // and Processor.
-func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis, overrides *ChainOverrides, engine consensus.Engine, vmConfig vm.Config, shouldPreserve func(header *types.Header) bool, txLookupLimit *uint64, id int, blockLog *os.File) (*BlockChain, error) {
+func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis, overrides *ChainOverrides, engine consensus.Engine, vmConfig vm.Config, shouldPreserve func(header *types.Header) bool, txLookupLimit *uint64, id int, blockLog *os.File, logLabel string) (*BlockChain, error) {
 	if cacheConfig == nil {
 		cacheConfig = defaultCacheConfig
 	}
@@ -225,6 +237,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 	bc := &BlockChain{
 		id:            id,
 		blockLog:      blockLog,
+		logLabel:      logLabel,
+		clock:         emu.NodeClock(uint64(id)),
+		cpu:           emu.NodeCPU(uint64(id)),
 		chainConfig:   chainConfig,
 		cacheConfig:   cacheConfig,
 		db:            db,
@@ -249,7 +264,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 	bc.processor = NewStateProcessor(chainConfig, bc, engine)
 
 	var err error
-	bc.hc, err = NewHeaderChain(db, chainConfig, engine, bc.insertStopped)
+	bc.hc, err = NewHeaderChain(db, chainConfig, engine, bc.clock, bc.insertStopped)
 	if err != nil {
 		return nil, err
 	}
@@ -258,6 +273,13 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 		return nil, ErrNoGenesis
 	}
 
+	registry := metrics.Node(id)
+	bc.headBlockGauge = registry.Gauge("chain/head/block")
+	bc.blockInsertTimer = registry.Histogram("chain/inserts", metrics.DefaultBuckets)
+	bc.reorgExecuteMeter = registry.Counter("chain/reorg/executes")
+	bc.reorgAddMeter = registry.Counter("chain/reorg/add")
+	bc.reorgDropMeter = registry.Counter("chain/reorg/drop")
+
 	bc.currentBlock.Store(nil)
 	bc.currentSnapBlock.Store(nil)
 	bc.currentFinalBlock.Store(nil)
@@ -444,6 +466,7 @@ func (bc *BlockChain) loadLastState() error {
 	}
 	// Everything seems to be fine, set as the head block
 	bc.currentBlock.Store(headBlock.Header())
+	bc.headBlockGauge.Update(int64(headBlock.NumberU64()))
 
 	// Restore the last known head header
 	headHeader := headBlock.Header()
@@ -857,6 +880,15 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	bc.currentSnapBlock.Store(block.Header())
 
 	bc.currentBlock.Store(block.Header())
+	bc.headBlockGauge.Update(int64(block.NumberU64()))
+
+	// Reorgs write every block of the new canonical segment through here in
+	// order, so each gets its transactions tracked
+	txs := make([]common.Hash, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		txs[i] = tx.Hash()
+	}
+	emu.RecordHead(uint64(bc.id), block.NumberU64(), txs)
 }
 
 // stopWithoutSaving stops the blockchain service. If any imports are currently in progress
@@ -944,6 +976,24 @@ func (bc *BlockChain) Stop() {
 	log.Info("Blockchain stopped")
 }
 
+// Flush writes the state of the current head block and the collected preimages
+// to disk while the chain keeps running, so that a copy of the database taken
+// afterwards can be opened without reprocessing any blocks.
+func (bc *BlockChain) Flush() error {
+	if !bc.chainmu.TryLock() {
+		return errChainStopped
+	}
+	defer bc.chainmu.Unlock()
+
+	if !bc.cacheConfig.TrieDirtyDisabled {
+		head := bc.CurrentBlock()
+		if err := bc.triedb.Commit(head.Root, false); err != nil {
+			return err
+		}
+	}
+	return bc.stateCache.TrieDB().CommitPreimages()
+}
+
 // StopInsert interrupts all insertion methods, causing them to return
 // errInsertionInterrupted as soon as possible. Insertion is permanently disabled after
 // calling this method.
@@ -1291,7 +1341,7 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	// Make sure no inconsistent state is leaked during insertion
 	externTd := new(big.Int).Add(block.Difficulty(), ptd)
 
-	bc.blockLog.WriteString(fmt.Sprintf("%d,%d,%d\n", time.Now().UnixMilli(), bc.id, block.NumberU64()))
+	bc.blockLog.WriteString(fmt.Sprintf("%d,%d,%d,%s\n", time.Now().UnixMilli(), bc.id, block.NumberU64(), bc.logLabel))
 	// Irrelevant of the canonical status, write the block itself to the database.
 	//
 	// Note all the components of block(td, hash->number map, header, body, receipts)
@@ -1429,7 +1479,7 @@ func (bc *BlockChain) writeBlockAndSetHead(block *types.Block, receipts []*types
 // TODO after the transition, the future block shouldn't be kept. Because
 // it's not checked in the Geth side anymore.
 func (bc *BlockChain) addFutureBlock(block *types.Block) error {
-	max := uint64(time.Now().Unix() + maxTimeFutureBlocks)
+	max := uint64(bc.clock.Now().Unix() + maxTimeFutureBlocks)
 	if block.Time() > max {
 		return fmt.Errorf("future block timestamp %v > allowed %v", block.Time(), max)
 	}
@@ -1476,6 +1526,31 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	return bc.insertChain(chain, true, true)
 }
 
+// VerifyBlock executes a block on top of its parent state and validates the
+// result, without writing anything. Consensus engines use it to check blocks
+// before vouching for them. The execution is charged to the emulated CPU of
+// the node like an import.
+func (bc *BlockChain) VerifyBlock(block *types.Block) error {
+	start := time.Now()
+	if err := bc.validator.ValidateBody(block); err != nil {
+		return err
+	}
+	parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	statedb, err := state.New(parent.Root, bc.stateCache, bc.snaps)
+	if err != nil {
+		return err
+	}
+	receipts, _, usedGas, err := bc.processor.Process(block, statedb, bc.vmConfig)
+	if err != nil {
+		return err
+	}
+	if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
+		return err
+	}
+	bc.cpu.ProcessBlock(block.NumberU64(), usedGas, len(block.Transactions()), time.Since(start))
+	return nil
+}
+
 // insertChain is the internal implementation of InsertChain, which assumes that
 // 1) chains are contiguous, and 2) The chain mutex is held.
 //
@@ -1711,6 +1786,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 		}
 		proctime := time.Since(start) // processing + validation
 
+		// Hold the import back for the processing time of the emulated node
+		bc.cpu.ProcessBlock(block.NumberU64(), usedGas, len(block.Transactions()), proctime)
+
 		// Write the block to the chain and get the status.
 		var (
 			status WriteStatus
@@ -1726,6 +1804,8 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 			return it.index, err
 		}
 
+		bc.blockInsertTimer.UpdateSince(start)
+
 		// Report the import stats before returning the various results
 		stats.processed++
 		stats.usedGas += usedGas
@@ -2058,6 +2138,9 @@ func (bc *BlockChain) reorg(oldHead *types.Header, newHead *types.Block) error {
 		}
 		logFn(msg, "number", commonBlock.Number(), "hash", commonBlock.Hash(),
 			"drop", len(oldChain), "dropfrom", oldChain[0].Hash(), "add", len(newChain), "addfrom", newChain[0].Hash())
+		bc.reorgExecuteMeter.Inc(1)
+		bc.reorgAddMeter.Inc(int64(len(newChain)))
+		bc.reorgDropMeter.Inc(int64(len(oldChain)))
 	} else if len(newChain) > 0 {
 		// Special case happens in the post merge stage that current head is
 		// the ancestor of new head while these two blocks are not consecutive
@@ -2082,9 +2165,13 @@ func (bc *BlockChain) reorg(oldHead *types.Header, newHead *types.Block) error {
 	// Delete useless indexes right now which includes the non-canonical
 	// transaction indexes, canonical chain indexes which above the head.
 	indexesBatch := bc.db.NewBatch()
-	for _, tx := range types.HashDifference(deletedTxs, addedTxs) {
+	excludedTxs := types.HashDifference(deletedTxs, addedTxs)
+	for _, tx := range excludedTxs {
 		rawdb.DeleteTxLookupEntry(indexesBatch, tx)
 	}
+	// Transactions the new head includes again are tracked as included by the
+	// caller writing it afterwards
+	emu.RecordTxsExcluded(uint64(bc.id), excludedTxs)
 
 	// Delete all hash markers that are not part of the new canonical chain.
 	// Because the reorg function does not handle new chain head, all hash
@@ -18,11 +18,15 @@ package rawdb
 
 import (
 	"github.com/ethereum/go-ethereum/ethdb/badger"
+	"os"
 	"path"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/ethdb/overlay"
+	"github.com/ethereum/go-ethereum/ethdb/spill"
 	"github.com/ethereum/go-ethereum/log"
 )
 
@@ -159,6 +163,21 @@ type OpenOptions struct {
 	Cache     int    // the capacity(in megabytes) of the data caching
 	Handles   int    // number of files to be open simultaneously
 	ReadOnly  bool
+
+	// Shared is the directory of a read-only database shared with other nodes
+	// of the process. If set, the database only holds the changes made on top
+	// of the shared one.
+	Shared string
+
+	// Type is the database engine, "memory" to keep the database in memory and
+	// badger if empty.
+	Type string
+
+	// MemoryCap is the size cap (in bytes) of an in-memory database, 0 if it is
+	// unbounded. Writes beyond the cap fail unless Spill is set, in which case
+	// the database moves to a temporary folder on disk next to the datadir.
+	MemoryCap uint64
+	Spill     bool
 }
 
 // openKeyValueDatabase opens a disk-based key-value database, e.g. leveldb or pebble.
@@ -168,7 +187,120 @@ type OpenOptions struct {
 //	db is non-existent |  leveldb default  |  specified type
 //	db is existent     |  from db          |  specified type (if compatible)
 func openKeyValueDatabase(o OpenOptions) (ethdb.Database, error) {
-	return NewBadgerDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	if o.Type == "memory" {
+		return openMemoryDatabase(o), nil
+	}
+	if o.Shared == "" {
+		return NewBadgerDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	}
+	base, err := openSharedStore(o.Shared)
+	if err != nil {
+		return nil, err
+	}
+	top, err := badger.New(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	if err != nil {
+		base.Close()
+		return nil, err
+	}
+	db, err := overlay.New(base, top)
+	if err != nil {
+		top.Close()
+		base.Close()
+		return nil, err
+	}
+	log.Debug("Opened database over shared store", "path", o.Directory, "shared", o.Shared)
+	return NewDatabase(db), nil
+}
+
+// memoryDatabase is an in-memory database, which may have spilled to a temporary
+// folder on disk.
+type memoryDatabase struct {
+	*spill.Database
+	dir string // Folder receiving the spilled content, empty if spilling is disabled
+}
+
+// openMemoryDatabase creates an empty in-memory database.
+func openMemoryDatabase(o OpenOptions) ethdb.Database {
+	db := &memoryDatabase{}
+	var open spill.Opener
+	if o.Spill {
+		db.dir = o.Directory + ".spill"
+		open = func() (ethdb.KeyValueStore, error) {
+			// Leftovers of an earlier run are garbage, the content was never persistent
+			if err := os.RemoveAll(db.dir); err != nil {
+				return nil, err
+			}
+			log.Info("Spilling in-memory database to disk", "path", db.dir)
+			return badger.New(db.dir, o.Cache, o.Handles, o.Namespace, false)
+		}
+	}
+	db.Database = spill.New(o.MemoryCap, open)
+	return NewDatabase(db)
+}
+
+// Close closes the database, deleting its content if it spilled to disk.
+func (db *memoryDatabase) Close() error {
+	err := db.Database.Close()
+	if db.Spilled() {
+		if rmErr := os.RemoveAll(db.dir); err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// sharedStore is a read-only key-value store opened once per process and shared
+// by all databases layered over it.
+type sharedStore struct {
+	ethdb.KeyValueStore
+	path string
+	refs int
+}
+
+var (
+	sharedStores     = make(map[string]*sharedStore)
+	sharedStoresLock sync.Mutex
+)
+
+// sharedRef is a reference to a shared store. Closing it releases the reference,
+// the store itself is closed once the last reference is released.
+type sharedRef struct {
+	*sharedStore
+	once sync.Once
+}
+
+// openSharedStore returns a reference to the shared store at the given path,
+// opening it on first use.
+func openSharedStore(file string) (*sharedRef, error) {
+	sharedStoresLock.Lock()
+	defer sharedStoresLock.Unlock()
+
+	store, ok := sharedStores[file]
+	if !ok {
+		db, err := badger.New(file, 0, 0, "", true)
+		if err != nil {
+			return nil, err
+		}
+		store = &sharedStore{KeyValueStore: db, path: file}
+		sharedStores[file] = store
+	}
+	store.refs++
+	return &sharedRef{sharedStore: store}, nil
+}
+
+// Close releases the reference to the shared store.
+func (ref *sharedRef) Close() error {
+	var err error
+	ref.once.Do(func() {
+		sharedStoresLock.Lock()
+		defer sharedStoresLock.Unlock()
+
+		if ref.refs--; ref.refs == 0 {
+			delete(sharedStores, ref.path)
+			err = ref.KeyValueStore.Close()
+		}
+	})
+	return err
 }
 
 // Open opens both a disk-based key-value database such as leveldb or pebble, but also
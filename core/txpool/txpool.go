@@ -17,6 +17,7 @@
 package txpool
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
@@ -33,8 +34,10 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -204,6 +207,8 @@ func (config *Config) sanitize() Config {
 type TxPool struct {
 	id          int
 	txLog       *os.File
+	clock       *emu.Clock    // Clock of the node timing out queued transactions
+	txEvents    *emu.TxEvents // Lifecycle events collected under the lock, recorded after
 	config      Config
 	chainconfig *params.ChainConfig
 	chain       blockChain
@@ -242,6 +247,14 @@ type TxPool struct {
 	initDoneCh      chan struct{}  // is closed once the pool is initialized (for tests)
 
 	changesSinceReorg int // A counter for how many drops we've performed in-between reorg.
+
+	// Metrics of the pool, reported under the emulated node id
+	pendingGauge       *metrics.Gauge
+	queuedGauge        *metrics.Gauge
+	knownTxMeter       *metrics.Counter
+	validTxMeter       *metrics.Counter
+	invalidTxMeter     *metrics.Counter
+	underpricedTxMeter *metrics.Counter
 }
 
 type txpoolResetRequest struct {
@@ -258,6 +271,8 @@ func NewTxPool(config Config, chainconfig *params.ChainConfig, chain blockChain,
 	pool := &TxPool{
 		id:              id,
 		txLog:           txLog,
+		clock:           emu.NodeClock(uint64(id)),
+		txEvents:        emu.NewTxEvents(uint64(id)),
 		config:          config,
 		chainconfig:     chainconfig,
 		chain:           chain,
@@ -275,6 +290,14 @@ func NewTxPool(config Config, chainconfig *params.ChainConfig, chain blockChain,
 		initDoneCh:      make(chan struct{}),
 		gasPrice:        new(big.Int).SetUint64(config.PriceLimit),
 	}
+	registry := metrics.Node(id)
+	pool.pendingGauge = registry.Gauge("txpool/pending")
+	pool.queuedGauge = registry.Gauge("txpool/queued")
+	pool.knownTxMeter = registry.Counter("txpool/known")
+	pool.validTxMeter = registry.Counter("txpool/valid")
+	pool.invalidTxMeter = registry.Counter("txpool/invalid")
+	pool.underpricedTxMeter = registry.Counter("txpool/underpriced")
+
 	pool.locals = newAccountSet(pool.signer)
 	for _, addr := range config.Locals {
 		log.Info("Setting new local account", "address", addr)
@@ -363,14 +386,16 @@ func (pool *TxPool) loop() {
 					continue
 				}
 				// Any non-locals old enough should be removed
-				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
+				if pool.clock.Since(pool.beats[addr]) > pool.config.Lifetime {
 					list := pool.queue[addr].Flatten()
 					for _, tx := range list {
 						pool.removeTx(tx.Hash(), true)
+						pool.txEvents.Drop(tx.Hash(), emu.DropExpired)
 					}
 				}
 			}
 			pool.mu.Unlock()
+			pool.txEvents.Flush()
 
 		// Handle local transaction journal rotation
 		case <-journal.C:
@@ -417,6 +442,7 @@ func (pool *TxPool) GasPrice() *big.Int {
 // SetGasPrice updates the minimum price required by the transaction pool for a
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
+	defer pool.txEvents.Flush()
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
@@ -428,6 +454,7 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 		drop := pool.all.RemotesBelowTip(price)
 		for _, tx := range drop {
 			pool.removeTx(tx.Hash(), false)
+			pool.txEvents.Drop(tx.Hash(), emu.DropUnderpriced)
 		}
 		pool.priced.Removed(len(drop))
 	}
@@ -660,6 +687,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	hash := tx.Hash()
 	if pool.all.Get(hash) != nil {
 		log.Trace("Discarding already known transaction", "hash", hash)
+		pool.knownTxMeter.Inc(1)
 		return false, ErrAlreadyKnown
 	}
 	// Make the local flag. If it's from local source or it's from the network but
@@ -669,8 +697,10 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	// If the transaction fails basic validation, discard it
 	if err := pool.validateTx(tx); err != nil {
 		log.Trace("Discarding invalid transaction", "hash", hash, "err", err)
+		pool.invalidTxMeter.Inc(1)
 		return false, err
 	}
+	pool.validTxMeter.Inc(1)
 
 	// already validated by this point
 	from, _ := types.Sender(pool.signer, tx)
@@ -680,6 +710,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		// If the new transaction is underpriced, don't accept it
 		if !isLocal && pool.priced.Underpriced(tx) {
 			log.Trace("Discarding underpriced transaction", "hash", hash, "gasTipCap", tx.GasTipCap(), "gasFeeCap", tx.GasFeeCap())
+			pool.underpricedTxMeter.Inc(1)
 			return false, ErrUnderpriced
 		}
 
@@ -727,6 +758,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "gasTipCap", tx.GasTipCap(), "gasFeeCap", tx.GasFeeCap())
 			dropped := pool.removeTx(tx.Hash(), false)
 			pool.changesSinceReorg += dropped
+			pool.txEvents.Drop(tx.Hash(), emu.DropUnderpriced)
 		}
 	}
 
@@ -741,15 +773,17 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		if old != nil {
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
+			pool.txEvents.Drop(old.Hash(), emu.DropReplaced)
 		}
 		pool.all.Add(tx, isLocal)
+		pool.txEvents.Pending(hash)
 		pool.priced.Put(tx, isLocal)
 		pool.journalTx(from, tx)
 		pool.queueTxEvent(tx)
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
 
 		// Successful promotion, bump the heartbeat
-		pool.beats[from] = time.Now()
+		pool.beats[from] = pool.clock.Now()
 		return old != nil, nil
 	}
 	// New transaction isn't replacing a pending one, push into queue
@@ -809,7 +843,9 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 	if old != nil {
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
+		pool.txEvents.Drop(old.Hash(), emu.DropReplaced)
 	}
+	pool.txEvents.Queued(hash)
 	// If the transaction isn't in lookup set but it's expected to be there,
 	// show the error log.
 	if pool.all.Get(hash) == nil && !addAll {
@@ -821,7 +857,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 	}
 	// If we never record the heartbeat, do it right now.
 	if _, exist := pool.beats[from]; !exist {
-		pool.beats[from] = time.Now()
+		pool.beats[from] = pool.clock.Now()
 	}
 	return old != nil, nil
 }
@@ -854,18 +890,21 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		// An older transaction was better, discard this
 		pool.all.Remove(hash)
 		pool.priced.Removed(1)
+		pool.txEvents.Drop(hash, emu.DropReplaced)
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
 	if old != nil {
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
+		pool.txEvents.Drop(old.Hash(), emu.DropReplaced)
 	}
+	pool.txEvents.Pending(hash)
 	// Set the potentially new pending nonce and notify any subsystems of the new tx
 	pool.pendingNonces.set(addr, tx.Nonce()+1)
 
 	// Successful promotion, bump the heartbeat
-	pool.beats[addr] = time.Now()
+	pool.beats[addr] = pool.clock.Now()
 	return true
 }
 
@@ -918,6 +957,10 @@ func (pool *TxPool) AddRemote(tx *types.Transaction) error {
 func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	for _, tx := range txs {
 		pool.txLog.WriteString(fmt.Sprintf("%d,%d,%d\n", time.Now().UnixMilli(), pool.id, tx.Value().Uint64()))
+		if local {
+			emu.RecordTxSubmit(uint64(pool.id), tx.Hash())
+		}
+		emu.RecordTxSeen(uint64(pool.id), tx.Hash())
 	}
 	// Filter out known ones without obtaining the pool lock or recovering signatures
 	var (
@@ -949,6 +992,7 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	pool.mu.Lock()
 	newErrs, dirtyAddrs := pool.addTxsLocked(news, local)
 	pool.mu.Unlock()
+	pool.txEvents.Flush()
 
 	var nilSlot = 0
 	for _, err := range newErrs {
@@ -1009,6 +1053,12 @@ func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
 	return pool.all.Get(hash)
 }
 
+// GetShort returns a transaction whose hash starts with the given compact block
+// short ID if it is contained in the pool, or nil otherwise.
+func (pool *TxPool) GetShort(id uint64) *types.Transaction {
+	return pool.all.GetShort(id)
+}
+
 // Has returns an indicator whether txpool has a transaction cached with the
 // given hash.
 func (pool *TxPool) Has(hash common.Hash) bool {
@@ -1216,6 +1266,7 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 
 	pool.changesSinceReorg = 0 // Reset change counter
 	pool.mu.Unlock()
+	pool.txEvents.Flush()
 
 	// Notify subsystems for newly added transactions
 	for _, tx := range promoted {
@@ -1344,6 +1395,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range forwards {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txEvents.Drop(hash, emu.DropStale)
 		}
 		log.Trace("Removed old queued transactions", "count", len(forwards))
 		// Drop all transactions that are too costly (low balance or out of gas)
@@ -1351,6 +1403,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range drops {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txEvents.Drop(hash, emu.DropUnpayable)
 		}
 		log.Trace("Removed unpayable queued transactions", "count", len(drops))
 
@@ -1371,6 +1424,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			for _, tx := range caps {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
+				pool.txEvents.Drop(hash, emu.DropOverflow)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 		}
@@ -1393,6 +1447,7 @@ func (pool *TxPool) truncatePending() {
 	for _, list := range pool.pending {
 		pending += uint64(list.Len())
 	}
+	pool.pendingGauge.Update(int64(pending))
 	if pending <= pool.config.GlobalSlots {
 		return
 	}
@@ -1427,6 +1482,7 @@ func (pool *TxPool) truncatePending() {
 						// Drop the transaction from the global pools too
 						hash := tx.Hash()
 						pool.all.Remove(hash)
+						pool.txEvents.Drop(hash, emu.DropOverflow)
 
 						// Update the account nonce to the dropped transaction
 						pool.pendingNonces.setIfLower(offenders[i], tx.Nonce())
@@ -1450,6 +1506,7 @@ func (pool *TxPool) truncatePending() {
 					// Drop the transaction from the global pools too
 					hash := tx.Hash()
 					pool.all.Remove(hash)
+					pool.txEvents.Drop(hash, emu.DropOverflow)
 
 					// Update the account nonce to the dropped transaction
 					pool.pendingNonces.setIfLower(addr, tx.Nonce())
@@ -1468,6 +1525,7 @@ func (pool *TxPool) truncateQueue() {
 	for _, list := range pool.queue {
 		queued += uint64(list.Len())
 	}
+	pool.queuedGauge.Update(int64(queued))
 	if queued <= pool.config.GlobalQueue {
 		return
 	}
@@ -1492,6 +1550,7 @@ func (pool *TxPool) truncateQueue() {
 		if size := uint64(list.Len()); size <= drop {
 			for _, tx := range list.Flatten() {
 				pool.removeTx(tx.Hash(), true)
+				pool.txEvents.Drop(tx.Hash(), emu.DropOverflow)
 			}
 			drop -= size
 			continue
@@ -1500,6 +1559,7 @@ func (pool *TxPool) truncateQueue() {
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
 			pool.removeTx(txs[i].Hash(), true)
+			pool.txEvents.Drop(txs[i].Hash(), emu.DropOverflow)
 			drop--
 		}
 	}
@@ -1522,6 +1582,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		for _, tx := range olds {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txEvents.Drop(hash, emu.DropStale)
 			log.Trace("Removed old pending transaction", "hash", hash)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
@@ -1530,6 +1591,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
 			pool.all.Remove(hash)
+			pool.txEvents.Drop(hash, emu.DropUnpayable)
 		}
 
 		for _, tx := range invalids {
@@ -1656,6 +1718,7 @@ type lookup struct {
 	lock    sync.RWMutex
 	locals  map[common.Hash]*types.Transaction
 	remotes map[common.Hash]*types.Transaction
+	shorts  map[uint64]*types.Transaction // Transactions by the first eight bytes of their hash
 }
 
 // newLookup returns a new lookup structure.
@@ -1663,9 +1726,15 @@ func newLookup() *lookup {
 	return &lookup{
 		locals:  make(map[common.Hash]*types.Transaction),
 		remotes: make(map[common.Hash]*types.Transaction),
+		shorts:  make(map[uint64]*types.Transaction),
 	}
 }
 
+// shortID returns the short ID compact blocks refer to a transaction by.
+func shortID(hash common.Hash) uint64 {
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
 // Range calls f on each key and value present in the map. The callback passed
 // should return the indicator whether the iteration needs to be continued.
 // Callers need to specify which set (or both) to be iterated.
@@ -1700,6 +1769,15 @@ func (t *lookup) Get(hash common.Hash) *types.Transaction {
 	return t.remotes[hash]
 }
 
+// GetShort returns a transaction whose hash starts with the given short ID, or
+// nil if not found.
+func (t *lookup) GetShort(id uint64) *types.Transaction {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.shorts[id]
+}
+
 // GetLocal returns a transaction if it exists in the lookup, or nil if not found.
 func (t *lookup) GetLocal(hash common.Hash) *types.Transaction {
 	t.lock.RLock()
@@ -1760,6 +1838,7 @@ func (t *lookup) Add(tx *types.Transaction, local bool) {
 	} else {
 		t.remotes[tx.Hash()] = tx
 	}
+	t.shorts[shortID(tx.Hash())] = tx
 }
 
 // Remove removes a transaction from the lookup.
@@ -1779,6 +1858,9 @@ func (t *lookup) Remove(hash common.Hash) {
 
 	delete(t.locals, hash)
 	delete(t.remotes, hash)
+	if short := shortID(hash); t.shorts[short] == tx {
+		delete(t.shorts, short)
+	}
 }
 
 // RemoteToLocals migrates the transactions belongs to the given locals to locals
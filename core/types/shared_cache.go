@@ -0,0 +1,128 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// sharedCaches holds recovered senders and decoded objects keyed by their hash,
+// shared by every chain living in the same process. Decoded transaction contents
+// are immutable, so the same content may back many wrappers. Headers are not, so
+// every chain gets its own deep copy.
+type sharedCaches struct {
+	senders *lru.Cache[common.Hash, sigCache] // Recovered senders by transaction hash
+	txs     *lru.Cache[common.Hash, TxData]   // Decoded transaction contents by hash
+	headers *lru.Cache[common.Hash, *Header]  // Decoded headers by hash
+}
+
+// shared is the process-wide cache, nil unless enabled.
+var shared atomic.Pointer[sharedCaches]
+
+// EnableSharedCaches enables a process-wide cache of recovered transaction
+// senders as well as decoded transactions and headers, each holding up to the
+// given number of entries. It is meant for running many nodes of the same
+// network in one process, which would otherwise recover and decode the same
+// objects once per node. A non-positive size disables the cache.
+func EnableSharedCaches(size int) {
+	if size <= 0 {
+		shared.Store(nil)
+		return
+	}
+	shared.Store(&sharedCaches{
+		senders: lru.NewCache[common.Hash, sigCache](size),
+		txs:     lru.NewCache[common.Hash, TxData](size),
+		headers: lru.NewCache[common.Hash, *Header](size),
+	})
+}
+
+// sharedSender looks up the sender of a transaction recovered by any chain in
+// the process with the same signer.
+func sharedSender(signer Signer, tx *Transaction) (common.Address, bool) {
+	caches := shared.Load()
+	if caches == nil {
+		return common.Address{}, false
+	}
+	sc, ok := caches.senders.Get(tx.Hash())
+	if !ok || !sc.signer.Equal(signer) {
+		return common.Address{}, false
+	}
+	return sc.from, true
+}
+
+// cacheSender shares the recovered sender of a transaction process-wide.
+func cacheSender(signer Signer, tx *Transaction, from common.Address) {
+	if caches := shared.Load(); caches != nil {
+		caches.senders.Add(tx.Hash(), sigCache{signer: signer, from: from})
+	}
+}
+
+// decodeShared fills the transaction from its canonical encoding, reusing the
+// contents decoded earlier anywhere in the process.
+func (tx *Transaction) decodeShared(caches *sharedCaches, b []byte, legacy bool) error {
+	hash := crypto.Keccak256Hash(b)
+	inner, ok := caches.txs.Get(hash)
+	if !ok {
+		if legacy {
+			var data LegacyTx
+			if err := rlp.DecodeBytes(b, &data); err != nil {
+				return err
+			}
+			inner = &data
+		} else {
+			var err error
+			if inner, err = tx.decodeTyped(b); err != nil {
+				return err
+			}
+		}
+		caches.txs.Add(hash, inner)
+	}
+	tx.setDecoded(inner, uint64(len(b)))
+	tx.hash.Store(hash)
+	return nil
+}
+
+// rlpHeader is the RLP view of a header, decoded without the shared cache.
+type rlpHeader Header
+
+// DecodeRLP decodes a header, reusing a header decoded earlier anywhere in the
+// process if the shared cache is enabled.
+func (h *Header) DecodeRLP(s *rlp.Stream) error {
+	caches := shared.Load()
+	if caches == nil {
+		return s.Decode((*rlpHeader)(h))
+	}
+	b, err := s.Raw()
+	if err != nil {
+		return err
+	}
+	hash := crypto.Keccak256Hash(b)
+	if cached, ok := caches.headers.Get(hash); ok {
+		*h = *CopyHeader(cached)
+		return nil
+	}
+	if err := rlp.DecodeBytes(b, (*rlpHeader)(h)); err != nil {
+		return err
+	}
+	caches.headers.Add(hash, CopyHeader(h))
+	return nil
+}
@@ -136,6 +136,13 @@ func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
 		return err
 	case kind == rlp.List:
 		// It's a legacy transaction.
+		if caches := shared.Load(); caches != nil {
+			b, err := s.Raw()
+			if err != nil {
+				return err
+			}
+			return tx.decodeShared(caches, b, true)
+		}
 		var inner LegacyTx
 		err := s.Decode(&inner)
 		if err == nil {
@@ -148,6 +155,9 @@ func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
 		if b, err = s.Bytes(); err != nil {
 			return err
 		}
+		if caches := shared.Load(); caches != nil {
+			return tx.decodeShared(caches, b, false)
+		}
 		inner, err := tx.decodeTyped(b)
 		if err == nil {
 			tx.setDecoded(inner, uint64(len(b)))
@@ -159,6 +169,9 @@ func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
 // UnmarshalBinary decodes the canonical encoding of transactions.
 // It supports legacy RLP transactions and EIP2718 typed transactions.
 func (tx *Transaction) UnmarshalBinary(b []byte) error {
+	if caches := shared.Load(); caches != nil && len(b) > 0 {
+		return tx.decodeShared(caches, b, b[0] > 0x7f)
+	}
 	if len(b) > 0 && b[0] > 0x7f {
 		// It's a legacy transaction.
 		var data LegacyTx
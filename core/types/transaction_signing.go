@@ -138,12 +138,17 @@ func Sender(signer Signer, tx *Transaction) (common.Address, error) {
 			return sigCache.from, nil
 		}
 	}
-
+	// Reuse the sender if another chain in the process recovered it already
+	if addr, ok := sharedSender(signer, tx); ok {
+		tx.from.Store(sigCache{signer: signer, from: addr})
+		return addr, nil
+	}
 	addr, err := signer.Sender(tx)
 	if err != nil {
 		return common.Address{}, err
 	}
 	tx.from.Store(sigCache{signer: signer, from: addr})
+	cacheSender(signer, tx, addr)
 	return addr, nil
 }
 
@@ -0,0 +1,213 @@
+package emu
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// pipe is the upload or download capacity of a node, shared equally by all
+// transfers running through it at the same time (processor sharing).
+type pipe struct {
+	capacity uint64        // Throughput in bytes per millisecond, unlimited if zero
+	active   int           // Number of transfers currently running through the pipe
+	changed  chan struct{} // Closed whenever a transfer joins or leaves
+
+	bytes uint64        // Bytes transferred through the pipe
+	bound uint64        // Bytes transferred while the pipe was the bottleneck
+	busy  time.Duration // Time spent with at least one active transfer
+	since time.Time     // Start of the current busy period
+	peak  int           // Highest number of concurrent transfers
+}
+
+func newPipe(capacity uint64) *pipe {
+	return &pipe{capacity: capacity, changed: make(chan struct{})}
+}
+
+// share returns the rate a transfer gets from the pipe, or zero if the pipe is
+// unlimited.
+func (p *pipe) share() float64 {
+	if p.capacity == 0 {
+		return 0
+	}
+	return float64(p.capacity) / float64(p.active)
+}
+
+func (p *pipe) join(now time.Time) {
+	if p.active == 0 {
+		p.since = now
+	}
+	p.active++
+	if p.active > p.peak {
+		p.peak = p.active
+	}
+	p.notify()
+}
+
+func (p *pipe) leave(now time.Time) {
+	p.active--
+	if p.active == 0 {
+		p.busy += now.Sub(p.since)
+	}
+	p.notify()
+}
+
+// notify wakes up all transfers through the pipe to recompute their rates.
+func (p *pipe) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// capacities holds the upload and download pipes of all nodes, created on first
+// use from the config.
+var capacities = struct {
+	up   map[common.Address]*pipe
+	down map[common.Address]*pipe
+	lock sync.Mutex
+}{
+	up:   make(map[common.Address]*pipe),
+	down: make(map[common.Address]*pipe),
+}
+
+// pipes returns the upload pipe of the sender and the download pipe of the
+// receiver of a transfer. The capacities lock must be held.
+func pipes(from, to common.Address) (*pipe, *pipe) {
+	up, ok := capacities.up[from]
+	if !ok {
+		var capacity uint64
+		if node, ok := Global.Nodes[from]; ok {
+			capacity = node.Upload
+		}
+		up = newPipe(capacity)
+		capacities.up[from] = up
+	}
+	down, ok := capacities.down[to]
+	if !ok {
+		var capacity uint64
+		if node, ok := Global.Nodes[to]; ok {
+			capacity = node.Download
+		}
+		down = newPipe(capacity)
+		capacities.down[to] = down
+	}
+	return up, down
+}
+
+// transfer blocks for the time it takes to move size bytes from one node to
+// another over a link of the given bandwidth. The transfer runs at the lowest
+// of the link bandwidth and the fair shares of the upload capacity of the sender
+// and the download capacity of the receiver, which change as other transfers
+// through these pipes start and end.
+func transfer(from, to common.Address, size uint64, bandwidth uint64) {
+	capacities.lock.Lock()
+	up, down := pipes(from, to)
+	up.bytes += size
+	down.bytes += size
+
+	// Without capacities the link is the only limit, keep its fixed delay
+	if up.capacity == 0 && down.capacity == 0 {
+		capacities.lock.Unlock()
+		time.Sleep(time.Duration(size/bandwidth) * time.Millisecond)
+		return
+	}
+	now := time.Now()
+	up.join(now)
+	down.join(now)
+
+	for remaining := float64(size); remaining > 0; {
+		var (
+			rate  = float64(bandwidth)
+			bound *pipe
+		)
+		if share := up.share(); share > 0 && share < rate {
+			rate, bound = share, up
+		}
+		if share := down.share(); share > 0 && share < rate {
+			rate, bound = share, down
+		}
+		upChanged, downChanged := up.changed, down.changed
+		capacities.lock.Unlock()
+
+		start := time.Now()
+		timer := time.NewTimer(time.Duration(remaining / rate * float64(time.Millisecond)))
+		done := false
+		select {
+		case <-timer.C:
+			done = true
+		case <-upChanged:
+		case <-downChanged:
+		}
+		timer.Stop()
+
+		capacities.lock.Lock()
+		moved := remaining
+		if !done {
+			if sent := rate * float64(time.Since(start)) / float64(time.Millisecond); sent < moved {
+				moved = sent
+			}
+		}
+		remaining -= moved
+		if bound != nil {
+			bound.bound += uint64(moved)
+		}
+	}
+	now = time.Now()
+	up.leave(now)
+	down.leave(now)
+	capacities.lock.Unlock()
+}
+
+// CapacityUsage summarises the transfers through the upload and download
+// capacities of a node.
+type CapacityUsage struct {
+	Upload        uint64        `json:"upload"`        // Upload capacity in bytes per millisecond, zero if unlimited
+	Download      uint64        `json:"download"`      // Download capacity in bytes per millisecond, zero if unlimited
+	Sent          uint64        `json:"sent"`          // Bytes sent to peers
+	Received      uint64        `json:"received"`      // Bytes received from peers
+	UploadBound   uint64        `json:"uploadBound"`   // Bytes sent at the rate limit of the upload capacity
+	DownloadBound uint64        `json:"downloadBound"` // Bytes received at the rate limit of the download capacity
+	UploadBusy    time.Duration `json:"uploadBusy"`    // Time spent uploading
+	DownloadBusy  time.Duration `json:"downloadBusy"`  // Time spent downloading
+	PeakUploads   int           `json:"peakUploads"`   // Highest number of concurrent uploads
+	PeakDownloads int           `json:"peakDownloads"` // Highest number of concurrent downloads
+}
+
+// Bottleneck names the limit most of the traffic of a node ran into: its upload
+// or download capacity, or else the links and capacities of its peers.
+func (u *CapacityUsage) Bottleneck() string {
+	link := u.Sent + u.Received - u.UploadBound - u.DownloadBound
+	switch {
+	case u.UploadBound > u.DownloadBound && u.UploadBound > link:
+		return "upload"
+	case u.DownloadBound > link:
+		return "download"
+	default:
+		return "link"
+	}
+}
+
+// GetCapacityUsage returns the usage of the capacities of a node so far.
+func GetCapacityUsage(addr common.Address) *CapacityUsage {
+	capacities.lock.Lock()
+	defer capacities.lock.Unlock()
+
+	usage := new(CapacityUsage)
+	if node, ok := Global.Nodes[addr]; ok {
+		usage.Upload, usage.Download = node.Upload, node.Download
+	}
+	now := time.Now()
+	if up, ok := capacities.up[addr]; ok {
+		usage.Sent, usage.UploadBound, usage.UploadBusy, usage.PeakUploads = up.bytes, up.bound, up.busy, up.peak
+		if up.active > 0 {
+			usage.UploadBusy += now.Sub(up.since)
+		}
+	}
+	if down, ok := capacities.down[addr]; ok {
+		usage.Received, usage.DownloadBound, usage.DownloadBusy, usage.PeakDownloads = down.bytes, down.bound, down.busy, down.peak
+		if down.active > 0 {
+			usage.DownloadBusy += now.Sub(down.since)
+		}
+	}
+	return usage
+}
@@ -0,0 +1,117 @@
+package emu
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const CHECKPOINT_JSON = "checkpoint.json"
+
+// Checkpoint describes a snapshot of a whole emulated network. It is stored in
+// the checkpoint directory next to a copy of every node's data directory.
+type Checkpoint struct {
+	Time     time.Time              `json:"time"`
+	Clocks   time.Duration          `json:"clocks"` // Time the clocks of the nodes have been drifting for
+	Workload Workload               `json:"workload"`
+	Nodes    []*NodeCheckpoint      `json:"nodes"`
+	Links    []LinkOverride         `json:"links,omitempty"`  // Links deviating from the global defaults
+	Cut      [][2]common.Address    `json:"cut,omitempty"`    // Links removed by partitions
+	Groups   map[common.Address]int `json:"groups,omitempty"` // Partition of the nodes
+}
+
+// Workload is the position of the orchestrator within its workload.
+type Workload struct {
+	TxMode bool    `json:"txMode"`
+	Rate   float64 `json:"rate"`   // Work items generated per second, 0 if unthrottled
+	Cursor uint64  `json:"cursor"` // Transactions sent or blocks requested so far
+	Seed   int64   `json:"seed"`   // Seed of the random source picking senders and sealers
+	Draws  uint64  `json:"draws"`  // Values drawn from the random source so far
+}
+
+// NodeCheckpoint is the state of a single node at the time of a checkpoint.
+type NodeCheckpoint struct {
+	Identity uint64         `json:"identity"`
+	Address  common.Address `json:"address"`
+	Number   hexutil.Uint64 `json:"number"`
+	Head     common.Hash    `json:"head"`
+	Pending  int            `json:"pending"` // Executable transactions in the pool
+	Queued   int            `json:"queued"`  // Non-executable transactions in the pool
+	Paused   bool           `json:"paused"`
+}
+
+// LinkOverride holds the parameters of the direction of a link from node A to
+// node B, set in the config or through the control API.
+type LinkOverride struct {
+	A    common.Address `json:"a"`
+	B    common.Address `json:"b"`
+	Link Link           `json:"link"`
+}
+
+// Links returns all link directions whose parameters override the global
+// defaults.
+func Links() []LinkOverride {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	links := make([]LinkOverride, 0, len(state.links))
+	for key, link := range state.links {
+		links = append(links, LinkOverride{A: key[0], B: key[1], Link: link})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if c := bytes.Compare(links[i].A[:], links[j].A[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(links[i].B[:], links[j].B[:]) < 0
+	})
+	return links
+}
+
+// Partitioned returns the current partition of the network along with the
+// connections it cut.
+func Partitioned() (map[common.Address]int, [][2]common.Address) {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	groups := make(map[common.Address]int, len(state.groups))
+	for addr, group := range state.groups {
+		groups[addr] = group
+	}
+	cut := make([][2]common.Address, 0, len(state.cut))
+	for link := range state.cut {
+		cut = append(cut, link)
+	}
+	sort.Slice(cut, func(i, j int) bool {
+		if c := bytes.Compare(cut[i][0][:], cut[j][0][:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(cut[i][1][:], cut[j][1][:]) < 0
+	})
+	return groups, cut
+}
+
+func LoadCheckpoint(dir string) (*Checkpoint, error) {
+	blob, err := os.ReadFile(path.Join(dir, CHECKPOINT_JSON))
+	if err != nil {
+		return nil, err
+	}
+	cp := new(Checkpoint)
+	if err := json.Unmarshal(blob, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func StoreCheckpoint(dir string, cp *Checkpoint) error {
+	jsonString, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, CHECKPOINT_JSON), jsonString, 0644)
+}
@@ -0,0 +1,60 @@
+package emu
+
+import "time"
+
+// clockEpoch is the instant from which the clocks of all nodes drift away from
+// the host clock. It is the start of the emulation, moved back by the time a
+// resumed emulation already ran.
+var clockEpoch = time.Now()
+
+// ClockElapsed returns the host time the clocks of all nodes have been
+// drifting for.
+func ClockElapsed() time.Duration {
+	return time.Since(clockEpoch)
+}
+
+// ResumeClocks continues the drift of all clocks from the given elapsed time,
+// as stored by a checkpoint. It must be called before any node starts.
+func ResumeClocks(elapsed time.Duration) {
+	clockEpoch = time.Now().Add(-elapsed)
+}
+
+// Clock is the wall clock of an emulated node. It runs ahead of the host clock
+// by a fixed offset, and drifts further away at a constant rate from the start
+// of the emulation. The nil clock is the host clock.
+type Clock struct {
+	offset time.Duration // Time the clock runs ahead of the host, negative if behind
+	drift  float64       // Time the clock gains per unit of host time
+}
+
+// NodeClock returns the clock of the emulated node with the given identity, or
+// nil if the node runs on the host clock.
+func NodeClock(identity uint64) *Clock {
+	for _, node := range Global.Nodes {
+		if node.Identity != identity {
+			continue
+		}
+		if node.ClockOffset == 0 && node.ClockDrift == 0 {
+			return nil
+		}
+		return &Clock{
+			offset: time.Duration(node.ClockOffset) * time.Millisecond,
+			drift:  node.ClockDrift / 1e6,
+		}
+	}
+	return nil
+}
+
+// Now returns the current time on the clock.
+func (c *Clock) Now() time.Time {
+	now := time.Now()
+	if c == nil {
+		return now
+	}
+	return now.Add(c.offset + time.Duration(c.drift*float64(now.Sub(clockEpoch))))
+}
+
+// Since returns the time elapsed on the clock since t.
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
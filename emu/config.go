@@ -8,10 +8,15 @@ import (
 	"path"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 const CONFIG_JSON = "config.json"
 
+// SHARED_DIR is the folder in the data directory holding the databases shared
+// by all nodes.
+const SHARED_DIR = "shared"
+
 var ErrAddrNotFound = errors.New("Address not found!")
 
 type Config struct {
@@ -19,6 +24,24 @@ type Config struct {
 	Latency   uint64
 	Bandwidth uint64
 	BlockSize uint64
+
+	// Loss is the fraction of messages lost and retransmitted on every link
+	Loss float64 `json:",omitempty"`
+
+	// Links override the global link parameters for single directions of the
+	// links between nodes
+	Links []LinkOverride `json:",omitempty"`
+
+	// Consensus is the engine of the emulated chain, ethash if empty
+	Consensus string `json:",omitempty"`
+
+	// Shared marks data directories whose genesis is stored once in SHARED_DIR,
+	// below the databases of all nodes
+	Shared bool `json:",omitempty"`
+
+	// Seed derives the account and p2p keys of all nodes, see keys.go. Networks
+	// generated without one keep the account keys in per-node keystores.
+	Seed hexutil.Bytes `json:",omitempty"`
 }
 
 var Global Config
@@ -38,7 +61,16 @@ func LoadConfig(dataDir string) error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(bytes, &Global)
+	if err := json.Unmarshal(bytes, &Global); err != nil {
+		return err
+	}
+	for _, link := range Global.Links {
+		if err := CheckLink(link.Link); err != nil {
+			return fmt.Errorf("link %v -> %v: %w", link.A, link.B, err)
+		}
+		SetLinkDirection(link.A, link.B, link.Link)
+	}
+	return nil
 }
 
 func StoreConfig(dataDir string) error {
@@ -0,0 +1,157 @@
+package emu
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/bits"
+	mrand "math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	// lookupResults is the number of dial candidates a lookup yields, the size
+	// of a Kademlia bucket.
+	lookupResults = 16
+
+	// minLookupTime bounds the rate of lookups on networks without latency.
+	minLookupTime = 100 * time.Millisecond
+)
+
+// DiscoveryModes lists the peer discovery modes selectable by name.
+var DiscoveryModes = []string{"none", "random", "kademlia"}
+
+// NewDiscovery creates the source of dial candidates of the node with the given
+// address in a discovery mode. Instead of running a discovery protocol, nodes
+// look up the records of all started nodes in an oracle shared by the process:
+//
+//   - none disables discovery, nodes only connect to their static peers.
+//   - random yields random nodes, like a perfectly mixed routing table.
+//   - kademlia yields the nodes closest to random targets by XOR distance, the
+//     result of a discv4 lookup converging on the full network. The nodes are
+//     sorted globally rather than routed through tables, only the duration of
+//     the lookup is modelled. The first lookup targets the node itself.
+//
+// Every lookup takes a round trip of the emulated latency per step towards the
+// target. The result is nil for none.
+func NewDiscovery(mode string, self common.Address) (enode.Iterator, error) {
+	switch mode {
+	case "", "none":
+		return nil, nil
+	case "random":
+		return newOracleIterator(self, randomLookup), nil
+	case "kademlia":
+		return newOracleIterator(self, kademliaLookup()), nil
+	}
+	return nil, fmt.Errorf("unknown discovery mode %q (%s)", mode, strings.Join(DiscoveryModes, ", "))
+}
+
+// lookupFn selects dial candidates for a node out of all started ones, along
+// with the number of round trips the lookup took.
+type lookupFn func(self *enode.Node, nodes []*enode.Node) ([]*enode.Node, int)
+
+// randomLookup picks random nodes in a single round trip.
+func randomLookup(self *enode.Node, nodes []*enode.Node) ([]*enode.Node, int) {
+	mrand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+	if len(nodes) > lookupResults {
+		nodes = nodes[:lookupResults]
+	}
+	return nodes, 1
+}
+
+// kademliaLookup returns a lookup function picking the nodes closest to a
+// random target, starting with the node itself. The lookup takes a round trip
+// per bit of the number of candidates, as iterative lookups halve their
+// distance to the target with every step.
+func kademliaLookup() lookupFn {
+	first := true
+	return func(self *enode.Node, nodes []*enode.Node) ([]*enode.Node, int) {
+		target := self.ID()
+		if !first {
+			rand.Read(target[:])
+		}
+		first = false
+
+		rtts := bits.Len(uint(len(nodes)))
+		sort.Slice(nodes, func(i, j int) bool {
+			return enode.DistCmp(target, nodes[i].ID(), nodes[j].ID()) < 0
+		})
+		if len(nodes) > lookupResults {
+			nodes = nodes[:lookupResults]
+		}
+		return nodes, rtts
+	}
+}
+
+// oracleIterator yields dial candidates from lookups in the registry of started
+// nodes, leaving out paused nodes and those a partition cut off.
+type oracleIterator struct {
+	self   common.Address
+	lookup lookupFn
+	buf    []*enode.Node
+	cur    *enode.Node
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newOracleIterator(self common.Address, lookup lookupFn) *oracleIterator {
+	return &oracleIterator{
+		self:   self,
+		lookup: lookup,
+		closed: make(chan struct{}),
+	}
+}
+
+// Next runs lookups until one yields candidates, waiting for each to complete.
+func (it *oracleIterator) Next() bool {
+	for len(it.buf) == 0 {
+		state.lock.RLock()
+		var (
+			self  = state.nodes[it.self]
+			nodes = make([]*enode.Node, 0, len(state.nodes))
+		)
+		for addr, node := range state.nodes {
+			if _, paused := state.paused[addr]; addr != it.self && !paused && state.reachable(it.self, addr) {
+				nodes = append(nodes, node)
+			}
+		}
+		latency := Global.Latency
+		state.lock.RUnlock()
+
+		var (
+			found []*enode.Node
+			rtts  = 1
+		)
+		if self != nil {
+			found, rtts = it.lookup(self, nodes)
+		}
+		wait := time.Duration(2*latency*uint64(rtts)) * time.Millisecond
+		if wait < minLookupTime {
+			wait = minLookupTime
+		}
+		select {
+		case <-time.After(wait):
+		case <-it.closed:
+			return false
+		}
+		it.buf = found
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Node returns the current dial candidate.
+func (it *oracleIterator) Node() *enode.Node {
+	return it.cur
+}
+
+// Close ends the iteration, interrupting a pending lookup.
+func (it *oracleIterator) Close() {
+	it.closeOnce.Do(func() { close(it.closed) })
+}
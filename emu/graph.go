@@ -0,0 +1,114 @@
+package emu
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PeerGraph returns the static peer graph of the config with its links taken as
+// undirected, mapping every node to the set of its neighbours. Nodes without
+// any peers are included with an empty set.
+func PeerGraph() map[common.Address]map[common.Address]struct{} {
+	adjacent := make(map[common.Address]map[common.Address]struct{}, len(Global.Nodes))
+	for addr := range Global.Nodes {
+		adjacent[addr] = make(map[common.Address]struct{})
+	}
+	for addr, node := range Global.Nodes {
+		for _, peer := range node.Peers {
+			if _, ok := Global.Nodes[peer]; ok && peer != addr {
+				adjacent[addr][peer] = struct{}{}
+				adjacent[peer][addr] = struct{}{}
+			}
+		}
+	}
+	return adjacent
+}
+
+// SortByIdentity sorts the addresses of nodes of the config by their identity.
+func SortByIdentity(addrs []common.Address) {
+	sort.Slice(addrs, func(i, j int) bool {
+		return Global.Nodes[addrs[i]].Identity < Global.Nodes[addrs[j]].Identity
+	})
+}
+
+// GraphMetrics summarises the structure of the static peer graph.
+type GraphMetrics struct {
+	Nodes      int         `json:"nodes"`
+	Edges      int         `json:"edges"`
+	Components int         `json:"components"` // Number of connected components
+	Diameter   int         `json:"diameter"`   // Longest shortest path in hops, within components
+	AvgPath    float64     `json:"avgPath"`    // Mean shortest path in hops between connected pairs
+	Clustering float64     `json:"clustering"` // Mean local clustering coefficient
+	Degrees    map[int]int `json:"degrees"`    // Number of nodes by degree
+}
+
+// PeerGraphMetrics computes the metrics of the static peer graph of the config.
+func PeerGraphMetrics() *GraphMetrics {
+	graph := PeerGraph()
+	metrics := &GraphMetrics{
+		Nodes:   len(graph),
+		Degrees: make(map[int]int),
+	}
+	var (
+		visited   = make(map[common.Address]bool)
+		pathSum   int
+		pathCount int
+	)
+	for addr, peers := range graph {
+		metrics.Edges += len(peers)
+		metrics.Degrees[len(peers)]++
+		metrics.Clustering += clustering(graph, peers)
+
+		if !visited[addr] {
+			metrics.Components++
+		}
+		// Breadth-first search for the shortest paths from this node
+		hops := map[common.Address]int{addr: 0}
+		queue := []common.Address{addr}
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			visited[next] = true
+
+			for peer := range graph[next] {
+				if _, ok := hops[peer]; ok {
+					continue
+				}
+				hops[peer] = hops[next] + 1
+				if hops[peer] > metrics.Diameter {
+					metrics.Diameter = hops[peer]
+				}
+				pathSum += hops[peer]
+				pathCount++
+				queue = append(queue, peer)
+			}
+		}
+	}
+	metrics.Edges /= 2
+	if metrics.Nodes > 0 {
+		metrics.Clustering /= float64(metrics.Nodes)
+	}
+	if pathCount > 0 {
+		metrics.AvgPath = float64(pathSum) / float64(pathCount)
+	}
+	return metrics
+}
+
+// clustering returns the local clustering coefficient of a node with the given
+// neighbours, the fraction of neighbour pairs which are linked themselves.
+func clustering(graph map[common.Address]map[common.Address]struct{}, peers map[common.Address]struct{}) float64 {
+	if len(peers) < 2 {
+		return 0
+	}
+	var links int
+	for a := range peers {
+		for b := range graph[a] {
+			if _, ok := peers[b]; ok {
+				links++
+			}
+		}
+	}
+	// Every link between neighbours was counted from both ends
+	return float64(links) / float64(len(peers)*(len(peers)-1))
+}
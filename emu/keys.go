@@ -0,0 +1,50 @@
+package emu
+
+import (
+	"crypto/ecdsa"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts"
+)
+
+// ErrNoSeed is returned when deriving keys for a network generated with
+// keystores instead of a seed.
+var ErrNoSeed = errors.New("network has no key seed")
+
+// Keys of a network generated from a seed are derived along separate BIP-32
+// branches for the node accounts, the p2p node keys and the workload accounts.
+const (
+	accountBranch  = 0x80000000 + 0
+	nodeKeyBranch  = 0x80000000 + 1
+	workloadBranch = 0x80000000 + 2
+)
+
+// derivationPath returns the path m/44'/60'/branch'/a/b.
+func derivationPath(branch uint32, a, b uint64) accounts.DerivationPath {
+	path := append(accounts.DerivationPath{}, accounts.DefaultRootDerivationPath[:2]...)
+	return append(path, branch, uint32(a), uint32(b))
+}
+
+// AccountKey derives the key of the account of the node with the given id.
+func AccountKey(id uint64) (*ecdsa.PrivateKey, error) {
+	return deriveKey(derivationPath(accountBranch, 0, id))
+}
+
+// NodeKey derives the p2p key of the node with the given id, which keeps the
+// enode of a node stable across regenerations from the same seed.
+func NodeKey(id uint64) (*ecdsa.PrivateKey, error) {
+	return deriveKey(derivationPath(nodeKeyBranch, 0, id))
+}
+
+// WorkloadKey derives the key of a workload account of the node with the given
+// id.
+func WorkloadKey(id uint64, index int) (*ecdsa.PrivateKey, error) {
+	return deriveKey(derivationPath(workloadBranch, id, uint64(index)))
+}
+
+func deriveKey(path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	if len(Global.Seed) == 0 {
+		return nil, ErrNoSeed
+	}
+	return accounts.DeriveKey(Global.Seed, path)
+}
@@ -0,0 +1,316 @@
+package emu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+var ErrNodeNotFound = errors.New("Node not found!")
+
+// Link holds the emulated parameters of one direction of the connection between
+// two nodes. Zero values fall back to the global latency, bandwidth and loss of
+// the config.
+type Link struct {
+	Latency   uint64  `json:"latency"`   // One-way delay in milliseconds
+	Bandwidth uint64  `json:"bandwidth"` // Throughput in bytes per millisecond
+	Loss      float64 `json:"loss"`      // Fraction of messages lost and retransmitted
+}
+
+const (
+	// minRetransmitTimeout is the lower bound of the time a lost message waits
+	// for its retransmission, the minimum TCP retransmission timeout.
+	minRetransmitTimeout = 200 * time.Millisecond
+
+	// maxRetransmits bounds the retransmissions of a single message.
+	maxRetransmits = 8
+)
+
+// network is the mutable state of a running emulation, which the control API
+// changes while the protocol handlers read it.
+type network struct {
+	enodes map[enode.ID]common.Address
+	nodes  map[common.Address]*enode.Node
+	links  map[[2]common.Address]Link // Overrides by sending and receiving node
+	paused map[common.Address]chan struct{}
+	groups map[common.Address]int         // Partition of the nodes, group 0 if missing
+	cut    map[[2]common.Address]struct{} // Connections dropped by partitions
+	lock   sync.RWMutex
+}
+
+var state = &network{
+	enodes: make(map[enode.ID]common.Address),
+	nodes:  make(map[common.Address]*enode.Node),
+	links:  make(map[[2]common.Address]Link),
+	paused: make(map[common.Address]chan struct{}),
+	groups: make(map[common.Address]int),
+	cut:    make(map[[2]common.Address]struct{}),
+}
+
+// RegisterNode maps the p2p identity of a started node to its emulated address
+// and makes its record discoverable.
+func RegisterNode(addr common.Address, node *enode.Node) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.enodes[node.ID()] = addr
+	state.nodes[addr] = node
+}
+
+// NodeAddress returns the emulated address of the node with the given p2p
+// identity.
+func NodeAddress(id enode.ID) (common.Address, bool) {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	addr, ok := state.enodes[id]
+	return addr, ok
+}
+
+// CheckLink validates the parameters of a link.
+func CheckLink(link Link) error {
+	if link.Loss < 0 || link.Loss >= 1 {
+		return fmt.Errorf("link loss %v out of range [0, 1)", link.Loss)
+	}
+	return nil
+}
+
+// SetLink overrides the parameters of both directions of the link between two
+// nodes. A zero link restores the global defaults.
+func SetLink(a, b common.Address, link Link) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.setLink(a, b, link)
+	state.setLink(b, a, link)
+}
+
+// SetLinkDirection overrides the parameters of the direction of the link from
+// one node to another, leaving the opposite direction untouched. A zero link
+// restores the global defaults.
+func SetLinkDirection(from, to common.Address, link Link) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.setLink(from, to, link)
+}
+
+func (n *network) setLink(from, to common.Address, link Link) {
+	if link == (Link{}) {
+		delete(n.links, [2]common.Address{from, to})
+		return
+	}
+	n.links[[2]common.Address{from, to}] = link
+}
+
+// SetDefaultLink changes the global latency, bandwidth and loss of all links
+// without an override. Zero values leave the current setting untouched.
+func SetDefaultLink(link Link) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if link.Latency != 0 {
+		Global.Latency = link.Latency
+	}
+	if link.Bandwidth != 0 {
+		Global.Bandwidth = link.Bandwidth
+	}
+	if link.Loss != 0 {
+		Global.Loss = link.Loss
+	}
+}
+
+// GetLink returns the effective parameters of the direction of the link from
+// one node to another.
+func GetLink(from, to common.Address) Link {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	return state.link(from, to)
+}
+
+func (n *network) link(from, to common.Address) Link {
+	link := n.links[[2]common.Address{from, to}]
+	if link.Latency == 0 {
+		link.Latency = Global.Latency
+	}
+	if link.Bandwidth == 0 {
+		link.Bandwidth = Global.Bandwidth
+	}
+	if link.Loss == 0 {
+		link.Loss = Global.Loss
+	}
+	return link
+}
+
+// Transmit blocks for the time a message of the given size spends on the
+// emulated link from one node to another: the transfer at the bandwidth left by
+// the capacities of both nodes, followed by the latency of the link. Every loss
+// of the message adds a retransmission timeout of twice the round trip time.
+//
+// Blocks are additionally charged the configured block size, which stands for
+// the transactions emulated blocks are too small to carry. Only messages with
+// full blocks pay it. Compact blocks and the transactions fetched to complete
+// them are charged their actual size, on the assumption that receivers already
+// hold all transactions the block size stands for in their pools. Compact relay
+// thus saves the whole block size, an upper bound of its real savings.
+func Transmit(from, to enode.ID, size uint64, block bool) {
+	state.lock.RLock()
+	var (
+		sender   = state.enodes[from]
+		receiver = state.enodes[to]
+		link     = state.link(sender, receiver)
+		rtt      = time.Duration(link.Latency+state.link(receiver, sender).Latency) * time.Millisecond
+	)
+	if block {
+		size += Global.BlockSize
+	}
+	state.lock.RUnlock()
+
+	transfer(sender, receiver, size, link.Bandwidth)
+
+	delay := time.Duration(link.Latency) * time.Millisecond
+	if link.Loss > 0 {
+		timeout := 2 * rtt
+		if timeout < minRetransmitTimeout {
+			timeout = minRetransmitTimeout
+		}
+		for i := 0; i < maxRetransmits && rand.Float64() < link.Loss; i++ {
+			delay += timeout
+		}
+	}
+	time.Sleep(delay)
+}
+
+// Pause freezes the message processing of a node until it is resumed. It
+// returns false if the node was already paused.
+func Pause(addr common.Address) bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if _, ok := state.paused[addr]; ok {
+		return false
+	}
+	state.paused[addr] = make(chan struct{})
+	return true
+}
+
+// Resume lets a paused node continue processing messages. It returns false if
+// the node was not paused.
+func Resume(addr common.Address) bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	resume, ok := state.paused[addr]
+	if !ok {
+		return false
+	}
+	close(resume)
+	delete(state.paused, addr)
+	return true
+}
+
+// Paused reports whether the node is currently paused.
+func Paused(addr common.Address) bool {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	_, ok := state.paused[addr]
+	return ok
+}
+
+// WaitResumed blocks while the node with the given p2p identity is paused, or
+// until the quit channel is closed.
+func WaitResumed(id enode.ID, quit <-chan struct{}) {
+	state.lock.RLock()
+	resume, ok := state.paused[state.enodes[id]]
+	state.lock.RUnlock()
+
+	if ok {
+		select {
+		case <-resume:
+		case <-quit:
+		}
+	}
+}
+
+// linkKey returns the undirected key of the link between two nodes.
+func linkKey(a, b common.Address) [2]common.Address {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return [2]common.Address{a, b}
+}
+
+// Partition splits the network into groups of nodes which cannot connect to
+// each other, replacing any previous partition. Nodes missing from the groups
+// form one more group.
+func Partition(groups map[common.Address]int) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.groups = make(map[common.Address]int, len(groups))
+	for addr, group := range groups {
+		state.groups[addr] = group
+	}
+}
+
+// CutLink records a connection dropped by a partition, keeping its nodes from
+// reconnecting until the network is healed.
+func CutLink(a, b common.Address) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.cut[linkKey(a, b)] = struct{}{}
+}
+
+// Heal lifts the partition of the network, returning the connections it cut.
+func Heal() [][2]common.Address {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	cut := make([][2]common.Address, 0, len(state.cut))
+	for link := range state.cut {
+		cut = append(cut, link)
+	}
+	state.groups = make(map[common.Address]int)
+	state.cut = make(map[[2]common.Address]struct{})
+	return cut
+}
+
+// Reachable reports whether two nodes may connect, being neither in different
+// groups of the partition nor separated by a cut link.
+func Reachable(a, b common.Address) bool {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	return state.reachable(a, b)
+}
+
+func (n *network) reachable(a, b common.Address) bool {
+	if n.groups[a] != n.groups[b] {
+		return false
+	}
+	_, cut := n.cut[linkKey(a, b)]
+	return !cut
+}
+
+// NodeIdentity returns the identity of the emulated node with the given p2p
+// identity.
+func NodeIdentity(id enode.ID) (uint64, bool) {
+	addr, ok := NodeAddress(id)
+	if !ok {
+		return 0, false
+	}
+	node, ok := Global.Nodes[addr]
+	if !ok {
+		return 0, false
+	}
+	return node.Identity, true
+}
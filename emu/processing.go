@@ -0,0 +1,192 @@
+package emu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// Processing models the CPU of an emulated node, so that the time it spends on
+// blocks and messages does not depend on how many nodes share the host. Work
+// the model has no cost for is charged the time the host took, modelled work is
+// stretched by the slowdown. Host times are never stretched, as they grow with
+// the number of nodes sharing the host.
+type Processing struct {
+	GasCost  float64 `json:",omitempty"` // Nanoseconds of block validation per unit of gas
+	TxCost   float64 `json:",omitempty"` // Microseconds of signature recovery per transaction
+	Slowdown float64 `json:",omitempty"` // Factor the modelled times are stretched by, 1 if zero
+}
+
+// errSlowdownWithoutCost is returned for models stretching host times.
+var errSlowdownWithoutCost = errors.New("processing slowdown needs a gas or transaction cost")
+
+// Validate checks that the model stretches modelled costs only.
+func (p *Processing) Validate() error {
+	if p.Slowdown > 0 && p.GasCost == 0 && p.TxCost == 0 {
+		return errSlowdownWithoutCost
+	}
+	return nil
+}
+
+// cost returns the emulated time of processing the given gas and transactions,
+// which took the host the given time.
+func (p *Processing) cost(host time.Duration, gas uint64, txs int) time.Duration {
+	cost := time.Duration(p.GasCost*float64(gas) + p.TxCost*float64(txs)*float64(time.Microsecond))
+	if cost == 0 {
+		return host
+	}
+	if p.Slowdown > 0 {
+		cost = time.Duration(float64(cost) * p.Slowdown)
+	}
+	return cost
+}
+
+// CPU charges the processing times of a node according to its model. The node
+// has a single CPU, so work charged concurrently queues up behind whatever it
+// is still busy with.
+type CPU struct {
+	identity uint64
+	model    Processing
+	usage    CPUUsage
+	busy     time.Time // Time the work charged so far is done
+	lock     sync.Mutex
+}
+
+// CPUUsage sums up the processing times of a node as measured on the host and
+// as charged by its model.
+type CPUUsage struct {
+	Blocks        uint64        `json:"blocks"`
+	BlockHost     time.Duration `json:"blockHost"`
+	BlockEmulated time.Duration `json:"blockEmulated"`
+	Msgs          uint64        `json:"msgs"`
+	MsgHost       time.Duration `json:"msgHost"`
+	MsgEmulated   time.Duration `json:"msgEmulated"`
+}
+
+var (
+	cpus     = make(map[uint64]*CPU)
+	cpusLock sync.Mutex
+
+	processingLog     io.Writer
+	processingLogLock sync.Mutex
+)
+
+// NodeCPU returns the CPU of the emulated node with the given identity, or nil
+// if the node has no processing model and runs at host speed. The model of the
+// node itself takes precedence over the one of its profile.
+func NodeCPU(identity uint64) *CPU {
+	cpusLock.Lock()
+	defer cpusLock.Unlock()
+
+	if cpu, ok := cpus[identity]; ok {
+		return cpu
+	}
+	var model *Processing
+	for _, node := range Global.Nodes {
+		if node.Identity != identity {
+			continue
+		}
+		model = node.Processing
+		if model == nil && node.Profile != nil {
+			model = node.Profile.Processing
+		}
+	}
+	var cpu *CPU
+	if model != nil {
+		cpu = &CPU{identity: identity, model: *model}
+	}
+	cpus[identity] = cpu
+	return cpu
+}
+
+// PeerCPU returns the CPU of the emulated node with the given p2p identity, nil
+// if it runs at host speed.
+func PeerCPU(id enode.ID) *CPU {
+	identity, ok := NodeIdentity(id)
+	if !ok {
+		return nil
+	}
+	return NodeCPU(identity)
+}
+
+// EnableProcessingLog starts logging the processing times of every block import
+// on a node with a processing model as CSV, in microseconds, starting with a
+// header if requested. A nil writer stops logging.
+func EnableProcessingLog(w io.Writer, header bool) error {
+	processingLogLock.Lock()
+	defer processingLogLock.Unlock()
+
+	if w != nil && header {
+		if _, err := fmt.Fprintln(w, "ms,id,number,gas,txs,host,emulated"); err != nil {
+			return err
+		}
+	}
+	processingLog = w
+	return nil
+}
+
+// ProcessBlock blocks until the emulated time of importing a block has passed,
+// given the time the host already spent on it.
+func (c *CPU) ProcessBlock(number, gas uint64, txs int, host time.Duration) {
+	if c == nil {
+		return
+	}
+	emulated := c.model.cost(host, gas, txs)
+
+	c.lock.Lock()
+	c.usage.Blocks++
+	c.usage.BlockHost += host
+	c.usage.BlockEmulated += emulated
+	done := c.schedule(host, emulated)
+	c.lock.Unlock()
+
+	processingLogLock.Lock()
+	if processingLog != nil {
+		fmt.Fprintf(processingLog, "%d,%d,%d,%d,%d,%d,%d\n", time.Now().UnixMilli(), c.identity, number, gas, txs, host.Microseconds(), emulated.Microseconds())
+	}
+	processingLogLock.Unlock()
+
+	time.Sleep(time.Until(done))
+}
+
+// ProcessMessage blocks until the emulated time of handling a message carrying
+// the given number of transactions has passed, given the time the host already
+// spent on it.
+func (c *CPU) ProcessMessage(txs int, host time.Duration) {
+	if c == nil {
+		return
+	}
+	emulated := c.model.cost(host, 0, txs)
+
+	c.lock.Lock()
+	c.usage.Msgs++
+	c.usage.MsgHost += host
+	c.usage.MsgEmulated += emulated
+	done := c.schedule(host, emulated)
+	c.lock.Unlock()
+
+	time.Sleep(time.Until(done))
+}
+
+// schedule queues work which the host started the given time ago behind the
+// work charged before, returning the time it is done. The lock must be held.
+func (c *CPU) schedule(host, emulated time.Duration) time.Time {
+	start := time.Now().Add(-host)
+	if start.Before(c.busy) {
+		start = c.busy
+	}
+	c.busy = start.Add(emulated)
+	return c.busy
+}
+
+// Usage returns the processing times charged so far.
+func (c *CPU) Usage() CPUUsage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.usage
+}
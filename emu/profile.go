@@ -0,0 +1,126 @@
+package emu
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Profile overrides the configuration of a single node on top of the command
+// line flags shared by all nodes. Unset fields keep the shared configuration.
+type Profile struct {
+	Name string `json:",omitempty"` // Name of the predefined profile the overrides stem from
+
+	// Node overrides
+	MaxPeers   *int        `json:",omitempty"`
+	Processing *Processing `json:",omitempty"` // Model of the CPU of the node
+
+	// Eth overrides
+	Archive          bool         `json:",omitempty"` // Disable state pruning and keep all tx indices
+	BlockPropagation string       `json:",omitempty"` // Policy choosing the peers to push new blocks to
+	TxPropagation    string       `json:",omitempty"` // Policy choosing the peers to relay transactions to
+	CompactBlocks    bool         `json:",omitempty"` // Relay blocks in compact form to peers supporting it
+	EthVersions      []uint       `json:",omitempty"` // Versions of the eth protocol to advertise
+	GasCeil          *uint64      `json:",omitempty"` // Gas limit targeted by the miner
+	GasPrice         *hexutil.Big `json:",omitempty"` // Minimum gas price of mined transactions
+	PriceLimit       *uint64      `json:",omitempty"` // Minimum gas price to accept into the pool
+	AccountSlots     *uint64      `json:",omitempty"` // Executable pool slots per account
+	GlobalSlots      *uint64      `json:",omitempty"` // Executable pool slots in total
+	AccountQueue     *uint64      `json:",omitempty"` // Non-executable pool slots per account
+	GlobalQueue      *uint64      `json:",omitempty"` // Non-executable pool slots in total
+}
+
+func newUint64(v uint64) *uint64 { return &v }
+func newInt(v int) *int          { return &v }
+
+// Profiles are the predefined profiles assignable to nodes by name.
+var Profiles = map[string]*Profile{
+	"archive": {
+		Archive: true,
+	},
+	"small-mempool": {
+		AccountSlots: newUint64(4),
+		GlobalSlots:  newUint64(512),
+		AccountQueue: newUint64(16),
+		GlobalQueue:  newUint64(128),
+	},
+	"low-peer": {
+		MaxPeers: newInt(5),
+	},
+	"announce-only": {
+		BlockPropagation: "announce",
+	},
+	"early-relay": {
+		BlockPropagation: "early",
+	},
+	"dandelion": {
+		TxPropagation: "dandelion:4",
+	},
+	"compact": {
+		CompactBlocks: true,
+	},
+	"eth66": {
+		EthVersions: []uint{66},
+	},
+	"eth67": {
+		EthVersions: []uint{67, 66},
+	},
+	"slow-cpu": {
+		// A quarter of the speed of a node validating 200 Mgas/s and
+		// recovering a signature in 50µs
+		Processing: &Processing{GasCost: 5, TxCost: 50, Slowdown: 4},
+	},
+}
+
+// ProfileShare is the fraction of nodes assigned a profile.
+type ProfileShare struct {
+	Profile  *Profile
+	Fraction float64
+}
+
+// ParseProfileShares parses a comma separated list of name=fraction pairs of
+// predefined profiles, e.g. "archive=0.1,low-peer=0.25".
+func ParseProfileShares(spec string) ([]ProfileShare, error) {
+	var (
+		shares []ProfileShare
+		total  float64
+	)
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid profile share %q, want name=fraction", item)
+		}
+		profile, ok := Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (%s)", name, strings.Join(ProfileNames(), ", "))
+		}
+		fraction, err := strconv.ParseFloat(value, 64)
+		if err != nil || fraction < 0 || fraction > 1 {
+			return nil, fmt.Errorf("invalid fraction %q of profile %s", value, name)
+		}
+		total += fraction
+		named := *profile
+		named.Name = name
+		shares = append(shares, ProfileShare{Profile: &named, Fraction: fraction})
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("profile fractions add up to %v, more than all nodes", total)
+	}
+	return shares, nil
+}
+
+// ProfileNames returns the sorted names of the predefined profiles.
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,99 @@
+package emu
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+)
+
+// maxTrackedTxs is the number of most recent transactions whose transmissions
+// are counted.
+const maxTrackedTxs = 65536
+
+// TxTransmissions counts how often a transaction reached nodes across the whole
+// emulated network, in full or announced. Transmissions to nodes which already
+// knew the transaction are redundant.
+type TxTransmissions struct {
+	Deliveries             uint64 `json:"deliveries"`
+	RedundantDeliveries    uint64 `json:"redundantDeliveries"`
+	Announcements          uint64 `json:"announcements"`
+	RedundantAnnouncements uint64 `json:"redundantAnnouncements"`
+}
+
+// TxRedundancy sums the transmission counters of all tracked transactions.
+type TxRedundancy struct {
+	Txs int `json:"txs"` // Number of tracked transactions
+	TxTransmissions
+}
+
+var transmissions = struct {
+	txs  lru.BasicLRU[common.Hash, *TxTransmissions]
+	lock sync.Mutex
+}{txs: lru.NewBasicLRU[common.Hash, *TxTransmissions](maxTrackedTxs)}
+
+// record updates the counters of a transaction.
+func record(hash common.Hash, update func(*TxTransmissions)) {
+	transmissions.lock.Lock()
+	defer transmissions.lock.Unlock()
+
+	counts, ok := transmissions.txs.Get(hash)
+	if !ok {
+		counts = new(TxTransmissions)
+		transmissions.txs.Add(hash, counts)
+	}
+	update(counts)
+}
+
+// RecordTxDelivery counts a transaction received in full, redundant if the
+// receiving node already knew it.
+func RecordTxDelivery(hash common.Hash, redundant bool) {
+	record(hash, func(counts *TxTransmissions) {
+		counts.Deliveries++
+		if redundant {
+			counts.RedundantDeliveries++
+		}
+	})
+}
+
+// RecordTxAnnouncement counts an announcement of a transaction, redundant if the
+// receiving node already knew it.
+func RecordTxAnnouncement(hash common.Hash, redundant bool) {
+	record(hash, func(counts *TxTransmissions) {
+		counts.Announcements++
+		if redundant {
+			counts.RedundantAnnouncements++
+		}
+	})
+}
+
+// GetTxTransmissions returns the transmission counters of a transaction, nil
+// if it was never transmitted or is no longer tracked.
+func GetTxTransmissions(hash common.Hash) *TxTransmissions {
+	transmissions.lock.Lock()
+	defer transmissions.lock.Unlock()
+
+	counts, ok := transmissions.txs.Peek(hash)
+	if !ok {
+		return nil
+	}
+	result := *counts
+	return &result
+}
+
+// TotalTxTransmissions sums the transmission counters of all tracked
+// transactions.
+func TotalTxTransmissions() *TxRedundancy {
+	transmissions.lock.Lock()
+	defer transmissions.lock.Unlock()
+
+	total := &TxRedundancy{Txs: transmissions.txs.Len()}
+	for _, hash := range transmissions.txs.Keys() {
+		counts, _ := transmissions.txs.Peek(hash)
+		total.Deliveries += counts.Deliveries
+		total.RedundantDeliveries += counts.RedundantDeliveries
+		total.Announcements += counts.Announcements
+		total.RedundantAnnouncements += counts.RedundantAnnouncements
+	}
+	return total
+}
@@ -0,0 +1,52 @@
+package emu
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SpanningTree computes a breadth-first spanning tree over the static peer graph
+// of the config, whose links are taken as undirected. The search starts at the
+// node with the lowest identity and visits neighbours in identity order, so all
+// nodes compute the same tree. Disconnected parts of the graph get trees of
+// their own. The result maps every node to its neighbours in the tree.
+func SpanningTree() map[common.Address][]common.Address {
+	adjacent := PeerGraph()
+
+	nodes := make([]common.Address, 0, len(Global.Nodes))
+	for addr := range Global.Nodes {
+		nodes = append(nodes, addr)
+	}
+	SortByIdentity(nodes)
+
+	var (
+		tree    = make(map[common.Address][]common.Address)
+		visited = make(map[common.Address]bool)
+	)
+	for _, root := range nodes {
+		if visited[root] {
+			continue
+		}
+		visited[root] = true
+		queue := []common.Address{root}
+		for len(queue) > 0 {
+			addr := queue[0]
+			queue = queue[1:]
+
+			peers := make([]common.Address, 0, len(adjacent[addr]))
+			for peer := range adjacent[addr] {
+				peers = append(peers, peer)
+			}
+			SortByIdentity(peers)
+			for _, peer := range peers {
+				if visited[peer] {
+					continue
+				}
+				visited[peer] = true
+				tree[addr] = append(tree[addr], peer)
+				tree[peer] = append(tree[peer], addr)
+				queue = append(queue, peer)
+			}
+		}
+	}
+	return tree
+}
@@ -0,0 +1,595 @@
+package emu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// maxTrackedLifecycles is the number of most recent transactions whose
+// lifecycle is kept in memory during a run. The log holds all of them.
+const maxTrackedLifecycles = 8192
+
+// Events in the lifecycle of a transaction, as logged.
+const (
+	TxSubmitted = "submit"  // Submitted to a node as a local transaction
+	TxSeen      = "seen"    // Received by a node for the first time
+	TxQueued    = "queued"  // Added to the queued set of a node's pool
+	TxPending   = "pending" // Added to the pending set of a node's pool
+	TxDropped   = "drop"    // Removed from a node's pool without being mined, the detail is the reason
+	TxIncluded  = "include" // Included in the canonical chain of a node, the detail is the block number
+	TxExcluded  = "exclude" // Removed from the canonical chain of a node by a reorg
+	ChainHead   = "head"    // New canonical head of a node, the detail is its number
+)
+
+// Reasons a pool drops a transaction.
+const (
+	DropStale       = "stale"       // Nonce already used on chain by another transaction
+	DropUnpayable   = "unpayable"   // Balance or gas limit too low
+	DropReplaced    = "replaced"    // Replaced by a transaction of the same nonce paying more
+	DropUnderpriced = "underpriced" // Evicted by a better paying transaction or a raised price limit
+	DropOverflow    = "overflow"    // Evicted over the account or global slot limits
+	DropExpired     = "expired"     // Queued longer than the pool lifetime
+)
+
+// txInclusion is the block a node included a transaction in.
+type txInclusion struct {
+	number uint64
+	ms     int64
+}
+
+// txRecord holds the lifecycle of a transaction in unix milliseconds.
+type txRecord struct {
+	origin    uint64
+	submitted int64
+	seen      map[uint64]int64
+	queued    map[uint64]int64
+	pending   map[uint64]int64
+	dropped   map[uint64]string
+	included  map[uint64]txInclusion
+}
+
+// TxTracker follows transactions through all nodes of the network, along with
+// the growth of every node's chain to judge their confirmations.
+type TxTracker struct {
+	txs   lru.BasicLRU[common.Hash, *txRecord]
+	heads map[uint64][]int64 // Time every node first reached each block number
+	log   *bufio.Writer
+	lock  sync.Mutex
+
+	events chan txEvent  // Events recorded during a run, waiting to be applied
+	quit   chan struct{} // Closed to stop applying recorded events
+	done   chan struct{} // Closed once all recorded events are applied and logged
+}
+
+// txEvent is an event in the lifecycle of a transaction on a node.
+type txEvent struct {
+	ms     int64
+	node   uint64
+	event  string
+	hash   common.Hash
+	detail string
+}
+
+// txEventQueue is the number of recorded events waiting to be applied before
+// recording blocks.
+const txEventQueue = 16384
+
+// newTxTracker creates a tracker keeping the given number of transactions.
+func newTxTracker(limit int) *TxTracker {
+	return &TxTracker{
+		txs:   lru.NewBasicLRU[common.Hash, *txRecord](limit),
+		heads: make(map[uint64][]int64),
+	}
+}
+
+var (
+	txTracker     *TxTracker
+	txTrackerLock sync.RWMutex
+)
+
+// EnableTxTracking starts following the lifecycle of every transaction in the
+// network, logging each event to the given writer as CSV, starting with a
+// header if requested. Events are applied and logged in the background, so that
+// nodes recording them do not wait for it. A nil writer stops tracking, after
+// logging all events recorded until then.
+func EnableTxTracking(w io.Writer, header bool) error {
+	txTrackerLock.Lock()
+	defer txTrackerLock.Unlock()
+
+	if t := txTracker; t != nil {
+		txTracker = nil
+		close(t.quit)
+		<-t.done
+	}
+	if w == nil {
+		return nil
+	}
+	if header {
+		if _, err := fmt.Fprintln(w, "ms,id,event,tx,detail"); err != nil {
+			return err
+		}
+	}
+	t := newTxTracker(maxTrackedLifecycles)
+	t.log = bufio.NewWriter(w)
+	t.events = make(chan txEvent, txEventQueue)
+	t.quit = make(chan struct{})
+	t.done = make(chan struct{})
+	go t.loop()
+
+	txTracker = t
+	return nil
+}
+
+// liveTracker returns the tracker of the running emulation, nil if not tracking.
+func liveTracker() *TxTracker {
+	txTrackerLock.RLock()
+	defer txTrackerLock.RUnlock()
+
+	return txTracker
+}
+
+// loop applies the recorded events, flushing the log whenever it catches up.
+func (t *TxTracker) loop() {
+	defer close(t.done)
+
+	for {
+		select {
+		case ev := <-t.events:
+			t.apply(ev.ms, ev.node, ev.event, ev.hash, ev.detail)
+			if len(t.events) == 0 {
+				t.flush()
+			}
+		case <-t.quit:
+			for {
+				select {
+				case ev := <-t.events:
+					t.apply(ev.ms, ev.node, ev.event, ev.hash, ev.detail)
+				default:
+					t.flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes out the buffered log.
+func (t *TxTracker) flush() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := t.log.Flush(); err != nil {
+		log.Warn("Failed to write transaction lifecycle log", "err", err)
+	}
+}
+
+// enqueue hands a recorded event to the loop, unless tracking stops meanwhile.
+func (t *TxTracker) enqueue(ev txEvent) {
+	select {
+	case t.events <- ev:
+	case <-t.quit:
+	}
+}
+
+// recordTx adds an event of the given node to the live tracker, if tracking.
+func recordTx(node uint64, event string, hash common.Hash, detail string) {
+	if t := liveTracker(); t != nil {
+		t.enqueue(txEvent{ms: time.Now().UnixMilli(), node: node, event: event, hash: hash, detail: detail})
+	}
+}
+
+// RecordTxSubmit tracks a transaction submitted to a node.
+func RecordTxSubmit(node uint64, hash common.Hash) {
+	recordTx(node, TxSubmitted, hash, "")
+}
+
+// RecordTxSeen tracks a transaction reaching a node, locally or from a peer.
+func RecordTxSeen(node uint64, hash common.Hash) {
+	recordTx(node, TxSeen, hash, "")
+}
+
+// RecordHead tracks a new canonical head of a node and the transactions it
+// includes.
+func RecordHead(node, number uint64, txs []common.Hash) {
+	t := liveTracker()
+	if t == nil {
+		return
+	}
+	ms, detail := time.Now().UnixMilli(), strconv.FormatUint(number, 10)
+	for _, hash := range txs {
+		t.enqueue(txEvent{ms: ms, node: node, event: TxIncluded, hash: hash, detail: detail})
+	}
+	t.enqueue(txEvent{ms: ms, node: node, event: ChainHead, detail: detail})
+}
+
+// RecordTxsExcluded tracks transactions a reorg removed from the canonical
+// chain of a node without including them again.
+func RecordTxsExcluded(node uint64, txs []common.Hash) {
+	t := liveTracker()
+	if t == nil {
+		return
+	}
+	ms := time.Now().UnixMilli()
+	for _, hash := range txs {
+		t.enqueue(txEvent{ms: ms, node: node, event: TxExcluded, hash: hash})
+	}
+}
+
+// TxEvents collects the lifecycle events of the transactions in the pool of a
+// node while the pool is locked, to be recorded once it is unlocked again.
+type TxEvents struct {
+	node   uint64
+	events []txEvent
+	lock   sync.Mutex // Protects the collected events
+	flush  sync.Mutex // Keeps the events of concurrent flushes in order
+}
+
+// NewTxEvents creates a collector of the events of the given node.
+func NewTxEvents(node uint64) *TxEvents {
+	return &TxEvents{node: node}
+}
+
+// Queued collects a transaction added to the queued set of the pool.
+func (e *TxEvents) Queued(hash common.Hash) {
+	e.add(TxQueued, hash, "")
+}
+
+// Pending collects a transaction added to the pending set of the pool.
+func (e *TxEvents) Pending(hash common.Hash) {
+	e.add(TxPending, hash, "")
+}
+
+// Drop collects a transaction dropped by the pool.
+func (e *TxEvents) Drop(hash common.Hash, reason string) {
+	e.add(TxDropped, hash, reason)
+}
+
+func (e *TxEvents) add(event string, hash common.Hash, detail string) {
+	if liveTracker() == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.events = append(e.events, txEvent{ms: time.Now().UnixMilli(), node: e.node, event: event, hash: hash, detail: detail})
+}
+
+// Flush records the collected events. Callers release the pool lock first.
+func (e *TxEvents) Flush() {
+	e.flush.Lock()
+	defer e.flush.Unlock()
+
+	e.lock.Lock()
+	events := e.events
+	e.events = nil
+	e.lock.Unlock()
+
+	if t := liveTracker(); t != nil {
+		for _, ev := range events {
+			t.enqueue(ev)
+		}
+	}
+}
+
+// apply adds an event to the tracker and logs it.
+func (t *TxTracker) apply(ms int64, node uint64, event string, hash common.Hash, detail string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Pools drop the transactions of new heads as stale, which is no drop at all
+	if event == TxDropped && detail == DropStale {
+		if record, ok := t.txs.Peek(hash); ok {
+			if _, mined := record.included[node]; mined {
+				return
+			}
+		}
+	}
+	if t.log != nil {
+		tx := ""
+		if event != ChainHead {
+			tx = hash.Hex()
+		}
+		fmt.Fprintf(t.log, "%d,%d,%s,%s,%s\n", ms, node, event, tx, detail)
+	}
+	if event == ChainHead {
+		number, _ := strconv.ParseUint(detail, 10, 64)
+		for heads := t.heads[node]; uint64(len(heads)) <= number; heads = t.heads[node] {
+			t.heads[node] = append(heads, ms)
+		}
+		return
+	}
+	// The first node a transaction shows up on is its origin, unless submitted
+	record, ok := t.txs.Get(hash)
+	if !ok && event == TxExcluded {
+		return
+	}
+	if !ok {
+		record = &txRecord{
+			origin:    node,
+			submitted: ms,
+			seen:      make(map[uint64]int64),
+			queued:    make(map[uint64]int64),
+			pending:   make(map[uint64]int64),
+			dropped:   make(map[uint64]string),
+			included:  make(map[uint64]txInclusion),
+		}
+		t.txs.Add(hash, record)
+	}
+	first := func(times map[uint64]int64) {
+		if _, ok := times[node]; !ok {
+			times[node] = ms
+		}
+	}
+	switch event {
+	case TxSeen:
+		first(record.seen)
+	case TxQueued:
+		first(record.queued)
+	case TxPending:
+		first(record.pending)
+	case TxDropped:
+		record.dropped[node] = detail
+	case TxIncluded:
+		number, _ := strconv.ParseUint(detail, 10, 64)
+		record.included[node] = txInclusion{number: number, ms: ms}
+	case TxExcluded:
+		delete(record.included, node)
+	}
+}
+
+// confirmed returns the time a node reached the given number of confirmations
+// of a transaction, false if it has not (yet).
+func (t *TxTracker) confirmed(record *txRecord, node uint64, depth uint64) (int64, bool) {
+	inclusion, ok := record.included[node]
+	if !ok || depth == 0 {
+		return 0, false
+	}
+	if depth == 1 {
+		return inclusion.ms, true
+	}
+	heads := t.heads[node]
+	number := inclusion.number + depth - 1
+	if uint64(len(heads)) <= number {
+		return 0, false
+	}
+	// A reorg may move the transaction into a block at a height reached before
+	if heads[number] < inclusion.ms {
+		return inclusion.ms, true
+	}
+	return heads[number], true
+}
+
+// TxLifecycle is the path of a transaction through the network, with all times
+// in milliseconds since its submission.
+type TxLifecycle struct {
+	Hash          common.Hash       `json:"hash"`
+	Origin        uint64            `json:"origin"`        // Node the transaction was submitted to or first seen on
+	Submitted     int64             `json:"submitted"`     // Unix time of the submission in milliseconds
+	Seen          map[uint64]int64  `json:"seen"`          // First receipt per node
+	Queued        map[uint64]int64  `json:"queued"`        // First addition to the queued set per node
+	Pending       map[uint64]int64  `json:"pending"`       // First addition to the pending set per node
+	Dropped       map[uint64]string `json:"dropped"`       // Reason of the last drop per node
+	Included      map[uint64]uint64 `json:"included"`      // Block number per node
+	Confirmations []int64           `json:"confirmations"` // Time the origin reached one, two, ... confirmations
+}
+
+// Lifecycle returns the path of a tracked transaction, nil if unknown.
+func (t *TxTracker) Lifecycle(hash common.Hash) *TxLifecycle {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	record, ok := t.txs.Peek(hash)
+	if !ok {
+		return nil
+	}
+	since := func(times map[uint64]int64) map[uint64]int64 {
+		result := make(map[uint64]int64, len(times))
+		for node, ms := range times {
+			result[node] = ms - record.submitted
+		}
+		return result
+	}
+	lc := &TxLifecycle{
+		Hash:          hash,
+		Origin:        record.origin,
+		Submitted:     record.submitted,
+		Seen:          since(record.seen),
+		Queued:        since(record.queued),
+		Pending:       since(record.pending),
+		Dropped:       make(map[uint64]string, len(record.dropped)),
+		Included:      make(map[uint64]uint64, len(record.included)),
+		Confirmations: []int64{},
+	}
+	for node, reason := range record.dropped {
+		lc.Dropped[node] = reason
+	}
+	for node, inclusion := range record.included {
+		lc.Included[node] = inclusion.number
+	}
+	for depth := uint64(1); ; depth++ {
+		ms, ok := t.confirmed(record, record.origin, depth)
+		if !ok {
+			break
+		}
+		lc.Confirmations = append(lc.Confirmations, ms-record.submitted)
+	}
+	return lc
+}
+
+// Distribution summarises a set of durations in milliseconds.
+type Distribution struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   int64   `json:"min"`
+	P50   int64   `json:"p50"`
+	P90   int64   `json:"p90"`
+	P99   int64   `json:"p99"`
+	Max   int64   `json:"max"`
+}
+
+// distribution summarises the given durations, reordering them.
+func distribution(values []int64) Distribution {
+	d := Distribution{Count: len(values)}
+	if len(values) == 0 {
+		return d
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	var sum int64
+	for _, v := range values {
+		sum += v
+	}
+	rank := func(p float64) int64 {
+		return values[int(math.Ceil(p*float64(len(values))))-1]
+	}
+	d.Mean = float64(sum) / float64(len(values))
+	d.Min, d.P50, d.P90, d.P99, d.Max = values[0], rank(0.5), rank(0.9), rank(0.99), values[len(values)-1]
+	return d
+}
+
+// TxStats summarises the tracked transactions: how long they took to reach a
+// fraction of the nodes, how long from submission until the origin saw them
+// confirmed to the given depth, and why pools dropped them.
+type TxStats struct {
+	Txs          int            `json:"txs"`
+	Fraction     float64        `json:"fraction"`
+	Depth        uint64         `json:"depth"`
+	Reach        Distribution   `json:"reach"`
+	Confirmation Distribution   `json:"confirmation"`
+	Drops        map[string]int `json:"drops"` // Drops by reason, counted once per node
+}
+
+// Stats summarises the tracked transactions in a network of the given number
+// of nodes.
+func (t *TxTracker) Stats(nodes int, fraction float64, depth uint64) *TxStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats := &TxStats{
+		Txs:      t.txs.Len(),
+		Fraction: fraction,
+		Depth:    depth,
+		Drops:    make(map[string]int),
+	}
+	need := quorum(fraction, nodes)
+	var reach, confirmation []int64
+	for _, hash := range t.txs.Keys() {
+		record, _ := t.txs.Peek(hash)
+		if ms, ok := reached(record.seen, need); ok {
+			reach = append(reach, ms-record.submitted)
+		}
+		if ms, ok := t.confirmed(record, record.origin, depth); ok {
+			confirmation = append(confirmation, ms-record.submitted)
+		}
+		for _, reason := range record.dropped {
+			stats.Drops[reason]++
+		}
+	}
+	stats.Reach = distribution(reach)
+	stats.Confirmation = distribution(confirmation)
+	return stats
+}
+
+// GetTxLifecycle returns the path of a transaction through the network, nil
+// if it is not tracked.
+func GetTxLifecycle(hash common.Hash) *TxLifecycle {
+	txTrackerLock.RLock()
+	t := txTracker
+	txTrackerLock.RUnlock()
+
+	if t == nil {
+		return nil
+	}
+	return t.Lifecycle(hash)
+}
+
+// GetTxStats summarises the transactions tracked in the running network, nil
+// if not tracking.
+func GetTxStats(fraction float64, depth uint64) *TxStats {
+	txTrackerLock.RLock()
+	t := txTracker
+	txTrackerLock.RUnlock()
+
+	if t == nil {
+		return nil
+	}
+	return t.Stats(len(Global.Nodes), fraction, depth)
+}
+
+// ReadTxLog rebuilds the lifecycles of all transactions of a run from its log.
+func ReadTxLog(r io.Reader) (*TxTracker, error) {
+	t := newTxTracker(math.MaxInt32)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if line == 1 {
+			continue // header
+		}
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("line %d: expected 5 fields, got %d", line, len(fields))
+		}
+		ms, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		node, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		t.apply(ms, node, fields[2], common.HexToHash(fields[3]), fields[4])
+	}
+	return t, scanner.Err()
+}
+
+// Hashes returns the tracked transactions ordered by submission.
+func (t *TxTracker) Hashes() []common.Hash {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	hashes := t.txs.Keys()
+	sort.SliceStable(hashes, func(i, j int) bool {
+		a, _ := t.txs.Peek(hashes[i])
+		b, _ := t.txs.Peek(hashes[j])
+		return a.submitted < b.submitted
+	})
+	return hashes
+}
+
+// Reached returns the time the transaction took to reach the given fraction of
+// a network of the given number of nodes, false if it reached fewer.
+func (lc *TxLifecycle) Reached(fraction float64, nodes int) (int64, bool) {
+	return reached(lc.Seen, quorum(fraction, nodes))
+}
+
+// quorum returns the number of nodes making up the given fraction of a network,
+// at least one.
+func quorum(fraction float64, nodes int) int {
+	if need := int(math.Ceil(fraction * float64(nodes))); need > 1 {
+		return need
+	}
+	return 1
+}
+
+// reached returns the time the given number of nodes had seen a transaction,
+// false if fewer did.
+func reached(seen map[uint64]int64, nodes int) (int64, bool) {
+	if nodes < 1 || len(seen) < nodes {
+		return 0, false
+	}
+	times := make([]int64, 0, len(seen))
+	for _, ms := range seen {
+		times = append(times, ms)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[nodes-1], true
+}
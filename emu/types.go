@@ -2,10 +2,60 @@ package emu
 
 import (
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 type Node struct {
 	Identity uint64
 	Address  common.Address
 	Peers    []common.Address
+	Hashrate uint64 `json:",omitempty"`
+
+	// Upload and Download are the capacities of the node in bytes per
+	// millisecond, shared fairly by its concurrent transfers. Zero leaves the
+	// node limited by its links only.
+	Upload   uint64 `json:",omitempty"`
+	Download uint64 `json:",omitempty"`
+
+	// ClockOffset is the time in milliseconds the clock of the node runs ahead
+	// of the host clock, negative if behind. ClockDrift is the rate at which the
+	// clock gains on the host clock further, in parts per million.
+	ClockOffset int64   `json:",omitempty"`
+	ClockDrift  float64 `json:",omitempty"`
+
+	// Processing models the CPU of the node, taking precedence over the model
+	// of its profile. Without a model the node runs at host speed.
+	Processing *Processing `json:",omitempty"`
+
+	// Validator marks the node as a member of the BFT validator set
+	Validator bool `json:",omitempty"`
+
+	// Accounts are the funded workload accounts of the node, derived from the
+	// seed of the network
+	Accounts []common.Address `json:",omitempty"`
+
+	// Profile overrides the shared configuration for this node
+	Profile *Profile `json:",omitempty"`
+}
+
+// NodeInfo is the runtime status of an emulated node.
+type NodeInfo struct {
+	Identity uint64           `json:"identity"`
+	Address  common.Address   `json:"address"`
+	Enode    string           `json:"enode"`
+	Number   hexutil.Uint64   `json:"number"`
+	Head     common.Hash      `json:"head"`
+	Peers    []common.Address `json:"peers"`
+	Mining   bool             `json:"mining"`
+	Paused   bool             `json:"paused"`
+	Profile  string           `json:"profile,omitempty"`
+	Versions []uint           `json:"versions"` // Advertised eth protocol versions
+	Clock    int64            `json:"clock"`    // Milliseconds the node clock runs ahead of the host
+}
+
+// LinkInfo is the runtime status of a connection between two emulated nodes.
+type LinkInfo struct {
+	From    common.Address `json:"from"`    // Node reporting the connection
+	To      common.Address `json:"to"`      // Peer of the node
+	Version uint           `json:"version"` // Negotiated eth protocol version
 }
@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/bft"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
@@ -50,9 +51,11 @@ import (
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/internal/shutdowncheck"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -90,6 +93,7 @@ type Ethereum struct {
 
 	networkID     uint64
 	netRPCService *ethapi.NetAPI
+	ethVersions   []uint // Versions of the eth protocol advertised to peers
 
 	p2pServer *p2p.Server
 
@@ -123,6 +127,18 @@ func New(stack *node.Node, config *ethconfig.Config, id int, blockLog *os.File,
 		}
 		config.TrieDirtyCache = 0
 	}
+	propagate, err := newBlockPropagationPolicy(config.BlockPropagation, id)
+	if err != nil {
+		return nil, err
+	}
+	txPropagate, err := newTxPropagationPolicy(config.TxPropagation, id)
+	if err != nil {
+		return nil, err
+	}
+	ethVersions, err := protocolVersions(config)
+	if err != nil {
+		return nil, err
+	}
 	log.Info("Allocated trie memory caches", "clean", common.StorageSize(config.TrieCleanCache)*1024*1024, "dirty", common.StorageSize(config.TrieDirtyCache)*1024*1024)
 
 	// Assemble the Ethereum object
@@ -133,8 +149,12 @@ func New(stack *node.Node, config *ethconfig.Config, id int, blockLog *os.File,
 	if err := pruner.RecoverPruning(stack.ResolvePath(""), chainDb, stack.ResolvePath(config.TrieCleanCacheJournal)); err != nil {
 		log.Error("Failed to recover state", "error", err)
 	}
-	// Transfer mining-related config to the ethash config.
-	engine := ethconfig.CreateConsensusEngine()
+	// Pick the consensus engine the chain was configured with
+	chainConfig, err := core.LoadChainConfig(chainDb, config.Genesis)
+	if err != nil {
+		return nil, err
+	}
+	engine := ethconfig.CreateConsensusEngine(chainConfig, &config.Ethash, chainDb)
 
 	eth := &Ethereum{
 		config:            config,
@@ -145,6 +165,7 @@ func New(stack *node.Node, config *ethconfig.Config, id int, blockLog *os.File,
 		engine:            engine,
 		closeBloomHandler: make(chan struct{}),
 		networkID:         config.NetworkId,
+		ethVersions:       ethVersions,
 		gasPrice:          config.Miner.GasPrice,
 		etherbase:         config.Miner.Etherbase,
 		bloomRequests:     make(chan chan *bloombits.Retrieval),
@@ -191,7 +212,7 @@ func New(stack *node.Node, config *ethconfig.Config, id int, blockLog *os.File,
 	if config.OverrideShanghai != nil {
 		overrides.OverrideShanghai = config.OverrideShanghai
 	}
-	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, config.Genesis, &overrides, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit, id, blockLog)
+	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, config.Genesis, &overrides, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit, id, blockLog, propagate.Name())
 	if err != nil {
 		return nil, err
 	}
@@ -209,15 +230,18 @@ func New(stack *node.Node, config *ethconfig.Config, id int, blockLog *os.File,
 		checkpoint = params.TrustedCheckpoints[eth.blockchain.Genesis().Hash()]
 	}
 	if eth.handler, err = newHandler(&handlerConfig{
-		Database:   chainDb,
-		Chain:      eth.blockchain,
-		TxPool:     eth.txPool,
-		Merger:     eth.merger,
-		Network:    config.NetworkId,
-		Sync:       config.SyncMode,
-		BloomCache: uint64(cacheLimit),
-		EventMux:   eth.eventMux,
-		Checkpoint: checkpoint,
+		Database:    chainDb,
+		Chain:       eth.blockchain,
+		TxPool:      eth.txPool,
+		Merger:      eth.merger,
+		Network:     config.NetworkId,
+		Sync:        config.SyncMode,
+		BloomCache:  uint64(cacheLimit),
+		EventMux:    eth.eventMux,
+		Checkpoint:  checkpoint,
+		Metrics:     metrics.Node(id),
+		Propagate:   propagate,
+		TxPropagate: txPropagate,
 	}); err != nil {
 		return nil, err
 	}
@@ -241,6 +265,11 @@ func New(stack *node.Node, config *ethconfig.Config, id int, blockLog *os.File,
 	// Register the backend on the node
 	stack.RegisterAPIs(eth.APIs())
 	stack.RegisterProtocols(eth.Protocols())
+	if b, ok := engine.(*bft.BFT); ok {
+		b.SetImporter(eth.handler.importDecided)
+		b.SetProcessor(eth.blockchain.VerifyBlock)
+		stack.RegisterProtocols(b.Protocols())
+	}
 	stack.RegisterLifecycle(eth)
 
 	// Successful startup; push a marker and check previous unclean shutdowns.
@@ -422,6 +451,14 @@ func (s *Ethereum) StartMining(threads int) error {
 			}
 			cli.Authorize(eb, wallet.SignData)
 		}
+		if b, ok := s.engine.(*bft.BFT); ok {
+			wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+			if wallet == nil || err != nil {
+				log.Error("Etherbase account unavailable locally", "err", err)
+				return fmt.Errorf("signer missing: %v", err)
+			}
+			b.Authorize(eb, wallet.SignData)
+		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
 		atomic.StoreUint32(&s.handler.acceptTxs, 1)
@@ -469,10 +506,62 @@ func (s *Ethereum) SyncMode() downloader.SyncMode {
 // Protocols returns all the currently configured
 // network protocols to start.
 func (s *Ethereum) Protocols() []p2p.Protocol {
-	protos := eth.MakeProtocols((*ethHandler)(s.handler), s.networkID)
+	protos := eth.MakeProtocols((*ethHandler)(s.handler), s.networkID, s.ethVersions)
 	return protos
 }
 
+// ProtocolVersions returns the versions of the eth protocol advertised to peers.
+func (s *Ethereum) ProtocolVersions() []uint {
+	return s.ethVersions
+}
+
+// PeerVersion returns the eth version negotiated with a connected peer.
+func (s *Ethereum) PeerVersion(id enode.ID) (uint, bool) {
+	if peer := s.handler.peers.peer(id.String()); peer != nil {
+		return peer.Version(), true
+	}
+	return 0, false
+}
+
+// protocolVersions returns the eth versions a node advertises, highest first:
+// the configured subset of eth.ProtocolVersions, preceded by eth/69 if compact
+// blocks are enabled. As eth/69 extends eth/68, compact blocks are left out on
+// nodes restricted to older versions.
+func protocolVersions(config *ethconfig.Config) ([]uint, error) {
+	versions := eth.ProtocolVersions
+	if len(config.ProtocolVersions) > 0 {
+		for _, want := range config.ProtocolVersions {
+			if !hasVersion(eth.ProtocolVersions, want) {
+				return nil, fmt.Errorf("unsupported eth protocol versions %v, want a subset of %v", config.ProtocolVersions, eth.ProtocolVersions)
+			}
+		}
+		versions = nil
+		for _, version := range eth.ProtocolVersions {
+			if hasVersion(config.ProtocolVersions, version) {
+				versions = append(versions, version)
+			}
+		}
+	}
+	if config.CompactBlocks {
+		if !hasVersion(versions, eth.ETH68) {
+			log.Warn("Compact blocks need eth/68, leaving them disabled", "versions", versions)
+			return versions, nil
+		}
+		versions = append([]uint{eth.ETH69}, versions...)
+	}
+	return versions, nil
+}
+
+// hasVersion reports whether a list of eth versions contains the given one.
+func hasVersion(versions []uint, version uint) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
 // Start implements node.Lifecycle, starting all internal goroutines needed by the
 // Ethereum protocol implementation.
 func (s *Ethereum) Start() error {
@@ -487,6 +576,7 @@ func (s *Ethereum) Start() error {
 	// Figure out a max peers count based on the server limits
 	maxPeers := s.p2pServer.MaxPeers
 	// Start the networking layer and the light server if requested
+	s.p2pServer.SetPeerScorer(s.handler.scorePeer)
 	s.handler.Start(maxPeers)
 	return nil
 }
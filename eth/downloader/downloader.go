@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -80,8 +81,9 @@ var (
 	ErrMergeTransition         = errors.New("legacy sync reached the merge")
 )
 
-// peerDropFn is a callback type for dropping a peer detected as malicious.
-type peerDropFn func(id string)
+// peerDropFn is a callback type for dropping a peer detected as malicious,
+// telling whether it delivered invalid data rather than stalling or timing out.
+type peerDropFn func(id string, invalid bool)
 
 // headerTask is a set of downloaded headers to queue along with their precomputed
 // hashes to avoid constant rehashing.
@@ -112,6 +114,14 @@ type Downloader struct {
 	// Callbacks
 	dropPeer peerDropFn // Drops a peer for misbehaving
 
+	// Metrics, reported under the emulated node id
+	headerInMeter    *metrics.Counter
+	headerDropMeter  *metrics.Counter
+	bodyInMeter      *metrics.Counter
+	bodyDropMeter    *metrics.Counter
+	receiptInMeter   *metrics.Counter
+	receiptDropMeter *metrics.Counter
+
 	// Status
 	synchroniseMock func(id string, hash common.Hash) error // Replacement for synchronise during testing
 	synchronising   atomic.Bool
@@ -205,7 +215,7 @@ type BlockChain interface {
 }
 
 // New creates a new downloader to fetch hashes and blocks from remote peers.
-func New(checkpoint uint64, stateDb ethdb.Database, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn, success func()) *Downloader {
+func New(checkpoint uint64, stateDb ethdb.Database, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn, success func(), registry *metrics.Registry) *Downloader {
 	if lightchain == nil {
 		lightchain = chain
 	}
@@ -221,6 +231,13 @@ func New(checkpoint uint64, stateDb ethdb.Database, mux *event.TypeMux, chain Bl
 		headerProcCh:   make(chan *headerTask, 1),
 		quitCh:         make(chan struct{}),
 		syncStartBlock: chain.CurrentSnapBlock().Number.Uint64(),
+
+		headerInMeter:    registry.Counter("eth/downloader/headers/in"),
+		headerDropMeter:  registry.Counter("eth/downloader/headers/drop"),
+		bodyInMeter:      registry.Counter("eth/downloader/bodies/in"),
+		bodyDropMeter:    registry.Counter("eth/downloader/bodies/drop"),
+		receiptInMeter:   registry.Counter("eth/downloader/receipts/in"),
+		receiptDropMeter: registry.Counter("eth/downloader/receipts/drop"),
 	}
 	return dl
 }
@@ -325,7 +342,7 @@ func (d *Downloader) LegacySync(id string, head common.Hash, td, ttd *big.Int, m
 			// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
 			log.Warn("Downloader wants to drop peer, but peerdrop-function is not set", "peer", id)
 		} else {
-			d.dropPeer(id)
+			d.dropPeer(id, errors.Is(err, errInvalidChain))
 		}
 		return err
 	}
@@ -975,7 +992,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, head uint64) e
 		default:
 			// Header retrieval either timed out, or the peer failed in some strange way
 			// (e.g. disconnect). Consider the master peer bad and drop
-			d.dropPeer(p.id)
+			d.dropPeer(p.id, false)
 
 			// Finish the sync gracefully instead of dumping the gathered data though
 			for _, ch := range []chan bool{d.queue.blockWakeCh, d.queue.receiptWakeCh} {
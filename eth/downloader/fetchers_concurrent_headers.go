@@ -85,6 +85,10 @@ func (q *headerQueue) deliver(peer *peerConnection, packet *eth.Response) (int,
 	hashes := packet.Meta.([]common.Hash)
 
 	accepted, err := q.queue.DeliverHeaders(peer.id, headers, hashes, q.headerProcCh)
+	q.headerInMeter.Inc(int64(len(headers)))
+	if err != nil {
+		q.headerDropMeter.Inc(int64(len(headers)))
+	}
 	switch {
 	case err == nil && len(headers) == 0:
 		peer.log.Trace("Requested headers delivered")
@@ -92,6 +92,10 @@ func (q *receiptQueue) deliver(peer *peerConnection, packet *eth.Response) (int,
 	hashes := packet.Meta.([]common.Hash) // {receipt hashes}
 
 	accepted, err := q.queue.DeliverReceipts(peer.id, receipts, hashes)
+	q.receiptInMeter.Inc(int64(len(receipts)))
+	if err != nil {
+		q.receiptDropMeter.Inc(int64(len(receipts)))
+	}
 	switch {
 	case err == nil && len(receipts) == 0:
 		peer.log.Trace("Requested receipts delivered")
@@ -21,11 +21,13 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/bft"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/txpool"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/params"
 )
@@ -83,6 +85,24 @@ type Config struct {
 	NetworkId uint64 // Network ID to use for selecting peers to connect to
 	SyncMode  downloader.SyncMode
 
+	// BlockPropagation is the policy choosing the peers to push new blocks to,
+	// see eth.BlockPropagationPolicies. Empty selects the square root policy.
+	BlockPropagation string `toml:",omitempty"`
+
+	// TxPropagation is the policy choosing the peers to relay transactions to,
+	// see eth.TxPropagationPolicies. Empty selects the square root policy.
+	TxPropagation string `toml:",omitempty"`
+
+	// CompactBlocks advertises eth/69, relaying blocks in compact form to the
+	// peers supporting it. It has no effect unless eth/68 is enabled, which
+	// eth/69 extends.
+	CompactBlocks bool `toml:",omitempty"`
+
+	// ProtocolVersions restricts the eth versions advertised to peers to a subset
+	// of eth.ProtocolVersions, all of them if empty. Compact blocks add eth/69
+	// regardless.
+	ProtocolVersions []uint `toml:",omitempty"`
+
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
@@ -108,6 +128,9 @@ type Config struct {
 	// Mining options
 	Miner miner.Config
 
+	// Ethash options
+	Ethash ethash.Config
+
 	// Transaction pool options
 	TxPool txpool.Config
 
@@ -141,6 +164,11 @@ type Config struct {
 }
 
 // CreateConsensusEngine creates a consensus engine for the given chain configuration.
-func CreateConsensusEngine() consensus.Engine {
-	return ethash.New()
+func CreateConsensusEngine(config *params.ChainConfig, ethashConfig *ethash.Config, db ethdb.Database) consensus.Engine {
+	// If BFT agreement is requested, set it up
+	if config.BFT != nil {
+		return bft.New(config.BFT, db)
+	}
+	// Otherwise assume proof-of-work
+	return ethash.New(*ethashConfig)
 }
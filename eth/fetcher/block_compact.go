@@ -0,0 +1,139 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	errCompactTimeout  = errors.New("missing compact block transactions timed out")
+	errCompactMissing  = errors.New("peer did not deliver all missing transactions")
+	errCompactMismatch = errors.New("rebuilt transactions do not match the header")
+)
+
+// txsRequesterFn is a callback type for sending a request for the transactions
+// of a compact block at the given indices.
+type txsRequesterFn func(common.Hash, []uint64, chan *eth.Response) (*eth.Request, error)
+
+// txLookupFn is a callback type resolving the short IDs of a compact block
+// against the local transaction pool, yielding nil for unknown transactions.
+type txLookupFn func(ids []uint64) []*types.Transaction
+
+// EnqueueCompact rebuilds a block propagated in compact form from the local
+// transaction pool, requests the transactions missing from it from the peer and
+// schedules the complete block for import. If the block cannot be rebuilt, the
+// fallback is invoked to retrieve it like an announced block instead.
+func (f *BlockFetcher) EnqueueCompact(peer string, compact *eth.NewCompactBlockPacket, lookup txLookupFn, fetchTxs txsRequesterFn, fallback func()) {
+	hash := compact.Header.Hash()
+	if f.getBlock(hash) != nil {
+		return
+	}
+	// Rebuild every block only once, even if multiple peers relay it
+	f.compactLock.Lock()
+	if _, ok := f.compacting[hash]; ok {
+		f.compactLock.Unlock()
+		return
+	}
+	f.compacting[hash] = struct{}{}
+	f.compactLock.Unlock()
+
+	f.compactInMeter.Inc(1)
+	go func() {
+		defer func() {
+			f.compactLock.Lock()
+			delete(f.compacting, hash)
+			f.compactLock.Unlock()
+		}()
+		block, err := f.rebuildCompact(hash, compact, lookup, fetchTxs)
+		if err != nil {
+			log.Debug("Compact block reconstruction failed", "peer", peer, "number", compact.Header.Number, "hash", hash, "err", err)
+			f.compactFallbackMeter.Inc(1)
+			fallback()
+			return
+		}
+		block.ReceivedAt = time.Now()
+		f.Enqueue(peer, block)
+	}()
+}
+
+// rebuildCompact assembles the block of a compact block packet, fetching the
+// transactions missing from the local pool from the peer.
+func (f *BlockFetcher) rebuildCompact(hash common.Hash, compact *eth.NewCompactBlockPacket, lookup txLookupFn, fetchTxs txsRequesterFn) (*types.Block, error) {
+	var (
+		txs     = make([]*types.Transaction, len(compact.ShortIDs)+len(compact.Prefilled))
+		pooled  = lookup(compact.ShortIDs)
+		missing []uint64
+	)
+	for _, prefilled := range compact.Prefilled {
+		txs[prefilled.Index] = prefilled.Tx
+	}
+	for i, next := 0, 0; i < len(txs); i++ {
+		if txs[i] != nil {
+			continue
+		}
+		if txs[i] = pooled[next]; txs[i] == nil {
+			missing = append(missing, uint64(i))
+		}
+		next++
+	}
+	if len(missing) > 0 {
+		f.compactMissingMeter.Inc(int64(len(missing)))
+
+		resCh := make(chan *eth.Response)
+		req, err := fetchTxs(hash, missing, resCh)
+		if err != nil {
+			return nil, err
+		}
+		defer req.Close()
+
+		timeout := time.NewTimer(fetchTimeout)
+		defer timeout.Stop()
+
+		select {
+		case res := <-resCh:
+			res.Done <- nil
+			delivered := *res.Res.(*eth.BlockTxsPacket)
+			if len(delivered) != len(missing) {
+				return nil, errCompactMissing
+			}
+			for i, index := range missing {
+				txs[index] = delivered[i]
+			}
+		case <-timeout.C:
+			return nil, errCompactTimeout
+		case <-f.quit:
+			return nil, errTerminated
+		}
+	}
+	// Short IDs may collide, make sure the transactions are the right ones
+	if types.DeriveSha(types.Transactions(txs), trie.NewStackTrie(nil)) != compact.Header.TxHash {
+		return nil, errCompactMismatch
+	}
+	block := types.NewBlockWithHeader(compact.Header).WithBody(txs, compact.Uncles)
+	if compact.Withdrawals != nil {
+		block = block.WithWithdrawals(compact.Withdrawals)
+	}
+	return block, nil
+}
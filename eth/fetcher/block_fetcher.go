@@ -20,6 +20,7 @@ package fetcher
 import (
 	"errors"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -28,6 +29,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -74,8 +76,9 @@ type headersInsertFn func(headers []*types.Header) (int, error)
 // chainInsertFn is a callback type to insert a batch of blocks into the local chain.
 type chainInsertFn func(types.Blocks) (int, error)
 
-// peerDropFn is a callback type for dropping a peer detected as malicious.
-type peerDropFn func(id string)
+// peerDropFn is a callback type for dropping a peer detected as malicious,
+// telling whether it delivered invalid data rather than stalling or timing out.
+type peerDropFn func(id string, invalid bool)
 
 // blockAnnounce is the hash notification of the availability of a new block in the
 // network.
@@ -158,16 +161,34 @@ type BlockFetcher struct {
 	queues map[string]int                            // Per peer block counts to prevent memory exhaustion
 	queued map[common.Hash]*blockOrHeaderInject      // Set of already queued blocks (to dedup imports)
 
+	// Compact block states
+	compacting  map[common.Hash]struct{} // Compact blocks currently being rebuilt
+	compactLock sync.Mutex               // Protects the compact block states
+
 	// Callbacks
 	getHeader      HeaderRetrievalFn  // Retrieves a header from the local chain
 	getBlock       blockRetrievalFn   // Retrieves a block from the local chain
 	verifyHeader   headerVerifierFn   // Checks if a block's headers have a valid proof of work
 	broadcastBlock blockBroadcasterFn // Broadcasts a block to connected peers
+	relayEarly     bool               // Whether to broadcast blocks before verifying their header
 	chainHeight    chainHeightFn      // Retrieves the current chain's height
 	insertHeaders  headersInsertFn    // Injects a batch of headers into the chain
 	insertChain    chainInsertFn      // Injects a batch of blocks into the chain
 	dropPeer       peerDropFn         // Drops a peer for misbehaving
 
+	// Metrics, reported under the emulated node id
+	announceInMeter   *metrics.Counter
+	announceOutTimer  *metrics.Histogram
+	announceDropMeter *metrics.Counter
+	announceDOSMeter  *metrics.Counter
+	broadcastInMeter  *metrics.Counter
+	headerFetchMeter  *metrics.Counter
+	bodyFetchMeter    *metrics.Counter
+
+	compactInMeter       *metrics.Counter
+	compactMissingMeter  *metrics.Counter
+	compactFallbackMeter *metrics.Counter
+
 	// Testing hooks
 	announceChangeHook func(common.Hash, bool)           // Method to call upon adding or deleting a hash from the blockAnnounce list
 	queueChangeHook    func(common.Hash, bool)           // Method to call upon adding or deleting a block from the import queue
@@ -177,7 +198,7 @@ type BlockFetcher struct {
 }
 
 // NewBlockFetcher creates a block fetcher to retrieve blocks based on hash announcements.
-func NewBlockFetcher(light bool, getHeader HeaderRetrievalFn, getBlock blockRetrievalFn, verifyHeader headerVerifierFn, broadcastBlock blockBroadcasterFn, chainHeight chainHeightFn, insertHeaders headersInsertFn, insertChain chainInsertFn, dropPeer peerDropFn) *BlockFetcher {
+func NewBlockFetcher(light bool, getHeader HeaderRetrievalFn, getBlock blockRetrievalFn, verifyHeader headerVerifierFn, broadcastBlock blockBroadcasterFn, relayEarly bool, chainHeight chainHeightFn, insertHeaders headersInsertFn, insertChain chainInsertFn, dropPeer peerDropFn, registry *metrics.Registry) *BlockFetcher {
 	return &BlockFetcher{
 		light:          light,
 		notify:         make(chan *blockAnnounce),
@@ -194,14 +215,28 @@ func NewBlockFetcher(light bool, getHeader HeaderRetrievalFn, getBlock blockRetr
 		queue:          prque.New[int64, *blockOrHeaderInject](nil),
 		queues:         make(map[string]int),
 		queued:         make(map[common.Hash]*blockOrHeaderInject),
+		compacting:     make(map[common.Hash]struct{}),
 		getHeader:      getHeader,
 		getBlock:       getBlock,
 		verifyHeader:   verifyHeader,
 		broadcastBlock: broadcastBlock,
+		relayEarly:     relayEarly,
 		chainHeight:    chainHeight,
 		insertHeaders:  insertHeaders,
 		insertChain:    insertChain,
 		dropPeer:       dropPeer,
+
+		announceInMeter:   registry.Counter("eth/fetcher/block/announces/in"),
+		announceOutTimer:  registry.Histogram("eth/fetcher/block/announces/out", metrics.DefaultBuckets),
+		announceDropMeter: registry.Counter("eth/fetcher/block/announces/drop"),
+		announceDOSMeter:  registry.Counter("eth/fetcher/block/announces/dos"),
+		broadcastInMeter:  registry.Counter("eth/fetcher/block/broadcasts/in"),
+		headerFetchMeter:  registry.Counter("eth/fetcher/block/headers"),
+		bodyFetchMeter:    registry.Counter("eth/fetcher/block/bodies"),
+
+		compactInMeter:       registry.Counter("eth/fetcher/block/compact/in"),
+		compactMissingMeter:  registry.Counter("eth/fetcher/block/compact/missing"),
+		compactFallbackMeter: registry.Counter("eth/fetcher/block/compact/fallback"),
 	}
 }
 
@@ -362,9 +397,12 @@ func (f *BlockFetcher) loop() {
 			return
 
 		case notification := <-f.notify:
+			f.announceInMeter.Inc(1)
+
 			count := f.announces[notification.origin] + 1
 			if count > hashLimit {
 				log.Debug("Peer exceeded outstanding announces", "peer", notification.origin, "limit", hashLimit)
+				f.announceDOSMeter.Inc(1)
 				break
 			}
 			if notification.number == 0 {
@@ -373,6 +411,7 @@ func (f *BlockFetcher) loop() {
 			// If we have a valid block number, check that it's potentially useful
 			if dist := int64(notification.number) - int64(f.chainHeight()); dist < -maxUncleDist || dist > maxQueueDist {
 				log.Debug("Peer discarded announcement", "peer", notification.origin, "number", notification.number, "hash", notification.hash, "distance", dist)
+				f.announceDropMeter.Inc(1)
 				break
 			}
 			// All is well, schedule the announce if block's not yet downloading
@@ -397,6 +436,7 @@ func (f *BlockFetcher) loop() {
 			if f.light {
 				continue
 			}
+			f.broadcastInMeter.Inc(1)
 			f.enqueue(op.origin, nil, op.block)
 
 		case hash := <-f.done:
@@ -419,6 +459,7 @@ func (f *BlockFetcher) loop() {
 					// Pick a random peer to retrieve from, reset all others
 					announce := announces[rand.Intn(len(announces))]
 					f.forgetHash(hash)
+					f.announceOutTimer.UpdateSince(announce.time)
 
 					// If the block still didn't arrive, queue for fetching
 					if (f.light && f.getHeader(hash) == nil) || (!f.light && f.getBlock(hash) == nil) {
@@ -438,6 +479,7 @@ func (f *BlockFetcher) loop() {
 						f.fetchingHook(hashes)
 					}
 					for _, hash := range hashes {
+						f.headerFetchMeter.Inc(1)
 						go func(hash common.Hash) {
 							resCh := make(chan *eth.Response)
 
@@ -460,7 +502,7 @@ func (f *BlockFetcher) loop() {
 								// was already rescheduled at this point, we were
 								// waiting for a catchup. With an unresponsive
 								// peer however, it's a protocol violation.
-								f.dropPeer(peer)
+								f.dropPeer(peer, false)
 							}
 						}(hash)
 					}
@@ -494,6 +536,8 @@ func (f *BlockFetcher) loop() {
 				}
 				fetchBodies := f.completing[hashes[0]].fetchBodies
 
+				f.bodyFetchMeter.Inc(int64(len(hashes)))
+
 				go func(peer string, hashes []common.Hash) {
 					resCh := make(chan *eth.Response)
 
@@ -518,7 +562,7 @@ func (f *BlockFetcher) loop() {
 						// was already rescheduled at this point, we were
 						// waiting for a catchup. With an unresponsive
 						// peer however, it's a protocol violation.
-						f.dropPeer(peer)
+						f.dropPeer(peer, false)
 					}
 				}(peer, hashes)
 			}
@@ -547,7 +591,7 @@ func (f *BlockFetcher) loop() {
 					// If the delivered header does not match the promised number, drop the announcer
 					if header.Number.Uint64() != announce.number {
 						log.Trace("Invalid block number fetched", "peer", announce.origin, "hash", header.Hash(), "announced", announce.number, "provided", header.Number)
-						f.dropPeer(announce.origin)
+						f.dropPeer(announce.origin, true)
 						f.forgetHash(hash)
 						continue
 					}
@@ -781,7 +825,7 @@ func (f *BlockFetcher) importHeaders(peer string, header *types.Header) {
 		// Validate the header and if something went wrong, drop the peer
 		if err := f.verifyHeader(header); err != nil && err != consensus.ErrFutureBlock {
 			log.Debug("Propagated header verification failed", "peer", peer, "number", header.Number, "hash", hash, "err", err)
-			f.dropPeer(peer)
+			f.dropPeer(peer, true)
 			return
 		}
 		// Run the actual import and log any issues
@@ -813,11 +857,17 @@ func (f *BlockFetcher) importBlocks(peer string, block *types.Block) {
 			log.Debug("Unknown parent of propagated block", "peer", peer, "number", block.Number(), "hash", hash, "parent", block.ParentHash())
 			return
 		}
-		// Quickly validate the header and propagate the block if it passes
+		// Relay the block right away if requested, otherwise quickly validate
+		// the header and propagate the block if it passes
+		if f.relayEarly {
+			go f.broadcastBlock(block, true)
+		}
 		switch err := f.verifyHeader(block.Header()); err {
 		case nil:
 			// All ok, quickly propagate to our peers
-			go f.broadcastBlock(block, true)
+			if !f.relayEarly {
+				go f.broadcastBlock(block, true)
+			}
 
 		case consensus.ErrFutureBlock:
 			// Weird future block, don't fail, but neither propagate
@@ -825,7 +875,7 @@ func (f *BlockFetcher) importBlocks(peer string, block *types.Block) {
 		default:
 			// Something went very wrong, drop the peer
 			log.Debug("Propagated block verification failed", "peer", peer, "number", block.Number(), "hash", hash, "err", err)
-			f.dropPeer(peer)
+			f.dropPeer(peer, true)
 			return
 		}
 		// Run the actual import and log any issues
@@ -29,7 +29,9 @@ import (
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/core/txpool"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 )
 
 const (
@@ -143,6 +145,20 @@ type TxFetcher struct {
 	addTxs   func([]*types.Transaction) []error // Insert a batch of transactions into local txpool
 	fetchTxs func(string, []common.Hash) error  // Retrieves a set of txs from a remote peer
 
+	// Metrics, reported under the emulated node id
+	announceInMeter           *metrics.Counter
+	announceKnownMeter        *metrics.Counter
+	announceUnderpricedMeter  *metrics.Counter
+	broadcastInMeter          *metrics.Counter
+	broadcastKnownMeter       *metrics.Counter
+	broadcastUnderpricedMeter *metrics.Counter
+	broadcastOtherRejectMeter *metrics.Counter
+	replyInMeter              *metrics.Counter
+	replyKnownMeter           *metrics.Counter
+	replyUnderpricedMeter     *metrics.Counter
+	replyOtherRejectMeter     *metrics.Counter
+	requestOutMeter           *metrics.Counter
+
 	step  chan struct{} // Notification channel when the fetcher loop iterates
 	clock mclock.Clock  // Time wrapper to simulate in tests
 	rand  *mrand.Rand   // Randomizer to use in tests instead of map range loops (soft-random)
@@ -150,8 +166,8 @@ type TxFetcher struct {
 
 // NewTxFetcher creates a transaction fetcher to retrieve transaction
 // based on hash announcements.
-func NewTxFetcher(hasTx func(common.Hash) bool, addTxs func([]*types.Transaction) []error, fetchTxs func(string, []common.Hash) error) *TxFetcher {
-	return NewTxFetcherForTests(hasTx, addTxs, fetchTxs, mclock.System{}, nil)
+func NewTxFetcher(hasTx func(common.Hash) bool, addTxs func([]*types.Transaction) []error, fetchTxs func(string, []common.Hash) error, registry *metrics.Registry) *TxFetcher {
+	return newTxFetcher(hasTx, addTxs, fetchTxs, mclock.System{}, nil, registry)
 }
 
 // NewTxFetcherForTests is a testing method to mock out the realtime clock with
@@ -159,6 +175,12 @@ func NewTxFetcher(hasTx func(common.Hash) bool, addTxs func([]*types.Transaction
 func NewTxFetcherForTests(
 	hasTx func(common.Hash) bool, addTxs func([]*types.Transaction) []error, fetchTxs func(string, []common.Hash) error,
 	clock mclock.Clock, rand *mrand.Rand) *TxFetcher {
+	return newTxFetcher(hasTx, addTxs, fetchTxs, clock, rand, nil)
+}
+
+func newTxFetcher(
+	hasTx func(common.Hash) bool, addTxs func([]*types.Transaction) []error, fetchTxs func(string, []common.Hash) error,
+	clock mclock.Clock, rand *mrand.Rand, registry *metrics.Registry) *TxFetcher {
 	return &TxFetcher{
 		notify:      make(chan *txAnnounce),
 		cleanup:     make(chan *txDelivery),
@@ -178,6 +200,19 @@ func NewTxFetcherForTests(
 		fetchTxs:    fetchTxs,
 		clock:       clock,
 		rand:        rand,
+
+		announceInMeter:           registry.Counter("eth/fetcher/transaction/announces/in"),
+		announceKnownMeter:        registry.Counter("eth/fetcher/transaction/announces/known"),
+		announceUnderpricedMeter:  registry.Counter("eth/fetcher/transaction/announces/underpriced"),
+		broadcastInMeter:          registry.Counter("eth/fetcher/transaction/broadcasts/in"),
+		broadcastKnownMeter:       registry.Counter("eth/fetcher/transaction/broadcasts/known"),
+		broadcastUnderpricedMeter: registry.Counter("eth/fetcher/transaction/broadcasts/underpriced"),
+		broadcastOtherRejectMeter: registry.Counter("eth/fetcher/transaction/broadcasts/otherreject"),
+		replyInMeter:              registry.Counter("eth/fetcher/transaction/replies/in"),
+		replyKnownMeter:           registry.Counter("eth/fetcher/transaction/replies/known"),
+		replyUnderpricedMeter:     registry.Counter("eth/fetcher/transaction/replies/underpriced"),
+		replyOtherRejectMeter:     registry.Counter("eth/fetcher/transaction/replies/otherreject"),
+		requestOutMeter:           registry.Counter("eth/fetcher/transaction/request/out"),
 	}
 }
 
@@ -193,9 +228,13 @@ func (f *TxFetcher) Notify(peer string, hashes []common.Hash) error {
 		unknowns               = make([]common.Hash, 0, len(hashes))
 		duplicate, underpriced int64
 	)
+	f.announceInMeter.Inc(int64(len(hashes)))
 	for _, hash := range hashes {
+		known := f.hasTx(hash)
+		emu.RecordTxAnnouncement(hash, known)
+
 		switch {
-		case f.hasTx(hash):
+		case known:
 			duplicate++
 
 		case f.underpriced.Contains(hash):
@@ -205,6 +244,8 @@ func (f *TxFetcher) Notify(peer string, hashes []common.Hash) error {
 			unknowns = append(unknowns, hash)
 		}
 	}
+	f.announceKnownMeter.Inc(duplicate)
+	f.announceUnderpricedMeter.Inc(underpriced)
 
 	// If anything's left to announce, push it into the internal loop
 	if len(unknowns) == 0 {
@@ -229,6 +270,21 @@ func (f *TxFetcher) Notify(peer string, hashes []common.Hash) error {
 func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool) error {
 	// Push all the transactions into the pool, tracking underpriced ones to avoid
 	// re-requesting them and dropping the peer in case of malicious transfers.
+	var (
+		inMeter          = f.replyInMeter
+		knownMeter       = f.replyKnownMeter
+		underpricedMeter = f.replyUnderpricedMeter
+		otherRejectMeter = f.replyOtherRejectMeter
+	)
+	if !direct {
+		inMeter = f.broadcastInMeter
+		knownMeter = f.broadcastKnownMeter
+		underpricedMeter = f.broadcastUnderpricedMeter
+		otherRejectMeter = f.broadcastOtherRejectMeter
+	}
+	// Keep track of all the propagated transactions
+	inMeter.Inc(int64(len(txs)))
+
 	var (
 		added = make([]common.Hash, 0, len(txs))
 	)
@@ -245,6 +301,8 @@ func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool)
 		)
 		batch := txs[i:end]
 		for j, err := range f.addTxs(batch) {
+			emu.RecordTxDelivery(batch[j].Hash(), errors.Is(err, txpool.ErrAlreadyKnown))
+
 			// Track the transaction hash if the price is too low for us.
 			// Avoid re-request this transaction when we receive another
 			// announcement.
@@ -269,6 +327,9 @@ func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool)
 			}
 			added = append(added, batch[j].Hash())
 		}
+		knownMeter.Inc(duplicate)
+		underpricedMeter.Inc(underpriced)
+		otherRejectMeter.Inc(otherreject)
 
 		// If 'other reject' is >25% of the deliveries in any batch, sleep a bit.
 		if otherreject > 128/4 {
@@ -739,6 +800,7 @@ func (f *TxFetcher) scheduleFetches(timer *mclock.Timer, timeout chan struct{},
 		// If any hashes were allocated, request them from the peer
 		if len(hashes) > 0 {
 			f.requests[peer] = &txRequest{hashes: hashes, time: f.clock.Now()}
+			f.requestOutMeter.Inc(int64(len(hashes)))
 
 			go func(peer string, hashes []common.Hash) {
 				// Try to fetch the transactions, but in case of a request
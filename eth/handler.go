@@ -18,7 +18,6 @@ package eth
 
 import (
 	"errors"
-	"math"
 	"math/big"
 	"sync"
 	"sync/atomic"
@@ -36,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
 )
@@ -61,6 +61,10 @@ type txPool interface {
 	// tx hash.
 	Get(hash common.Hash) *types.Transaction
 
+	// GetShort retrieves the transaction from local txpool whose hash
+	// starts with the given compact block short ID.
+	GetShort(id uint64) *types.Transaction
+
 	// AddRemotes should add the given transactions to the pool.
 	AddRemotes([]*types.Transaction) []error
 
@@ -76,15 +80,18 @@ type txPool interface {
 // handlerConfig is the collection of initialization parameters to create a full
 // node network handler.
 type handlerConfig struct {
-	Database   ethdb.Database            // Database for direct sync insertions
-	Chain      *core.BlockChain          // Blockchain to serve data from
-	TxPool     txPool                    // Transaction pool to propagate from
-	Merger     *consensus.Merger         // The manager for eth1/2 transition
-	Network    uint64                    // Network identifier to adfvertise
-	Sync       downloader.SyncMode       // Whether to snap or full sync
-	BloomCache uint64                    // Megabytes to alloc for snap sync bloom
-	EventMux   *event.TypeMux            // Legacy event mux, deprecate for `feed`
-	Checkpoint *params.TrustedCheckpoint // Hard coded checkpoint for sync challenges
+	Database    ethdb.Database            // Database for direct sync insertions
+	Chain       *core.BlockChain          // Blockchain to serve data from
+	TxPool      txPool                    // Transaction pool to propagate from
+	Merger      *consensus.Merger         // The manager for eth1/2 transition
+	Network     uint64                    // Network identifier to adfvertise
+	Sync        downloader.SyncMode       // Whether to snap or full sync
+	BloomCache  uint64                    // Megabytes to alloc for snap sync bloom
+	EventMux    *event.TypeMux            // Legacy event mux, deprecate for `feed`
+	Checkpoint  *params.TrustedCheckpoint // Hard coded checkpoint for sync challenges
+	Metrics     *metrics.Registry         // Registry of the emulated node to report to
+	Propagate   BlockPropagationPolicy    // Policy selecting the peers to push blocks to
+	TxPropagate TxPropagationPolicy       // Policy selecting the peers to relay transactions to
 }
 
 type handler struct {
@@ -106,6 +113,8 @@ type handler struct {
 	txFetcher    *fetcher.TxFetcher
 	peers        *peerSet
 	merger       *consensus.Merger
+	propagate    BlockPropagationPolicy
+	txPropagate  TxPropagationPolicy
 
 	eventMux      *event.TypeMux
 	txsCh         chan core.NewTxsEvent
@@ -127,15 +136,26 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		config.EventMux = new(event.TypeMux) // Nicety initialization for tests
 	}
 	h := &handler{
-		networkID:  config.Network,
-		forkFilter: forkid.NewFilter(config.Chain),
-		eventMux:   config.EventMux,
-		database:   config.Database,
-		txpool:     config.TxPool,
-		chain:      config.Chain,
-		peers:      newPeerSet(),
-		merger:     config.Merger,
-		quitSync:   make(chan struct{}),
+		networkID:   config.Network,
+		forkFilter:  forkid.NewFilter(config.Chain),
+		eventMux:    config.EventMux,
+		database:    config.Database,
+		txpool:      config.TxPool,
+		chain:       config.Chain,
+		peers:       newPeerSet(),
+		merger:      config.Merger,
+		propagate:   config.Propagate,
+		txPropagate: config.TxPropagate,
+		quitSync:    make(chan struct{}),
+	}
+	if h.propagate == nil {
+		h.propagate = &sqrtPropagation{}
+	}
+	if h.txPropagate == nil {
+		h.txPropagate = &sqrtTxPropagation{}
+	}
+	if fluffer, ok := h.txPropagate.(txFluffer); ok {
+		fluffer.SetFluff(h.fluffTransaction)
 	}
 	// If we have trusted checkpoints, enforce them on the chain
 	if config.Checkpoint != nil {
@@ -157,7 +177,7 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		}
 	}
 	// Construct the downloader (long sync)
-	h.downloader = downloader.New(h.checkpointNumber, config.Database, h.eventMux, h.chain, nil, h.removePeer, success)
+	h.downloader = downloader.New(h.checkpointNumber, config.Database, h.eventMux, h.chain, nil, h.dropMisbehaving, success, config.Metrics)
 	if ttd := h.chain.Config().TerminalTotalDifficulty; ttd != nil {
 		if h.chain.Config().TerminalTotalDifficultyPassed {
 			log.Info("Chain post-merge, sync via beacon client")
@@ -248,7 +268,7 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		}
 		return n, err
 	}
-	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.removePeer)
+	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, h.propagate.RelayBeforeValidation(), heighter, nil, inserter, h.dropMisbehaving, config.Metrics)
 
 	fetchTx := func(peer string, hashes []common.Hash) error {
 		p := h.peers.peer(peer)
@@ -257,7 +277,7 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		}
 		return p.RequestTxs(hashes)
 	}
-	h.txFetcher = fetcher.NewTxFetcher(h.txpool.Has, h.txpool.AddRemotes, fetchTx)
+	h.txFetcher = fetcher.NewTxFetcher(h.txpool.Has, h.txpool.AddRemotes, fetchTx, config.Metrics)
 	h.chainSync = newChainSyncer(h)
 	return h, nil
 }
@@ -438,8 +458,9 @@ func (h *handler) Stop() {
 	log.Info("Ethereum protocol stopped")
 }
 
-// BroadcastBlock will either propagate a block to a subset of its peers, or
-// will only announce its availability (depending what's requested).
+// BroadcastBlock will either propagate a block to the peers selected by the
+// block propagation policy, or will only announce its availability (depending
+// what's requested).
 func (h *handler) BroadcastBlock(block *types.Block, propagate bool) {
 	// Disable the block propagation if the chain has already entered the PoS
 	// stage. The block propagation is delegated to the consensus layer.
@@ -465,12 +486,12 @@ func (h *handler) BroadcastBlock(block *types.Block, propagate bool) {
 			log.Error("Propagating dangling block", "number", block.Number(), "hash", hash)
 			return
 		}
-		// Send the block to a subset of our peers
-		transfer := peers[:int(math.Sqrt(float64(len(peers))))]
+		// Send the block to the peers chosen by the policy
+		transfer := h.propagate.Push(block, peers)
 		for _, peer := range transfer {
 			peer.AsyncSendNewBlock(block, td)
 		}
-		log.Trace("Propagated block", "hash", hash, "recipients", len(transfer), "duration", common.PrettyDuration(time.Since(block.ReceivedAt)))
+		log.Trace("Propagated block", "hash", hash, "policy", h.propagate.Name(), "recipients", len(transfer), "duration", common.PrettyDuration(time.Since(block.ReceivedAt)))
 		return
 	}
 	// Otherwise if the block is indeed in out own chain, announce it
@@ -482,10 +503,9 @@ func (h *handler) BroadcastBlock(block *types.Block, propagate bool) {
 	}
 }
 
-// BroadcastTransactions will propagate a batch of transactions
-// - To a square root of all peers
-// - And, separately, as announcements to all peers which are not known to
-// already have the given transaction.
+// BroadcastTransactions will propagate a batch of transactions to the peers
+// selected by the transaction propagation policy, either directly or as
+// announcements.
 func (h *handler) BroadcastTransactions(txs types.Transactions) {
 	var (
 		annoCount   int // Count of announcements made
@@ -499,14 +519,11 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 	)
 	// Broadcast transactions to a batch of peers not knowing about it
 	for _, tx := range txs {
-		peers := h.peers.peersWithoutTransaction(tx.Hash())
-		// Send the tx unconditionally to a subset of our peers
-		numDirect := int(math.Sqrt(float64(len(peers))))
-		for _, peer := range peers[:numDirect] {
+		direct, announce := h.txPropagate.Broadcast(tx, h.peers.peersWithoutTransaction(tx.Hash()))
+		for _, peer := range direct {
 			txset[peer] = append(txset[peer], tx.Hash())
 		}
-		// For the remaining peers, send announcement only
-		for _, peer := range peers[numDirect:] {
+		for _, peer := range announce {
 			annos[peer] = append(annos[peer], tx.Hash())
 		}
 	}
@@ -520,11 +537,26 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 		annoCount += len(hashes)
 		peer.AsyncSendPooledTransactionHashes(hashes)
 	}
-	log.Debug("Transaction broadcast", "txs", len(txs),
+	log.Debug("Transaction broadcast", "txs", len(txs), "policy", h.txPropagate.Name(),
 		"announce packs", annoPeers, "announced hashes", annoCount,
 		"tx packs", directPeers, "broadcast txs", directCount)
 }
 
+// fluffTransaction diffuses a transaction the propagation policy held back, as
+// long as it is still pending and the handler running.
+func (h *handler) fluffTransaction(tx *types.Transaction) {
+	select {
+	case <-h.quitSync:
+		return
+	default:
+	}
+	if h.txpool.Get(tx.Hash()) == nil {
+		return
+	}
+	log.Debug("Diffusing embargoed transaction", "hash", tx.Hash())
+	h.BroadcastTransactions(types.Transactions{tx})
+}
+
 // minedBroadcastLoop sends mined blocks to connected peers.
 func (h *handler) minedBroadcastLoop() {
 	defer h.wg.Done()
@@ -537,6 +569,29 @@ func (h *handler) minedBroadcastLoop() {
 	}
 }
 
+// importDecided inserts a block the BFT agreement decided without the local
+// miner sealing it, and relays it like a mined one.
+func (h *handler) importDecided(block *types.Block) {
+	if h.chain.HasBlock(block.Hash(), block.NumberU64()) {
+		return
+	}
+	if _, err := h.chain.InsertChain(types.Blocks{block}); err != nil {
+		// A node lagging behind lacks the parent, leave the block to the fetcher
+		// which imports it once the chain caught up
+		if errors.Is(err, consensus.ErrUnknownAncestor) {
+			if err := h.blockFetcher.Enqueue("", block); err != nil {
+				log.Warn("Failed to queue decided block", "number", block.Number(), "hash", block.Hash(), "err", err)
+			}
+			return
+		}
+		// Otherwise the local chain rejects what a quorum of validators agreed on
+		log.Error("Local chain rejected decided block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		return
+	}
+	h.BroadcastBlock(block, true)
+	h.BroadcastBlock(block, false)
+}
+
 // txBroadcastLoop announces new transactions to connected peers.
 func (h *handler) txBroadcastLoop() {
 	defer h.wg.Done()
@@ -67,6 +67,9 @@ func (h *ethHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 	case *eth.NewBlockPacket:
 		return h.handleBlockBroadcast(peer, packet.Block, packet.TD)
 
+	case *eth.NewCompactBlockPacket:
+		return h.handleCompactBlockBroadcast(peer, packet)
+
 	case *eth.NewPooledTransactionHashesPacket66:
 		return h.txFetcher.Notify(peer.ID(), *packet)
 
@@ -74,9 +77,17 @@ func (h *ethHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 		return h.txFetcher.Notify(peer.ID(), packet.Hashes)
 
 	case *eth.TransactionsPacket:
+		h.rewardTxs(peer, *packet)
+		if receiver, ok := h.txPropagate.(txReceiver); ok {
+			receiver.Received(peer, *packet)
+		}
 		return h.txFetcher.Enqueue(peer.ID(), *packet, false)
 
 	case *eth.PooledTransactionsPacket:
+		h.rewardTxs(peer, *packet)
+		if receiver, ok := h.txPropagate.(txReceiver); ok {
+			receiver.Received(peer, *packet)
+		}
 		return h.txFetcher.Enqueue(peer.ID(), *packet, true)
 
 	default:
@@ -124,18 +135,73 @@ func (h *ethHandler) handleBlockBroadcast(peer *eth.Peer, block *types.Block, td
 		// return errors.New("unexpected block announces")
 	}
 	// Schedule the block for import
+	h.rewardBlock(peer, block.Hash(), block.NumberU64())
 	h.blockFetcher.Enqueue(peer.ID(), block)
 
+	h.updatePeerHead(peer, block.Header(), td)
+	return nil
+}
+
+// handleCompactBlockBroadcast is invoked from a peer's message handler when it
+// transmits a compact block broadcast for the local node to rebuild and process.
+func (h *ethHandler) handleCompactBlockBroadcast(peer *eth.Peer, compact *eth.NewCompactBlockPacket) error {
+	if h.merger.PoSFinalized() {
+		return nil
+	}
+	// Schedule the block for reconstruction, falling back to retrieving it like
+	// an announced block if that fails
+	header := compact.Header
+	h.rewardBlock(peer, header.Hash(), header.Number.Uint64())
+	fallback := func() {
+		h.blockFetcher.Notify(peer.ID(), header.Hash(), header.Number.Uint64(), time.Now(), peer.RequestOneHeader, peer.RequestBodies)
+	}
+	h.blockFetcher.EnqueueCompact(peer.ID(), compact, h.lookupShortTxIDs, peer.RequestBlockTxs, fallback)
+
+	h.updatePeerHead(peer, header, compact.TD)
+	return nil
+}
+
+// rewardBlock credits a peer for broadcasting a block not yet known locally.
+func (h *ethHandler) rewardBlock(peer *eth.Peer, hash common.Hash, number uint64) {
+	if p := h.peers.peer(peer.ID()); p != nil && !h.chain.HasBlock(hash, number) {
+		p.scores.blocks.Add(1)
+	}
+}
+
+// rewardTxs credits a peer for every delivered transaction not yet pooled.
+func (h *ethHandler) rewardTxs(peer *eth.Peer, txs []*types.Transaction) {
+	p := h.peers.peer(peer.ID())
+	if p == nil {
+		return
+	}
+	for _, tx := range txs {
+		if !h.txpool.Has(tx.Hash()) {
+			p.scores.txs.Add(1)
+		}
+	}
+}
+
+// lookupShortTxIDs resolves the short IDs of a compact block against the
+// transactions of the pool.
+func (h *ethHandler) lookupShortTxIDs(ids []uint64) []*types.Transaction {
+	txs := make([]*types.Transaction, len(ids))
+	for i, id := range ids {
+		txs[i] = h.txpool.GetShort(id)
+	}
+	return txs
+}
+
+// updatePeerHead raises the head of a peer which propagated the given block.
+func (h *ethHandler) updatePeerHead(peer *eth.Peer, header *types.Header, td *big.Int) {
 	// Assuming the block is importable by the peer, but possibly not yet done so,
 	// calculate the head hash and TD that the peer truly must have.
 	var (
-		trueHead = block.ParentHash()
-		trueTD   = new(big.Int).Sub(td, block.Difficulty())
+		trueHead = header.ParentHash
+		trueTD   = new(big.Int).Sub(td, header.Difficulty)
 	)
 	// Update the peer's total difficulty if better than the previous
 	if _, td := peer.Head(); trueTD.Cmp(td) > 0 {
 		peer.SetHead(trueHead, trueTD)
 		h.chainSync.handlePeerEvent(peer)
 	}
-	return nil
 }
@@ -23,17 +23,23 @@ import (
 // ethPeerInfo represents a short summary of the `eth` sub-protocol metadata known
 // about a connected peer.
 type ethPeerInfo struct {
-	Version uint `json:"version"` // Ethereum protocol version negotiated
+	Version uint         `json:"version"` // Ethereum protocol version negotiated
+	Traffic *eth.Traffic `json:"traffic"` // Messages exchanged by kind
+	Score   *PeerScore   `json:"score"`   // Rating of the peer by its deliveries
 }
 
 // ethPeer is a wrapper around eth.Peer to maintain a few extra metadata.
 type ethPeer struct {
 	*eth.Peer
+
+	scores *peerScore // Deliveries counting towards the score of the peer
 }
 
 // info gathers and returns some `eth` protocol metadata known about a peer.
 func (p *ethPeer) info() *ethPeerInfo {
 	return &ethPeerInfo{
 		Version: p.Version(),
+		Traffic: p.Traffic(),
+		Score:   p.score(),
 	}
 }
@@ -0,0 +1,110 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// Weights of the events making up the score of a peer. A newly connected peer
+// scores zero, so peers only fall below newcomers by misbehaving.
+const (
+	blockDeliveryReward = 10.0 // Block broadcast before it was known locally
+	txDeliveryReward    = 0.1  // Transaction sent before it was known to the pool
+	responseReward      = 1.0  // Request answered before timing out
+	timeoutPenalty      = 5.0  // Request left without an answer
+	unsolicitedPenalty  = 10.0 // Response to an unknown request
+	invalidBlockPenalty = 50.0 // Block failing validation or import
+)
+
+// peerScore counts the deliveries of a peer which the eth handler observes. The
+// request outcomes of the current connection are counted by the protocol peer
+// itself, and only settled here once it disconnects, so that a peer cannot shed
+// its score by reconnecting.
+type peerScore struct {
+	blocks  atomic.Uint64 // Blocks delivered before they were known locally
+	txs     atomic.Uint64 // Transactions delivered before they were pooled
+	invalid atomic.Uint64 // Invalid blocks delivered
+
+	responses   atomic.Uint64 // Requests answered on past connections
+	timeouts    atomic.Uint64 // Requests left unanswered on past connections
+	unsolicited atomic.Uint64 // Unrequested responses on past connections
+}
+
+// settle adds the request outcomes of a closed connection.
+func (s *peerScore) settle(responses, timeouts, unsolicited uint64) {
+	s.responses.Add(responses)
+	s.timeouts.Add(timeouts)
+	s.unsolicited.Add(unsolicited)
+}
+
+// PeerScore is the rating of a peer along with the events it is made of.
+type PeerScore struct {
+	Score       float64 `json:"score"`
+	Blocks      uint64  `json:"blocks"`
+	Txs         uint64  `json:"txs"`
+	Responses   uint64  `json:"responses"`
+	Timeouts    uint64  `json:"timeouts"`
+	Unsolicited uint64  `json:"unsolicited"`
+	Invalid     uint64  `json:"invalid"`
+}
+
+// score rates the peer by its useful deliveries and misbehaviour so far.
+func (p *ethPeer) score() *PeerScore {
+	return p.scores.rate(p.RequestStats())
+}
+
+// rate rates a peer by its deliveries and past request outcomes, along with the
+// request outcomes of its current connection.
+func (s *peerScore) rate(responses, timeouts, unsolicited uint64) *PeerScore {
+	r := &PeerScore{
+		Blocks:      s.blocks.Load(),
+		Txs:         s.txs.Load(),
+		Responses:   s.responses.Load() + responses,
+		Timeouts:    s.timeouts.Load() + timeouts,
+		Unsolicited: s.unsolicited.Load() + unsolicited,
+		Invalid:     s.invalid.Load(),
+	}
+	r.Score = blockDeliveryReward*float64(r.Blocks) +
+		txDeliveryReward*float64(r.Txs) +
+		responseReward*float64(r.Responses) -
+		timeoutPenalty*float64(r.Timeouts) -
+		unsolicitedPenalty*float64(r.Unsolicited) -
+		invalidBlockPenalty*float64(r.Invalid)
+	return r
+}
+
+// scorePeer rates a p2p peer for eviction, peers never seen on eth scoring like
+// newcomers.
+func (h *handler) scorePeer(p *p2p.Peer) float64 {
+	if score := h.peers.score(p.ID().String()); score != nil {
+		return score.Score
+	}
+	return 0
+}
+
+// dropMisbehaving requests the disconnection of a peer the sync or the block
+// fetcher gave up on, penalising it if it delivered data failing validation
+// rather than stalling or timing out, which its request outcomes already count.
+func (h *handler) dropMisbehaving(id string, invalid bool) {
+	if peer := h.peers.peer(id); peer != nil && invalid {
+		peer.scores.invalid.Add(1)
+	}
+	h.removePeer(id)
+}
@@ -43,7 +43,8 @@ var (
 // peerSet represents the collection of active peers currently participating in
 // the `eth` protocol, with or without the `snap` extension.
 type peerSet struct {
-	peers map[string]*ethPeer // Peers connected on the `eth` protocol
+	peers  map[string]*ethPeer   // Peers connected on the `eth` protocol
+	scores map[string]*peerScore // Scores of all peers seen, kept across reconnects
 
 	lock   sync.RWMutex
 	closed bool
@@ -52,7 +53,8 @@ type peerSet struct {
 // newPeerSet creates a new peer set to track the active participants.
 func newPeerSet() *peerSet {
 	return &peerSet{
-		peers: make(map[string]*ethPeer),
+		peers:  make(map[string]*ethPeer),
+		scores: make(map[string]*peerScore),
 	}
 }
 
@@ -70,8 +72,14 @@ func (ps *peerSet) registerPeer(peer *eth.Peer) error {
 	if _, ok := ps.peers[id]; ok {
 		return errPeerAlreadyRegistered
 	}
+	scores := ps.scores[id]
+	if scores == nil {
+		scores = new(peerScore)
+		ps.scores[id] = scores
+	}
 	eth := &ethPeer{
-		Peer: peer,
+		Peer:   peer,
+		scores: scores,
 	}
 	ps.peers[id] = eth
 	return nil
@@ -83,10 +91,11 @@ func (ps *peerSet) unregisterPeer(id string) error {
 	ps.lock.Lock()
 	defer ps.lock.Unlock()
 
-	_, ok := ps.peers[id]
+	peer, ok := ps.peers[id]
 	if !ok {
 		return errPeerNotRegistered
 	}
+	peer.scores.settle(peer.RequestStats())
 	delete(ps.peers, id)
 	return nil
 }
@@ -99,6 +108,21 @@ func (ps *peerSet) peer(id string) *ethPeer {
 	return ps.peers[id]
 }
 
+// score retrieves the score of the peer with the given id, whether connected or
+// not, or nil if it was never registered.
+func (ps *peerSet) score(id string) *PeerScore {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	if peer := ps.peers[id]; peer != nil {
+		return peer.score()
+	}
+	if scores := ps.scores[id]; scores != nil {
+		return scores.rate(0, 0, 0)
+	}
+	return nil
+}
+
 // peersWithoutBlock retrieves a list of peers that do not have a given block in
 // their set of known hashes so it might be propagated to them.
 func (ps *peerSet) peersWithoutBlock(hash common.Hash) []*ethPeer {
@@ -0,0 +1,412 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+)
+
+// BlockPropagationPolicies lists the block propagation policies selectable by
+// name, k:<n> taking the number of peers to push to.
+var BlockPropagationPolicies = []string{"sqrt", "all", "k:<n>", "announce", "early", "tree"}
+
+// BlockPropagationPolicy decides how a node relays new blocks to its peers. The
+// chosen peers are pushed the full block, all others still unaware of it are
+// announced its hash once it is imported.
+type BlockPropagationPolicy interface {
+	// Name identifies the policy, e.g. in the block log.
+	Name() string
+
+	// Push selects the peers to send the full block to, out of the peers not
+	// known to have it yet.
+	Push(block *types.Block, peers []*ethPeer) []*ethPeer
+
+	// RelayBeforeValidation reports whether blocks propagated by peers are
+	// pushed on as soon as they arrive, before their header is verified.
+	// Otherwise they are pushed on after header verification, but still before
+	// their import.
+	RelayBeforeValidation() bool
+}
+
+// newBlockPropagationPolicy creates the block propagation policy of the given
+// name for the emulated node with the given identity. An empty name selects the
+// default square root policy.
+func newBlockPropagationPolicy(name string, id int) (BlockPropagationPolicy, error) {
+	switch {
+	case name == "" || name == "sqrt":
+		return &sqrtPropagation{}, nil
+	case name == "all":
+		return &pushAllPropagation{}, nil
+	case name == "announce":
+		return &announcePropagation{}, nil
+	case name == "early":
+		return &sqrtPropagation{early: true}, nil
+	case name == "tree":
+		return newTreePropagation(id)
+	case strings.HasPrefix(name, "k:"):
+		k, err := strconv.Atoi(strings.TrimPrefix(name, "k:"))
+		if err != nil || k < 0 {
+			return nil, fmt.Errorf("invalid block propagation fanout %q", name)
+		}
+		return &pushKPropagation{k: k}, nil
+	}
+	return nil, fmt.Errorf("unknown block propagation policy %q (%s)", name, strings.Join(BlockPropagationPolicies, ", "))
+}
+
+// sqrtPropagation pushes blocks to the square root of the peers, the upstream
+// behaviour. Its early variant relays before validation.
+type sqrtPropagation struct {
+	early bool
+}
+
+func (p *sqrtPropagation) Name() string {
+	if p.early {
+		return "early"
+	}
+	return "sqrt"
+}
+
+func (p *sqrtPropagation) Push(block *types.Block, peers []*ethPeer) []*ethPeer {
+	return peers[:int(math.Sqrt(float64(len(peers))))]
+}
+
+func (p *sqrtPropagation) RelayBeforeValidation() bool { return p.early }
+
+// pushAllPropagation pushes blocks to all peers, leaving none to announce to.
+type pushAllPropagation struct{}
+
+func (p *pushAllPropagation) Name() string { return "all" }
+
+func (p *pushAllPropagation) Push(block *types.Block, peers []*ethPeer) []*ethPeer {
+	return peers
+}
+
+func (p *pushAllPropagation) RelayBeforeValidation() bool { return false }
+
+// pushKPropagation pushes blocks to a fixed number of peers.
+type pushKPropagation struct {
+	k int
+}
+
+func (p *pushKPropagation) Name() string { return "k:" + strconv.Itoa(p.k) }
+
+func (p *pushKPropagation) Push(block *types.Block, peers []*ethPeer) []*ethPeer {
+	if len(peers) > p.k {
+		return peers[:p.k]
+	}
+	return peers
+}
+
+func (p *pushKPropagation) RelayBeforeValidation() bool { return false }
+
+// announcePropagation never pushes blocks, peers have to fetch them after the
+// announcement.
+type announcePropagation struct{}
+
+func (p *announcePropagation) Name() string { return "announce" }
+
+func (p *announcePropagation) Push(block *types.Block, peers []*ethPeer) []*ethPeer {
+	return nil
+}
+
+func (p *announcePropagation) RelayBeforeValidation() bool { return false }
+
+// treePropagation pushes blocks along a spanning tree of the static topology,
+// which all nodes precompute identically. As the tree is undirected, a block
+// flooded along it reaches every node once regardless of its origin. Peers off
+// the tree only receive announcements, which recover from missing tree links.
+type treePropagation struct {
+	neighbours map[common.Address]bool // Neighbours of the node in the tree
+}
+
+func newTreePropagation(id int) (BlockPropagationPolicy, error) {
+	var self *emu.Node
+	for _, node := range emu.Global.Nodes {
+		if node.Identity == uint64(id) {
+			self = node
+		}
+	}
+	if self == nil {
+		return nil, fmt.Errorf("tree block propagation: node %d not in the emulator config", id)
+	}
+	neighbours := make(map[common.Address]bool)
+	for _, addr := range emu.SpanningTree()[self.Address] {
+		neighbours[addr] = true
+	}
+	return &treePropagation{neighbours: neighbours}, nil
+}
+
+func (p *treePropagation) Name() string { return "tree" }
+
+func (p *treePropagation) Push(block *types.Block, peers []*ethPeer) []*ethPeer {
+	var push []*ethPeer
+	for _, peer := range peers {
+		if addr, ok := emu.NodeAddress(peer.Peer.Peer.ID()); ok && p.neighbours[addr] {
+			push = append(push, peer)
+		}
+	}
+	return push
+}
+
+func (p *treePropagation) RelayBeforeValidation() bool { return false }
+
+// TxPropagationPolicies lists the transaction propagation policies selectable
+// by name, fanout:<n> taking the number of peers to send to and dandelion:<n>
+// the length of the stem.
+var TxPropagationPolicies = []string{"sqrt", "flood", "announce", "fanout:<n>", "dandelion:<n>"}
+
+// TxPropagationPolicy decides how a node relays new transactions to its peers.
+type TxPropagationPolicy interface {
+	// Name identifies the policy.
+	Name() string
+
+	// Broadcast selects the peers to send a transaction to in full and the
+	// peers to announce its hash to, out of the peers not known to have it yet.
+	Broadcast(tx *types.Transaction, peers []*ethPeer) (direct, announce []*ethPeer)
+}
+
+// txReceiver is implemented by transaction propagation policies which need to
+// know which peer delivered a transaction in full.
+type txReceiver interface {
+	// Received is called with the transactions a peer sent in full.
+	Received(peer *eth.Peer, txs []*types.Transaction)
+}
+
+// txFluffer is implemented by transaction propagation policies which may hold
+// transactions back and need to diffuse them later on their own.
+type txFluffer interface {
+	// SetFluff injects the function diffusing a transaction to the peers.
+	SetFluff(fluff func(tx *types.Transaction))
+}
+
+// newTxPropagationPolicy creates the transaction propagation policy of the
+// given name for the node with the given identity. An empty name selects the
+// default square root policy.
+func newTxPropagationPolicy(name string, id int) (TxPropagationPolicy, error) {
+	switch {
+	case name == "" || name == "sqrt":
+		return &sqrtTxPropagation{}, nil
+	case name == "flood":
+		return &floodTxPropagation{}, nil
+	case name == "announce":
+		return &announceTxPropagation{}, nil
+	case strings.HasPrefix(name, "fanout:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "fanout:"))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid tx propagation fanout %q", name)
+		}
+		return &fanoutTxPropagation{n: n}, nil
+	case strings.HasPrefix(name, "dandelion:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "dandelion:"))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid tx propagation stem length %q", name)
+		}
+		return &dandelionTxPropagation{
+			self:     uint64(id),
+			stem:     n,
+			hops:     lru.NewBasicLRU[common.Hash, int](maxStemTxs),
+			embargos: make(map[common.Hash]*time.Timer),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown tx propagation policy %q (%s)", name, strings.Join(TxPropagationPolicies, ", "))
+}
+
+// sqrtTxPropagation sends transactions to the square root of the peers and
+// announces them to the rest, the upstream behaviour.
+type sqrtTxPropagation struct{}
+
+func (p *sqrtTxPropagation) Name() string { return "sqrt" }
+
+func (p *sqrtTxPropagation) Broadcast(tx *types.Transaction, peers []*ethPeer) ([]*ethPeer, []*ethPeer) {
+	numDirect := int(math.Sqrt(float64(len(peers))))
+	return peers[:numDirect], peers[numDirect:]
+}
+
+// floodTxPropagation sends transactions to all peers.
+type floodTxPropagation struct{}
+
+func (p *floodTxPropagation) Name() string { return "flood" }
+
+func (p *floodTxPropagation) Broadcast(tx *types.Transaction, peers []*ethPeer) ([]*ethPeer, []*ethPeer) {
+	return peers, nil
+}
+
+// announceTxPropagation only announces transactions, which eth/68 peers receive
+// along with their types and sizes.
+type announceTxPropagation struct{}
+
+func (p *announceTxPropagation) Name() string { return "announce" }
+
+func (p *announceTxPropagation) Broadcast(tx *types.Transaction, peers []*ethPeer) ([]*ethPeer, []*ethPeer) {
+	return nil, peers
+}
+
+// fanoutTxPropagation sends transactions to a fixed number of random peers,
+// without announcing them to the rest.
+type fanoutTxPropagation struct {
+	n int
+}
+
+func (p *fanoutTxPropagation) Name() string { return "fanout:" + strconv.Itoa(p.n) }
+
+func (p *fanoutTxPropagation) Broadcast(tx *types.Transaction, peers []*ethPeer) ([]*ethPeer, []*ethPeer) {
+	if len(peers) <= p.n {
+		return peers, nil
+	}
+	direct := make([]*ethPeer, 0, p.n)
+	for _, i := range rand.Perm(len(peers))[:p.n] {
+		direct = append(direct, peers[i])
+	}
+	return direct, nil
+}
+
+// maxStemTxs is the number of most recent transactions a dandelion node keeps
+// the stem state of.
+const maxStemTxs = 65536
+
+// stemEmbargo is the least time a dandelion node waits for a transaction it
+// relayed along the stem to come back diffused, before diffusing it itself.
+// Each node adds a random exponential delay averaging stemEmbargoJitter, so
+// that the node fluffing a transaction lost on the stem varies.
+const (
+	stemEmbargo       = 10 * time.Second
+	stemEmbargoJitter = 5 * time.Second
+)
+
+// stemMark addresses the stem flag of a transaction to the node receiving it
+// from a given sender.
+type stemMark struct {
+	from, to uint64 // Identities of the sending and receiving node
+	tx       common.Hash
+}
+
+// stemMarks stands in for the flag Dandelion carries on the wire with stem
+// transactions, holding the hops left on the stem. A mark is only read by the
+// node it is addressed to, when the transaction arrives from the marking peer,
+// so a node learns no more than the message would tell it.
+var stemMarks = lru.NewCache[stemMark, int](maxStemTxs)
+
+// dandelionTxPropagation relays new transactions along a stem of single random
+// peers first, then diffuses them from the end of the stem like the square root
+// policy. Transactions submitted to the node start a new stem, those arriving
+// outside a stem are diffused right away.
+//
+// As the fail-safe of Dandelion++, every node relaying a transaction along the
+// stem embargoes it, and diffuses it itself if no peer sent it back outside the
+// stem once the embargo ends, in case a later stem node dropped it.
+type dandelionTxPropagation struct {
+	self uint64 // Identity of the node
+	stem int
+
+	hops     lru.BasicLRU[common.Hash, int] // Remaining stem hops of known transactions, zero once fluffed
+	embargos map[common.Hash]*time.Timer    // Timers diffusing stem transactions not seen back
+	fluff    func(tx *types.Transaction)    // Diffuses a transaction whose embargo ended
+	lock     sync.Mutex
+}
+
+func (p *dandelionTxPropagation) Name() string { return "dandelion:" + strconv.Itoa(p.stem) }
+
+// SetFluff injects the function diffusing transactions whose embargo ended.
+func (p *dandelionTxPropagation) SetFluff(fluff func(tx *types.Transaction)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.fluff = fluff
+}
+
+// Received records how many stem hops are left for transactions arriving on a
+// stem, and that all others are already being diffused, lifting the embargo on
+// those the node relayed along the stem itself.
+func (p *dandelionTxPropagation) Received(peer *eth.Peer, txs []*types.Transaction) {
+	from, _ := emu.NodeIdentity(peer.Peer.ID())
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, tx := range txs {
+		mark := stemMark{from: from, to: p.self, tx: tx.Hash()}
+		hops, ok := stemMarks.Get(mark)
+		if ok {
+			stemMarks.Remove(mark)
+		} else if timer, ok := p.embargos[tx.Hash()]; ok {
+			timer.Stop()
+			delete(p.embargos, tx.Hash())
+		}
+		if !p.hops.Contains(tx.Hash()) {
+			p.hops.Add(tx.Hash(), hops)
+		}
+	}
+}
+
+func (p *dandelionTxPropagation) Broadcast(tx *types.Transaction, peers []*ethPeer) ([]*ethPeer, []*ethPeer) {
+	p.lock.Lock()
+	hops, ok := p.hops.Get(tx.Hash())
+	if !ok {
+		hops = p.stem
+	}
+	p.hops.Add(tx.Hash(), 0)
+	p.lock.Unlock()
+
+	if hops > 0 && len(peers) > 0 {
+		next := peers[rand.Intn(len(peers))]
+		if to, ok := emu.NodeIdentity(next.Peer.Peer.ID()); ok {
+			stemMarks.Add(stemMark{from: p.self, to: to, tx: tx.Hash()}, hops-1)
+		}
+		p.embargo(tx)
+		return []*ethPeer{next}, nil
+	}
+	numDirect := int(math.Sqrt(float64(len(peers))))
+	return peers[:numDirect], peers[numDirect:]
+}
+
+// embargo starts the timer diffusing a transaction relayed along the stem,
+// unless one is already running or there is no way to diffuse it.
+func (p *dandelionTxPropagation) embargo(tx *types.Transaction) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hash := tx.Hash()
+	if p.fluff == nil || p.embargos[hash] != nil {
+		return
+	}
+	delay := stemEmbargo + time.Duration(rand.ExpFloat64()*float64(stemEmbargoJitter))
+	p.embargos[hash] = time.AfterFunc(delay, func() {
+		p.lock.Lock()
+		if _, ok := p.embargos[hash]; !ok {
+			p.lock.Unlock()
+			return // Seen back while the timer fired
+		}
+		delete(p.embargos, hash)
+		p.hops.Add(hash, 0)
+		fluff := p.fluff
+		p.lock.Unlock()
+
+		fluff(tx)
+	})
+}
@@ -19,6 +19,7 @@ package eth
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/p2p"
@@ -114,6 +115,13 @@ type response struct {
 	fail chan error
 }
 
+// requestStats counts the outcomes of the requests sent to a peer.
+type requestStats struct {
+	responses   atomic.Uint64 // Responses arriving before their request timed out
+	timeouts    atomic.Uint64 // Requests timing out without a response
+	unsolicited atomic.Uint64 // Responses to unknown requests or of the wrong type
+}
+
 // dispatchRequest schedules the request to the dispatcher for tracking and
 // network serialization, blocking until it's successfully sent.
 //
@@ -199,6 +207,7 @@ func (p *Peer) dispatcher() {
 
 			if err == nil {
 				pending[req.id] = req
+				p.tracker.Track(p.id, p.version, req.code, req.want, req.id)
 			}
 
 		case cancelOp := <-p.reqCancel:
@@ -209,8 +218,10 @@ func (p *Peer) dispatcher() {
 				cancelOp.fail <- nil
 				continue
 			}
-			// Stop tracking the request
+			// Stop tracking the request, so that it does not time out on
+			// the peer
 			delete(pending, cancelOp.id)
+			p.tracker.Untrack(p.id, cancelOp.id)
 			cancelOp.fail <- nil
 
 		case resOp := <-p.resDispatch:
@@ -219,9 +230,9 @@ func (p *Peer) dispatcher() {
 
 			switch {
 			case res.Req == nil:
-				// Response arrived with an untracked ID. Since even cancelled
-				// requests are tracked until fulfilment, a dangling response
-				// means the remote peer implements the protocol badly.
+				// Response arrived with an untracked ID, either never requested
+				// or arriving after the request was cancelled.
+				p.requests.unsolicited.Add(1)
 				resOp.fail <- errDanglingResponse
 
 			case res.Req.want != res.code:
@@ -229,6 +240,7 @@ func (p *Peer) dispatcher() {
 				// one expected by the requester. Either the local code is bad,
 				// or the remote peer send junk. In neither cases can we handle
 				// the packet.
+				p.requests.unsolicited.Add(1)
 				resOp.fail <- fmt.Errorf("%w: have %d, want %d", errMismatchingResponseType, res.code, res.Req.want)
 
 			default:
@@ -236,6 +248,9 @@ func (p *Peer) dispatcher() {
 				// with the matching request. Signal to the delivery routine that
 				// it can wait for a handler response and dispatch the data.
 				res.Time = res.recv.Sub(res.Req.Sent)
+				if p.tracker.Fulfil(p.id, p.version, res.code, res.id) {
+					p.requests.responses.Add(1)
+				}
 				resOp.fail <- nil
 
 				// Stop tracking the request, the response dispatcher will deliver
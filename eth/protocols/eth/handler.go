@@ -93,10 +93,14 @@ type TxPool interface {
 	Get(hash common.Hash) *types.Transaction
 }
 
-// MakeProtocols constructs the P2P protocol definitions for `eth`.
-func MakeProtocols(backend Backend, network uint64) []p2p.Protocol {
-	protocols := make([]p2p.Protocol, len(ProtocolVersions))
-	for i, version := range ProtocolVersions {
+// MakeProtocols constructs the P2P protocol definitions for `eth` in the given
+// versions, all of ProtocolVersions if none are given.
+func MakeProtocols(backend Backend, network uint64, versions []uint) []p2p.Protocol {
+	if len(versions) == 0 {
+		versions = ProtocolVersions
+	}
+	protocols := make([]p2p.Protocol, len(versions))
+	for i, version := range versions {
 		version := version // Closure
 
 		protocols[i] = p2p.Protocol{
@@ -212,6 +216,24 @@ var eth68 = map[uint64]msgHandler{
 	PooledTransactionsMsg:         handlePooledTransactions66,
 }
 
+var eth69 = map[uint64]msgHandler{
+	NewBlockHashesMsg:             handleNewBlockhashes,
+	NewBlockMsg:                   handleNewBlock,
+	TransactionsMsg:               handleTransactions,
+	NewPooledTransactionHashesMsg: handleNewPooledTransactionHashes68,
+	GetBlockHeadersMsg:            handleGetBlockHeaders66,
+	BlockHeadersMsg:               handleBlockHeaders66,
+	GetBlockBodiesMsg:             handleGetBlockBodies66,
+	BlockBodiesMsg:                handleBlockBodies66,
+	GetReceiptsMsg:                handleGetReceipts66,
+	ReceiptsMsg:                   handleReceipts66,
+	GetPooledTransactionsMsg:      handleGetPooledTransactions66,
+	PooledTransactionsMsg:         handlePooledTransactions66,
+	NewCompactBlockMsg:            handleNewCompactBlock,
+	GetBlockTxsMsg:                handleGetBlockTxs69,
+	BlockTxsMsg:                   handleBlockTxs69,
+}
+
 // handleMessage is invoked whenever an inbound message is received from a remote
 // peer. The remote connection is torn down upon returning any error.
 func handleMessage(backend Backend, peer *Peer) error {
@@ -232,15 +254,21 @@ func handleMessage(backend Backend, peer *Peer) error {
 	if peer.Version() >= ETH68 {
 		handlers = eth68
 	}
-
-	delay := time.Duration(emu.Global.Latency+uint64(msg.Size)/emu.Global.Bandwidth) * time.Millisecond
-	if msg.Code == NewBlockMsg || msg.Code == BlockBodiesMsg {
-		delay += time.Duration(emu.Global.BlockSize/emu.Global.Bandwidth) * time.Millisecond
+	if peer.Version() >= ETH69 {
+		handlers = eth69
 	}
-	time.Sleep(delay)
+
+	emu.Transmit(peer.Peer.ID(), peer.LocalID(), uint64(msg.Size), msg.Code == NewBlockMsg || msg.Code == BlockBodiesMsg)
+	emu.WaitResumed(peer.LocalID(), peer.Closed())
+	traceMsg(peer, &msg, true)
 
 	if handler := handlers[msg.Code]; handler != nil {
-		return handler(backend, msg, peer)
+		// Hold the peer back for the processing time of the emulated node
+		start := time.Now()
+		err := handler(backend, msg, peer)
+		peer.cpu.ProcessMessage(peer.receivedTxs, time.Since(start))
+		peer.receivedTxs = 0
+		return err
 	}
 	return fmt.Errorf("%w: %v", errInvalidMsgCode, msg.Code)
 }
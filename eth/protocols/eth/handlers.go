@@ -351,6 +351,63 @@ func handleNewBlock(backend Backend, msg Decoder, peer *Peer) error {
 	return backend.Handle(peer, ann)
 }
 
+func handleNewCompactBlock(backend Backend, msg Decoder, peer *Peer) error {
+	// Retrieve and decode the propagated compact block
+	ann := new(NewCompactBlockPacket)
+	if err := msg.Decode(ann); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	if err := ann.sanityCheck(); err != nil {
+		return err
+	}
+	if hash := types.CalcUncleHash(ann.Uncles); hash != ann.Header.UncleHash {
+		log.Warn("Propagated compact block has invalid uncles", "have", hash, "exp", ann.Header.UncleHash)
+		return nil
+	}
+	// Mark the peer as owning the block
+	peer.markBlock(ann.Header.Hash())
+
+	return backend.Handle(peer, ann)
+}
+
+func handleGetBlockTxs69(backend Backend, msg Decoder, peer *Peer) error {
+	// Decode the compact block transaction query
+	var query GetBlockTxsPacket69
+	if err := msg.Decode(&query); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	// Blocks are relayed before their import, so look among the ones recently
+	// sent to the peer first
+	block := peer.compactBlock(query.Hash)
+	if block == nil {
+		block = backend.Chain().GetBlockByHash(query.Hash)
+	}
+	var txs []*types.Transaction
+	if block != nil {
+		all := block.Transactions()
+		for _, index := range query.Indexes {
+			if index >= uint64(len(all)) {
+				break
+			}
+			txs = append(txs, all[index])
+		}
+	}
+	return peer.ReplyBlockTxs(query.RequestId, txs)
+}
+
+func handleBlockTxs69(backend Backend, msg Decoder, peer *Peer) error {
+	// A batch of compact block transactions arrived to one of our previous requests
+	res := new(BlockTxsPacket69)
+	if err := msg.Decode(res); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	return peer.dispatchResponse(&Response{
+		id:   res.RequestId,
+		code: BlockTxsMsg,
+		Res:  &res.BlockTxsPacket,
+	}, nil)
+}
+
 func handleBlockHeaders66(backend Backend, msg Decoder, peer *Peer) error {
 	// A batch of headers arrived to one of our previous requests
 	res := new(BlockHeadersPacket66)
@@ -526,6 +583,7 @@ func handleTransactions(backend Backend, msg Decoder, peer *Peer) error {
 		}
 		peer.markTransaction(tx.Hash())
 	}
+	peer.receivedTxs = len(txs)
 	return backend.Handle(peer, &txs)
 }
 
@@ -546,6 +604,7 @@ func handlePooledTransactions66(backend Backend, msg Decoder, peer *Peer) error
 		}
 		peer.markTransaction(tx.Hash())
 	}
+	peer.receivedTxs = len(txs.PooledTransactionsPacket)
 
 	return backend.Handle(peer, &txs.PooledTransactionsPacket)
 }
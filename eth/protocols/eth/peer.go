@@ -20,11 +20,15 @@ import (
 	"math/big"
 	"math/rand"
 	"sync"
+	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/emu"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/tracker"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -54,6 +58,14 @@ const (
 	// dropping broadcasts. Similarly to block propagations, there's no point to queue
 	// above some healthy uncle limit, so use that.
 	maxQueuedBlockAnns = 4
+
+	// maxCompactBlocks is the maximum number of blocks sent to the peer in compact
+	// form to keep around for serving their transactions.
+	maxCompactBlocks = 16
+
+	// requestTimeout is the time after which a request without a response counts
+	// as timed out against the peer.
+	requestTimeout = 10 * time.Second
 )
 
 // max is a helper function which returns the larger of the two given integers.
@@ -75,15 +87,23 @@ type Peer struct {
 	head common.Hash // Latest advertised head block hash
 	td   *big.Int    // Latest advertised head block total difficulty
 
-	knownBlocks     *knownCache            // Set of block hashes known to be known by this peer
-	queuedBlocks    chan *blockPropagation // Queue of blocks to broadcast to the peer
-	queuedBlockAnns chan *types.Block      // Queue of blocks to announce to the peer
+	knownBlocks     *knownCache                           // Set of block hashes known to be known by this peer
+	queuedBlocks    chan *blockPropagation                // Queue of blocks to broadcast to the peer
+	queuedBlockAnns chan *types.Block                     // Queue of blocks to announce to the peer
+	compactBlocks   *lru.Cache[common.Hash, *types.Block] // Blocks sent in compact form, possibly not yet imported locally
 
 	txpool      TxPool             // Transaction pool used by the broadcasters for liveness checks
 	knownTxs    *knownCache        // Set of transaction hashes known to be known by this peer
 	txBroadcast chan []common.Hash // Channel used to queue transaction propagation requests
 	txAnnounce  chan []common.Hash // Channel used to queue transaction announcement requests
 
+	traffic  *trafficStats    // Messages exchanged with the peer by kind
+	tracker  *tracker.Tracker // Tracker of the requests awaiting a response
+	requests requestStats     // Outcomes of the requests sent to the peer
+
+	cpu         *emu.CPU // Processing model of the local node, nil for host speed
+	receivedTxs int      // Transactions in the message being handled, for its processing time
+
 	reqDispatch chan *request  // Dispatch channel to send requests and track then until fulfilment
 	reqCancel   chan *cancel   // Dispatch channel to cancel pending requests and untrack them
 	resDispatch chan *response // Dispatch channel to fulfil pending requests and untrack them
@@ -98,20 +118,26 @@ func NewPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter, txpool TxPool) *Pe
 	peer := &Peer{
 		id:              p.ID().String(),
 		Peer:            p,
-		rw:              rw,
 		version:         version,
 		knownTxs:        newKnownCache(maxKnownTxs),
 		knownBlocks:     newKnownCache(maxKnownBlocks),
 		queuedBlocks:    make(chan *blockPropagation, maxQueuedBlocks),
 		queuedBlockAnns: make(chan *types.Block, maxQueuedBlockAnns),
+		compactBlocks:   lru.NewCache[common.Hash, *types.Block](maxCompactBlocks),
 		txBroadcast:     make(chan []common.Hash),
 		txAnnounce:      make(chan []common.Hash),
 		reqDispatch:     make(chan *request),
 		reqCancel:       make(chan *cancel),
 		resDispatch:     make(chan *response),
 		txpool:          txpool,
+		traffic:         newTrafficStats(),
+		tracker:         tracker.New(ProtocolName, requestTimeout),
+		cpu:             emu.PeerCPU(p.LocalID()),
 		term:            make(chan struct{}),
 	}
+	peer.tracker.OnExpire(func(string, uint64) { peer.requests.timeouts.Add(1) })
+	peer.rw = &tracedRW{MsgReadWriter: rw, peer: peer}
+
 	// Start up all the broadcasters
 	go peer.broadcastBlocks()
 	go peer.broadcastTransactions()
@@ -126,6 +152,7 @@ func NewPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter, txpool TxPool) *Pe
 // clean it up!
 func (p *Peer) Close() {
 	close(p.term)
+	p.tracker.Stop()
 }
 
 // ID retrieves the peer's unique identifier.
@@ -138,6 +165,19 @@ func (p *Peer) Version() uint {
 	return p.version
 }
 
+// Traffic retrieves the number and size of the messages exchanged with the peer
+// by message kind.
+func (p *Peer) Traffic() *Traffic {
+	return p.traffic.copy()
+}
+
+// RequestStats retrieves the number of requests the peer answered in time, the
+// number of requests it let time out and the number of responses it sent
+// without being asked.
+func (p *Peer) RequestStats() (responses, timeouts, unsolicited uint64) {
+	return p.requests.responses.Load(), p.requests.timeouts.Load(), p.requests.unsolicited.Load()
+}
+
 // Head retrieves the current head hash and total difficulty of the peer.
 func (p *Peer) Head() (hash common.Hash, td *big.Int) {
 	p.lock.RLock()
@@ -297,6 +337,28 @@ func (p *Peer) SendNewBlock(block *types.Block, td *big.Int) error {
 	})
 }
 
+// SendNewCompactBlock propagates a block to a remote peer in compact form. The
+// transactions the peer is not known to have are sent in full.
+func (p *Peer) SendNewCompactBlock(block *types.Block, td *big.Int) error {
+	// Mark all the block hash as known, but ensure we don't overflow our limits
+	p.knownBlocks.Add(block.Hash())
+	p.compactBlocks.Add(block.Hash(), block)
+
+	packet := NewCompactBlock(block, td, func(tx *types.Transaction) bool {
+		return !p.knownTxs.Contains(tx.Hash())
+	})
+	for _, prefilled := range packet.Prefilled {
+		p.knownTxs.Add(prefilled.Tx.Hash())
+	}
+	return p2p.Send(p.rw, NewCompactBlockMsg, packet)
+}
+
+// compactBlock retrieves a block recently sent to the peer in compact form.
+func (p *Peer) compactBlock(hash common.Hash) *types.Block {
+	block, _ := p.compactBlocks.Get(hash)
+	return block
+}
+
 // AsyncSendNewBlock queues an entire block for propagation to a remote peer. If
 // the peer's broadcast queue is full, the event is silently dropped.
 func (p *Peer) AsyncSendNewBlock(block *types.Block, td *big.Int) {
@@ -326,6 +388,14 @@ func (p *Peer) ReplyBlockBodiesRLP(id uint64, bodies []rlp.RawValue) error {
 	})
 }
 
+// ReplyBlockTxs is the eth/69 response to GetBlockTxs.
+func (p *Peer) ReplyBlockTxs(id uint64, txs []*types.Transaction) error {
+	return p2p.Send(p.rw, BlockTxsMsg, &BlockTxsPacket69{
+		RequestId:      id,
+		BlockTxsPacket: txs,
+	})
+}
+
 // ReplyNodeData is the eth/66 response to GetNodeData.
 func (p *Peer) ReplyNodeData(id uint64, data [][]byte) error {
 	return p2p.Send(p.rw, NodeDataMsg, &NodeDataPacket66{
@@ -445,6 +515,31 @@ func (p *Peer) RequestBodies(hashes []common.Hash, sink chan *Response) (*Reques
 	return req, nil
 }
 
+// RequestBlockTxs fetches the transactions of a compact block at the given
+// indices from the remote peer.
+func (p *Peer) RequestBlockTxs(hash common.Hash, indexes []uint64, sink chan *Response) (*Request, error) {
+	p.Log().Debug("Fetching compact block transactions", "hash", hash, "count", len(indexes))
+	id := rand.Uint64()
+
+	req := &Request{
+		id:   id,
+		sink: sink,
+		code: GetBlockTxsMsg,
+		want: BlockTxsMsg,
+		data: &GetBlockTxsPacket69{
+			RequestId: id,
+			GetBlockTxsPacket: &GetBlockTxsPacket{
+				Hash:    hash,
+				Indexes: indexes,
+			},
+		},
+	}
+	if err := p.dispatchRequest(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
 // RequestNodeData fetches a batch of arbitrary data from a node's known state
 // data, corresponding to the specified hashes.
 func (p *Peer) RequestNodeData(hashes []common.Hash, sink chan *Response) (*Request, error) {
@@ -17,6 +17,7 @@
 package eth
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -33,6 +34,7 @@ const (
 	ETH66 = 66
 	ETH67 = 67
 	ETH68 = 68
+	ETH69 = 69 // Emulator extension relaying blocks in compact form
 )
 
 // ProtocolName is the official short name of the `eth` protocol used during
@@ -43,9 +45,13 @@ const ProtocolName = "eth"
 // is primary).
 var ProtocolVersions = []uint{ETH68, ETH67, ETH66}
 
+// CompactProtocolVersions are the supported versions of the `eth` protocol on
+// nodes relaying blocks in compact form to the peers supporting it.
+var CompactProtocolVersions = append([]uint{ETH69}, ProtocolVersions...)
+
 // protocolLengths are the number of implemented message corresponding to
 // different protocol versions.
-var protocolLengths = map[uint]uint64{ETH68: 17, ETH67: 17, ETH66: 17}
+var protocolLengths = map[uint]uint64{ETH69: 20, ETH68: 17, ETH67: 17, ETH66: 17}
 
 // maxMessageSize is the maximum cap on the size of a protocol message.
 const maxMessageSize = 10 * 1024 * 1024
@@ -66,6 +72,11 @@ const (
 	NewPooledTransactionHashesMsg = 0x08
 	GetPooledTransactionsMsg      = 0x09
 	PooledTransactionsMsg         = 0x0a
+
+	// Compact block relay, eth/69 only
+	NewCompactBlockMsg = 0x11
+	GetBlockTxsMsg     = 0x12
+	BlockTxsMsg        = 0x13
 )
 
 var (
@@ -206,6 +217,92 @@ func (request *NewBlockPacket) sanityCheck() error {
 	return nil
 }
 
+// NewCompactBlockPacket is the network packet for the compact block propagation
+// message. It carries the block without its transactions, which the receiver
+// recovers from its pool by their short IDs. Transactions the remote peer likely
+// misses are prefilled in full.
+type NewCompactBlockPacket struct {
+	Header      *types.Header
+	Uncles      []*types.Header
+	TD          *big.Int
+	ShortIDs    []uint64            // Short IDs of the transactions not prefilled, in block order
+	Prefilled   []PrefilledTx       // Transactions sent in full, in block order
+	Withdrawals []*types.Withdrawal `rlp:"optional"`
+}
+
+// PrefilledTx is a transaction of a compact block sent in full, along with its
+// index in the block.
+type PrefilledTx struct {
+	Index uint64
+	Tx    *types.Transaction
+}
+
+// ShortTxID returns the short ID of a transaction in compact blocks, the first
+// eight bytes of its hash.
+func ShortTxID(hash common.Hash) uint64 {
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
+// NewCompactBlock builds the compact form of a block, prefilling the
+// transactions for which the given function returns true.
+func NewCompactBlock(block *types.Block, td *big.Int, prefill func(tx *types.Transaction) bool) *NewCompactBlockPacket {
+	packet := &NewCompactBlockPacket{
+		Header:      block.Header(),
+		Uncles:      block.Uncles(),
+		TD:          td,
+		Withdrawals: block.Withdrawals(),
+	}
+	for i, tx := range block.Transactions() {
+		if prefill(tx) {
+			packet.Prefilled = append(packet.Prefilled, PrefilledTx{Index: uint64(i), Tx: tx})
+		} else {
+			packet.ShortIDs = append(packet.ShortIDs, ShortTxID(tx.Hash()))
+		}
+	}
+	return packet
+}
+
+// sanityCheck verifies that the values are reasonable, as a DoS protection
+func (request *NewCompactBlockPacket) sanityCheck() error {
+	if request.Header == nil {
+		return errors.New("missing compact block header")
+	}
+	if tdlen := request.TD.BitLen(); tdlen > 100 {
+		return fmt.Errorf("too large block TD: bitlen %d", tdlen)
+	}
+	count := uint64(len(request.ShortIDs) + len(request.Prefilled))
+	for i, prefilled := range request.Prefilled {
+		if prefilled.Tx == nil || prefilled.Index >= count || (i > 0 && prefilled.Index <= request.Prefilled[i-1].Index) {
+			return fmt.Errorf("invalid prefilled transaction %d", i)
+		}
+	}
+	return nil
+}
+
+// GetBlockTxsPacket represents a query for the transactions of a compact block
+// by their indices.
+type GetBlockTxsPacket struct {
+	Hash    common.Hash
+	Indexes []uint64
+}
+
+// GetBlockTxsPacket69 represents a compact block transaction query over eth/69.
+type GetBlockTxsPacket69 struct {
+	RequestId uint64
+	*GetBlockTxsPacket
+}
+
+// BlockTxsPacket is the network packet for the transactions of a compact block,
+// in the order they were requested.
+type BlockTxsPacket []*types.Transaction
+
+// BlockTxsPacket69 is the network packet for compact block transactions over
+// eth/69.
+type BlockTxsPacket69 struct {
+	RequestId uint64
+	BlockTxsPacket
+}
+
 // GetBlockBodiesPacket represents a block body query.
 type GetBlockBodiesPacket []common.Hash
 
@@ -363,6 +460,15 @@ func (*BlockBodiesPacket) Kind() byte   { return BlockBodiesMsg }
 func (*NewBlockPacket) Name() string { return "NewBlock" }
 func (*NewBlockPacket) Kind() byte   { return NewBlockMsg }
 
+func (*NewCompactBlockPacket) Name() string { return "NewCompactBlock" }
+func (*NewCompactBlockPacket) Kind() byte   { return NewCompactBlockMsg }
+
+func (*GetBlockTxsPacket) Name() string { return "GetBlockTxs" }
+func (*GetBlockTxsPacket) Kind() byte   { return GetBlockTxsMsg }
+
+func (*BlockTxsPacket) Name() string { return "BlockTxs" }
+func (*BlockTxsPacket) Kind() byte   { return BlockTxsMsg }
+
 func (*GetNodeDataPacket) Name() string { return "GetNodeData" }
 func (*GetNodeDataPacket) Kind() byte   { return GetNodeDataMsg }
 
@@ -0,0 +1,408 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// msgNames are the names of the messages by code, as used in traces and the
+// per-peer traffic statistics.
+var msgNames = map[uint64]string{
+	StatusMsg:                     "Status",
+	NewBlockHashesMsg:             "NewBlockHashes",
+	TransactionsMsg:               "Transactions",
+	GetBlockHeadersMsg:            "GetBlockHeaders",
+	BlockHeadersMsg:               "BlockHeaders",
+	GetBlockBodiesMsg:             "GetBlockBodies",
+	BlockBodiesMsg:                "BlockBodies",
+	NewBlockMsg:                   "NewBlock",
+	GetNodeDataMsg:                "GetNodeData",
+	NodeDataMsg:                   "NodeData",
+	GetReceiptsMsg:                "GetReceipts",
+	ReceiptsMsg:                   "Receipts",
+	NewPooledTransactionHashesMsg: "NewPooledTransactionHashes",
+	GetPooledTransactionsMsg:      "GetPooledTransactions",
+	PooledTransactionsMsg:         "PooledTransactions",
+	NewCompactBlockMsg:            "NewCompactBlock",
+	GetBlockTxsMsg:                "GetBlockTxs",
+	BlockTxsMsg:                   "BlockTxs",
+}
+
+// msgName returns the name of a message code, its number if unknown.
+func msgName(code uint64) string {
+	if name, ok := msgNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", code)
+}
+
+// MsgStats counts the messages of one kind exchanged with a peer.
+type MsgStats struct {
+	Count uint64 `json:"count"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// Traffic is the per message kind summary of the messages exchanged with a
+// peer, keyed by message name.
+type Traffic struct {
+	In  map[string]*MsgStats `json:"in"`
+	Out map[string]*MsgStats `json:"out"`
+}
+
+// trafficStats accumulates the traffic of a peer.
+type trafficStats struct {
+	traffic Traffic
+	lock    sync.Mutex
+}
+
+func newTrafficStats() *trafficStats {
+	return &trafficStats{traffic: Traffic{
+		In:  make(map[string]*MsgStats),
+		Out: make(map[string]*MsgStats),
+	}}
+}
+
+// add counts a message sent to or received from the peer.
+func (s *trafficStats) add(code uint64, size uint32, inbound bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	counts := s.traffic.Out
+	if inbound {
+		counts = s.traffic.In
+	}
+	stats, ok := counts[msgName(code)]
+	if !ok {
+		stats = new(MsgStats)
+		counts[msgName(code)] = stats
+	}
+	stats.Count++
+	stats.Bytes += uint64(size)
+}
+
+// copy returns a snapshot of the traffic counted so far.
+func (s *trafficStats) copy() *Traffic {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := &Traffic{
+		In:  make(map[string]*MsgStats, len(s.traffic.In)),
+		Out: make(map[string]*MsgStats, len(s.traffic.Out)),
+	}
+	for name, stats := range s.traffic.In {
+		copied := *stats
+		result.In[name] = &copied
+	}
+	for name, stats := range s.traffic.Out {
+		copied := *stats
+		result.Out[name] = &copied
+	}
+	return result
+}
+
+// Tracer logs every eth message exchanged by the nodes of the process, once
+// when sent and once when received after the emulated link delay, either as CSV
+// or as JSON lines.
+type Tracer struct {
+	out   *bufio.Writer
+	jsonl bool
+	lock  sync.Mutex
+}
+
+// TraceEntry is a single traced message. From and To are the identities of the
+// emulated sender and recipient.
+type TraceEntry struct {
+	Time    int64  `json:"time"` // Microseconds since the epoch
+	Dir     string `json:"dir"`  // "send" or "recv"
+	From    uint64 `json:"from"`
+	To      uint64 `json:"to"`
+	Version uint   `json:"version"`
+	Code    uint64 `json:"code"`
+	Msg     string `json:"msg"`
+	Size    uint32 `json:"size"`
+	IDs     string `json:"ids"` // Block or transaction hashes carried, separated by ';'
+}
+
+// ReadTrace parses a message trace in the format "csv" or "jsonl", as written
+// by the tracer.
+func ReadTrace(r io.Reader, format string) ([]*TraceEntry, error) {
+	var entries []*TraceEntry
+	switch format {
+	case "jsonl":
+		dec := json.NewDecoder(r)
+		for {
+			entry := new(TraceEntry)
+			if err := dec.Decode(entry); err == io.EOF {
+				return entries, nil
+			} else if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	case "csv":
+		rows, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			if i == 0 && len(row) > 0 && row[0] == "time" {
+				continue // Header
+			}
+			entry, err := parseTraceRow(row)
+			if err != nil {
+				return nil, fmt.Errorf("trace line %d: %v", i+1, err)
+			}
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	}
+	return nil, fmt.Errorf("unknown trace format %q", format)
+}
+
+// parseTraceRow parses a single CSV trace line.
+func parseTraceRow(row []string) (*TraceEntry, error) {
+	if len(row) != 9 {
+		return nil, fmt.Errorf("want 9 fields, have %d", len(row))
+	}
+	var (
+		entry = &TraceEntry{Dir: row[1], Msg: row[6], IDs: row[8]}
+		err   error
+		num   uint64
+	)
+	if entry.Time, err = strconv.ParseInt(row[0], 10, 64); err != nil {
+		return nil, err
+	}
+	if entry.From, err = strconv.ParseUint(row[2], 10, 64); err != nil {
+		return nil, err
+	}
+	if entry.To, err = strconv.ParseUint(row[3], 10, 64); err != nil {
+		return nil, err
+	}
+	if num, err = strconv.ParseUint(row[4], 10, 32); err != nil {
+		return nil, err
+	}
+	entry.Version = uint(num)
+	if entry.Code, err = strconv.ParseUint(row[5], 10, 64); err != nil {
+		return nil, err
+	}
+	if num, err = strconv.ParseUint(row[7], 10, 32); err != nil {
+		return nil, err
+	}
+	entry.Size = uint32(num)
+	return entry, nil
+}
+
+// tracer is the process-wide message tracer, nil unless enabled.
+var tracer atomic.Pointer[Tracer]
+
+// EnableTracer starts tracing all eth messages into the given writer, using the
+// format "csv" or "jsonl". CSV traces start with a header if requested, which
+// callers appending to an existing trace leave out. A nil writer disables
+// tracing again, flushing the previous tracer.
+func EnableTracer(w io.Writer, format string, header bool) error {
+	if w == nil {
+		if t := tracer.Swap(nil); t != nil {
+			t.flush()
+		}
+		return nil
+	}
+	if format != "csv" && format != "jsonl" {
+		return fmt.Errorf("unknown trace format %q", format)
+	}
+	t := &Tracer{out: bufio.NewWriter(w), jsonl: format == "jsonl"}
+	if !t.jsonl && header {
+		t.out.WriteString("time,dir,from,to,version,code,msg,size,ids\n")
+	}
+	tracer.Store(t)
+	return nil
+}
+
+// flush writes out the buffered traces.
+func (t *Tracer) flush() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := t.out.Flush(); err != nil {
+		log.Warn("Failed to write message trace", "err", err)
+	}
+}
+
+// write records a single message.
+func (t *Tracer) write(entry *TraceEntry) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.jsonl {
+		blob, _ := json.Marshal(entry)
+		t.out.Write(append(blob, '\n'))
+		return
+	}
+	fmt.Fprintf(t.out, "%d,%s,%d,%d,%d,%d,%s,%d,%s\n", entry.Time, entry.Dir, entry.From, entry.To, entry.Version, entry.Code, entry.Msg, entry.Size, entry.IDs)
+}
+
+// traceMsg accounts a message in the traffic of the peer and traces it if
+// tracing is enabled. The payload of the message is buffered to extract the
+// carried hashes, leaving the message readable in full.
+func traceMsg(peer *Peer, msg *p2p.Msg, inbound bool) {
+	peer.traffic.add(msg.Code, msg.Size, inbound)
+
+	t := tracer.Load()
+	if t == nil {
+		return
+	}
+	payload, err := io.ReadAll(msg.Payload)
+	if err != nil {
+		log.Debug("Failed to buffer traced message", "msg", msgName(msg.Code), "err", err)
+	}
+	msg.Payload = bytes.NewReader(payload)
+
+	local, _ := emu.NodeIdentity(peer.LocalID())
+	remote, _ := emu.NodeIdentity(peer.Peer.ID())
+	entry := &TraceEntry{
+		Time:    time.Now().UnixMicro(),
+		Dir:     "send",
+		From:    local,
+		To:      remote,
+		Version: peer.version,
+		Code:    msg.Code,
+		Msg:     msgName(msg.Code),
+		Size:    msg.Size,
+		IDs:     strings.Join(contentIDs(msg.Code, peer.version, payload), ";"),
+	}
+	if inbound {
+		entry.Dir, entry.From, entry.To = "recv", remote, local
+	}
+	t.write(entry)
+}
+
+// contentIDs extracts the block or transaction hashes carried by a message,
+// none for messages without any or which fail to decode.
+func contentIDs(code uint64, version uint, payload []byte) []string {
+	var hashes []common.Hash
+	switch code {
+	case NewBlockHashesMsg:
+		var packet NewBlockHashesPacket
+		if rlp.DecodeBytes(payload, &packet) == nil {
+			for _, ann := range packet {
+				hashes = append(hashes, ann.Hash)
+			}
+		}
+	case NewBlockMsg:
+		var packet NewBlockPacket
+		if rlp.DecodeBytes(payload, &packet) == nil && packet.Block != nil {
+			hashes = append(hashes, packet.Block.Hash())
+		}
+	case NewCompactBlockMsg:
+		var packet NewCompactBlockPacket
+		if rlp.DecodeBytes(payload, &packet) == nil && packet.Header != nil {
+			hashes = append(hashes, packet.Header.Hash())
+		}
+	case TransactionsMsg:
+		var packet TransactionsPacket
+		if rlp.DecodeBytes(payload, &packet) == nil {
+			hashes = txHashes(packet)
+		}
+	case NewPooledTransactionHashesMsg:
+		if version >= ETH68 {
+			var packet NewPooledTransactionHashesPacket68
+			if rlp.DecodeBytes(payload, &packet) == nil {
+				hashes = packet.Hashes
+			}
+		} else {
+			var packet NewPooledTransactionHashesPacket66
+			if rlp.DecodeBytes(payload, &packet) == nil {
+				hashes = packet
+			}
+		}
+	case GetPooledTransactionsMsg:
+		var packet GetPooledTransactionsPacket66
+		if rlp.DecodeBytes(payload, &packet) == nil {
+			hashes = packet.GetPooledTransactionsPacket
+		}
+	case PooledTransactionsMsg:
+		var packet PooledTransactionsPacket66
+		if rlp.DecodeBytes(payload, &packet) == nil {
+			hashes = txHashes(packet.PooledTransactionsPacket)
+		}
+	case BlockHeadersMsg:
+		var packet BlockHeadersPacket66
+		if rlp.DecodeBytes(payload, &packet) == nil {
+			for _, header := range packet.BlockHeadersPacket {
+				hashes = append(hashes, header.Hash())
+			}
+		}
+	case GetBlockBodiesMsg:
+		var packet GetBlockBodiesPacket66
+		if rlp.DecodeBytes(payload, &packet) == nil {
+			hashes = packet.GetBlockBodiesPacket
+		}
+	case GetBlockTxsMsg:
+		var packet GetBlockTxsPacket69
+		if rlp.DecodeBytes(payload, &packet) == nil && packet.GetBlockTxsPacket != nil {
+			hashes = append(hashes, packet.Hash)
+		}
+	case BlockTxsMsg:
+		var packet BlockTxsPacket69
+		if rlp.DecodeBytes(payload, &packet) == nil {
+			hashes = txHashes(packet.BlockTxsPacket)
+		}
+	}
+	ids := make([]string, len(hashes))
+	for i, hash := range hashes {
+		ids[i] = hash.Hex()
+	}
+	return ids
+}
+
+// txHashes returns the hashes of a list of transactions.
+func txHashes(txs []*types.Transaction) []common.Hash {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	return hashes
+}
+
+// tracedRW wraps the message stream of a peer to account and trace all
+// messages sent to it.
+type tracedRW struct {
+	p2p.MsgReadWriter
+	peer *Peer
+}
+
+func (rw *tracedRW) WriteMsg(msg p2p.Msg) error {
+	traceMsg(rw.peer, &msg, false)
+	return rw.MsgReadWriter.WriteMsg(msg)
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package emuclient provides an RPC client for the control API of a running
+// emulation.
+package emuclient
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/emu"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Client is a wrapper around rpc.Client steering an emulation through the emu
+// namespace served by the orchestrator.
+type Client struct {
+	c *rpc.Client
+}
+
+// Dial connects a client to the given URL.
+func Dial(rawurl string) (*Client, error) {
+	return DialContext(context.Background(), rawurl)
+}
+
+// DialContext connects a client to the given URL with context.
+func DialContext(ctx context.Context, rawurl string) (*Client, error) {
+	c, err := rpc.DialContext(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return New(c), nil
+}
+
+// New creates a client that uses the given RPC client.
+func New(c *rpc.Client) *Client {
+	return &Client{c}
+}
+
+// Close closes the underlying RPC connection.
+func (ec *Client) Close() {
+	ec.c.Close()
+}
+
+// Nodes lists all emulated nodes along with their heads and peers.
+func (ec *Client) Nodes(ctx context.Context) ([]*emu.NodeInfo, error) {
+	var result []*emu.NodeInfo
+	err := ec.c.CallContext(ctx, &result, "emu_nodes")
+	return result, err
+}
+
+// AddLink connects two nodes.
+func (ec *Client) AddLink(ctx context.Context, a, b common.Address) error {
+	return ec.c.CallContext(ctx, nil, "emu_addLink", a, b)
+}
+
+// RemoveLink disconnects two nodes.
+func (ec *Client) RemoveLink(ctx context.Context, a, b common.Address) error {
+	return ec.c.CallContext(ctx, nil, "emu_removeLink", a, b)
+}
+
+// SetLink changes the latency, bandwidth and loss of both directions of the link
+// between two nodes. Zero values fall back to the global defaults.
+func (ec *Client) SetLink(ctx context.Context, a, b common.Address, link emu.Link) error {
+	return ec.c.CallContext(ctx, nil, "emu_setLink", a, b, link)
+}
+
+// SetLinkDirection changes the latency, bandwidth and loss of the direction of
+// the link from one node to another only.
+func (ec *Client) SetLinkDirection(ctx context.Context, from, to common.Address, link emu.Link) error {
+	return ec.c.CallContext(ctx, nil, "emu_setLinkDirection", from, to, link)
+}
+
+// GetLink retrieves the effective latency, bandwidth and loss of the direction
+// of the link from node a to node b.
+func (ec *Client) GetLink(ctx context.Context, a, b common.Address) (emu.Link, error) {
+	var result emu.Link
+	err := ec.c.CallContext(ctx, &result, "emu_getLink", a, b)
+	return result, err
+}
+
+// SetDefaultLink changes the latency, bandwidth and loss of all links without an
+// override.
+func (ec *Client) SetDefaultLink(ctx context.Context, link emu.Link) error {
+	return ec.c.CallContext(ctx, nil, "emu_setDefaultLink", link)
+}
+
+// Partition splits the network into the given groups of nodes.
+func (ec *Client) Partition(ctx context.Context, groups [][]common.Address) error {
+	return ec.c.CallContext(ctx, nil, "emu_partition", groups)
+}
+
+// Heal restores all links dropped by previous partitions.
+func (ec *Client) Heal(ctx context.Context) error {
+	return ec.c.CallContext(ctx, nil, "emu_heal")
+}
+
+// Pause freezes a node until it is resumed.
+func (ec *Client) Pause(ctx context.Context, addr common.Address) error {
+	return ec.c.CallContext(ctx, nil, "emu_pause", addr)
+}
+
+// Resume lets a paused node continue.
+func (ec *Client) Resume(ctx context.Context, addr common.Address) error {
+	return ec.c.CallContext(ctx, nil, "emu_resume", addr)
+}
+
+// Work makes a node seal a block on top of its current head.
+func (ec *Client) Work(ctx context.Context, addr common.Address) error {
+	return ec.c.CallContext(ctx, nil, "emu_work", addr)
+}
+
+// WorkloadRate returns the number of blocks or transactions the orchestrator
+// generates per second, 0 if unthrottled.
+func (ec *Client) WorkloadRate(ctx context.Context) (float64, error) {
+	var result float64
+	err := ec.c.CallContext(ctx, &result, "emu_workloadRate")
+	return result, err
+}
+
+// SetWorkloadRate changes the number of blocks or transactions the orchestrator
+// generates per second.
+func (ec *Client) SetWorkloadRate(ctx context.Context, rate float64) error {
+	return ec.c.CallContext(ctx, nil, "emu_setWorkloadRate", rate)
+}
+
+// TxTransmissions returns how often a transaction reached nodes in full or
+// announced, nil if it is not tracked.
+func (ec *Client) TxTransmissions(ctx context.Context, hash common.Hash) (*emu.TxTransmissions, error) {
+	var result *emu.TxTransmissions
+	err := ec.c.CallContext(ctx, &result, "emu_txTransmissions", hash)
+	return result, err
+}
+
+// TxRedundancy sums the transmission counters of all tracked transactions.
+func (ec *Client) TxRedundancy(ctx context.Context) (*emu.TxRedundancy, error) {
+	var result emu.TxRedundancy
+	err := ec.c.CallContext(ctx, &result, "emu_txRedundancy")
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TxLifecycle returns the path of a transaction through the network, nil if it
+// is not tracked.
+func (ec *Client) TxLifecycle(ctx context.Context, hash common.Hash) (*emu.TxLifecycle, error) {
+	var result *emu.TxLifecycle
+	err := ec.c.CallContext(ctx, &result, "emu_txLifecycle", hash)
+	return result, err
+}
+
+// TxStats summarises the tracked transactions, the time they took to reach the
+// given fraction of nodes and to be confirmed to the given depth.
+func (ec *Client) TxStats(ctx context.Context, fraction float64, depth uint64) (*emu.TxStats, error) {
+	var result *emu.TxStats
+	err := ec.c.CallContext(ctx, &result, "emu_txStats", fraction, depth)
+	return result, err
+}
+
+// Checkpoint halts the emulation, copies the whole network into the given
+// directory on the host running it and lets it continue afterwards.
+func (ec *Client) Checkpoint(ctx context.Context, dir string) (*emu.Checkpoint, error) {
+	var result emu.Checkpoint
+	err := ec.c.CallContext(ctx, &result, "emu_checkpoint", dir)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
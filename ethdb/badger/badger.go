@@ -45,6 +45,7 @@ func New(file string, cache int, handles int, namespace string, readonly bool) (
 	// Open the db and recover any potential corruptions
 	option := badger.DefaultOptions(file)
 	option.Logger = nil
+	option.ReadOnly = readonly
 	db, err := badger.Open(option)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,420 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package overlay implements a copy-on-write key-value store, layering a private
+// writable store over a read-only base store that may be shared with others.
+package overlay
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// tombstonePrefix marks the keys in the top store recording that a key of the
+// base store was deleted through the overlay.
+var tombstonePrefix = []byte("overlay-tombstone-")
+
+// errNotFound is returned if a key is requested that is in neither layer.
+var errNotFound = errors.New("not found")
+
+func tombstoneKey(key []byte) []byte {
+	return append(common.CopyBytes(tombstonePrefix), key...)
+}
+
+// Database is a key-value store reading through a private top store into a
+// shared base store. All writes go to the top store, the base store is never
+// modified. Deleting a key that exists in the base store leaves a tombstone in
+// the top store hiding it.
+type Database struct {
+	base ethdb.KeyValueStore // Read-only store shared with other overlays
+	top  ethdb.KeyValueStore // Private store receiving all writes
+
+	deleted map[string]struct{} // Base keys hidden by tombstones
+	lock    sync.RWMutex
+}
+
+// New layers the top store over the base store, loading the tombstones left in
+// the top store by earlier runs. Closing the overlay closes both stores.
+func New(base, top ethdb.KeyValueStore) (*Database, error) {
+	db := &Database{
+		base:    base,
+		top:     top,
+		deleted: make(map[string]struct{}),
+	}
+	it := top.NewIterator(tombstonePrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		db.deleted[string(it.Key()[len(tombstonePrefix):])] = struct{}{}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close closes the top store and releases the base store.
+func (db *Database) Close() error {
+	err := db.top.Close()
+	if baseErr := db.base.Close(); err == nil {
+		err = baseErr
+	}
+	return err
+}
+
+func (db *Database) hidden(key []byte) bool {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	_, ok := db.deleted[string(key)]
+	return ok
+}
+
+// Has retrieves if a key is present in either layer.
+func (db *Database) Has(key []byte) (bool, error) {
+	if ok, err := db.top.Has(key); ok || err != nil {
+		return ok, err
+	}
+	if db.hidden(key) {
+		return false, nil
+	}
+	return db.base.Has(key)
+}
+
+// Get retrieves the given key from the top store, falling back to the base
+// store if the top store doesn't hold it.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	value, err := db.top.Get(key)
+	if err == nil {
+		return value, nil
+	}
+	// Distinguish a missing key from a failing store
+	if ok, hasErr := db.top.Has(key); ok {
+		return nil, err
+	} else if hasErr != nil {
+		return nil, hasErr
+	}
+	if db.hidden(key) {
+		return nil, errNotFound
+	}
+	return db.base.Get(key)
+}
+
+// Put inserts the given value into the top store.
+func (db *Database) Put(key []byte, value []byte) error {
+	batch := db.NewBatch()
+	if err := batch.Put(key, value); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// Delete removes the key from the top store and hides it in the base store.
+func (db *Database) Delete(key []byte) error {
+	batch := db.NewBatch()
+	if err := batch.Delete(key); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to the top
+// store until a final write is called.
+func (db *Database) NewBatch() ethdb.Batch {
+	return &batch{db: db, b: db.top.NewBatch()}
+}
+
+// NewBatchWithSize creates a write-only database batch with pre-allocated buffer.
+func (db *Database) NewBatchWithSize(size int) ethdb.Batch {
+	return &batch{db: db, b: db.top.NewBatchWithSize(size)}
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset of the merged
+// content of both layers with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+func (db *Database) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	db.lock.RLock()
+	deleted := make(map[string]struct{}, len(db.deleted))
+	for key := range db.deleted {
+		deleted[key] = struct{}{}
+	}
+	db.lock.RUnlock()
+
+	it := &iterator{
+		top:     db.top.NewIterator(prefix, start),
+		base:    db.base.NewIterator(prefix, start),
+		deleted: deleted,
+	}
+	it.topOk = it.nextTop()
+	it.baseOk = it.nextBase()
+	return it
+}
+
+// NewSnapshot creates a database snapshot based on the current state of the top
+// store. The base store is immutable and needs no snapshot.
+func (db *Database) NewSnapshot() (ethdb.Snapshot, error) {
+	top, err := db.top.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	db.lock.RLock()
+	deleted := make(map[string]struct{}, len(db.deleted))
+	for key := range db.deleted {
+		deleted[key] = struct{}{}
+	}
+	db.lock.RUnlock()
+
+	return &snapshot{top: top, base: db.base, deleted: deleted}, nil
+}
+
+// Stat returns a particular internal stat of the top store.
+func (db *Database) Stat(property string) (string, error) {
+	return db.top.Stat(property)
+}
+
+// Compact flattens the top store for the given key range.
+func (db *Database) Compact(start []byte, limit []byte) error {
+	return db.top.Compact(start, limit)
+}
+
+// keyvalue is a key-value tuple tagged with a deletion field to allow creating
+// overlay batches.
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+	hide   bool // Whether the deleted key exists in the base store
+}
+
+// batch is a write-only batch that commits changes to the top store when Write
+// is called, maintaining the tombstones of the overlay. A batch cannot be used
+// concurrently.
+type batch struct {
+	db     *Database
+	b      ethdb.Batch
+	writes []keyvalue
+	size   int
+}
+
+// Put inserts the given value into the batch for later committing, reviving the
+// key if it was deleted before.
+func (b *batch) Put(key, value []byte) error {
+	if err := b.b.Put(key, value); err != nil {
+		return err
+	}
+	if b.db.hidden(key) {
+		if err := b.b.Delete(tombstoneKey(key)); err != nil {
+			return err
+		}
+	}
+	b.writes = append(b.writes, keyvalue{common.CopyBytes(key), common.CopyBytes(value), false, false})
+	b.size += len(key) + len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing, leaving
+// a tombstone if the key exists in the base store.
+func (b *batch) Delete(key []byte) error {
+	if err := b.b.Delete(key); err != nil {
+		return err
+	}
+	hide, err := b.db.base.Has(key)
+	if err != nil {
+		return err
+	}
+	if hide {
+		if err := b.b.Put(tombstoneKey(key), nil); err != nil {
+			return err
+		}
+	}
+	b.writes = append(b.writes, keyvalue{common.CopyBytes(key), nil, true, hide})
+	b.size += len(key)
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Write flushes any accumulated data to the top store and updates the set of
+// hidden base keys.
+func (b *batch) Write() error {
+	if err := b.b.Write(); err != nil {
+		return err
+	}
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	for _, kv := range b.writes {
+		switch {
+		case !kv.delete:
+			delete(b.db.deleted, string(kv.key))
+		case kv.hide:
+			b.db.deleted[string(kv.key)] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.b.Reset()
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+// Replay replays the batch contents, leaving out the tombstones.
+func (b *batch) Replay(w ethdb.KeyValueWriter) error {
+	for _, kv := range b.writes {
+		if kv.delete {
+			if err := w.Delete(kv.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(kv.key, kv.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterator merges the iterators of both layers, preferring entries of the top
+// store and skipping tombstones as well as the base keys they hide.
+type iterator struct {
+	top, base     ethdb.Iterator
+	topOk, baseOk bool
+	deleted       map[string]struct{}
+	key, value    []byte
+	err           error
+}
+
+// nextTop advances the top iterator past any tombstones.
+func (it *iterator) nextTop() bool {
+	for it.top.Next() {
+		if !bytes.HasPrefix(it.top.Key(), tombstonePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextBase advances the base iterator past any hidden keys.
+func (it *iterator) nextBase() bool {
+	for it.base.Next() {
+		if _, ok := it.deleted[string(it.base.Key())]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted.
+func (it *iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	switch {
+	case !it.topOk && !it.baseOk:
+		it.key, it.value = nil, nil
+		if it.err = it.top.Error(); it.err == nil {
+			it.err = it.base.Error()
+		}
+		return false
+
+	case !it.baseOk || (it.topOk && bytes.Compare(it.top.Key(), it.base.Key()) <= 0):
+		it.key = common.CopyBytes(it.top.Key())
+		it.value = common.CopyBytes(it.top.Value())
+		if it.baseOk && bytes.Equal(it.key, it.base.Key()) {
+			it.baseOk = it.nextBase()
+		}
+		it.topOk = it.nextTop()
+
+	default:
+		it.key = common.CopyBytes(it.base.Key())
+		it.value = common.CopyBytes(it.base.Value())
+		it.baseOk = it.nextBase()
+	}
+	return true
+}
+
+// Error returns any accumulated error.
+func (it *iterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *iterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *iterator) Value() []byte {
+	return it.value
+}
+
+// Release releases the iterators of both layers.
+func (it *iterator) Release() {
+	it.top.Release()
+	it.base.Release()
+	it.key, it.value = nil, nil
+}
+
+// snapshot reads through a snapshot of the top store into the base store.
+type snapshot struct {
+	top     ethdb.Snapshot
+	base    ethdb.KeyValueReader
+	deleted map[string]struct{}
+}
+
+// Has retrieves if a key is present in the snapshot.
+func (snap *snapshot) Has(key []byte) (bool, error) {
+	if ok, err := snap.top.Has(key); ok || err != nil {
+		return ok, err
+	}
+	if _, ok := snap.deleted[string(key)]; ok {
+		return false, nil
+	}
+	return snap.base.Has(key)
+}
+
+// Get retrieves the given key if it's present in the snapshot.
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	value, err := snap.top.Get(key)
+	if err == nil {
+		return value, nil
+	}
+	if ok, hasErr := snap.top.Has(key); ok {
+		return nil, err
+	} else if hasErr != nil {
+		return nil, hasErr
+	}
+	if _, ok := snap.deleted[string(key)]; ok {
+		return nil, errNotFound
+	}
+	return snap.base.Get(key)
+}
+
+// Release releases the snapshot of the top store.
+func (snap *snapshot) Release() {
+	snap.top.Release()
+}
@@ -0,0 +1,308 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package spill implements a key-value store held in memory up to a size cap,
+// which moves its content to disk once the cap is exceeded.
+package spill
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ErrCapExceeded is returned if a write would grow an in-memory store without a
+// disk to spill to beyond its size cap.
+var ErrCapExceeded = errors.New("in-memory database size cap exceeded")
+
+// Opener opens the disk store receiving the content of a spilling store.
+type Opener func() (ethdb.KeyValueStore, error)
+
+// Database is a key-value store backed by a memory database until the size of
+// its content exceeds the cap. It then copies everything into the disk store
+// returned by the opener and continues on disk. Without an opener, writes beyond
+// the cap fail instead.
+type Database struct {
+	db   ethdb.KeyValueStore // Store currently holding the content
+	mem  *memorydb.Database  // Memory database, nil once spilled
+	size uint64              // Approximate size of the in-memory content
+	cap  uint64              // Size cap of the in-memory content, 0 if unbounded
+	open Opener              // Opener of the disk store, nil to fail beyond the cap
+
+	lock sync.RWMutex
+}
+
+// New creates an empty in-memory store capped at the given number of bytes.
+func New(cap uint64, open Opener) *Database {
+	mem := memorydb.New()
+	return &Database{
+		db:   mem,
+		mem:  mem,
+		cap:  cap,
+		open: open,
+	}
+}
+
+// Close closes the store currently holding the content.
+func (db *Database) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.db.Close()
+}
+
+// Spilled returns whether the content was moved to disk.
+func (db *Database) Spilled() bool {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.mem == nil
+}
+
+// Has retrieves if a key is present in the store.
+func (db *Database) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db.Has(key)
+}
+
+// Get retrieves the given key if it's present in the store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db.Get(key)
+}
+
+// Put inserts the given value into the store.
+func (db *Database) Put(key []byte, value []byte) error {
+	batch := db.NewBatch()
+	if err := batch.Put(key, value); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// Delete removes the key from the store.
+func (db *Database) Delete(key []byte) error {
+	batch := db.NewBatch()
+	if err := batch.Delete(key); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() ethdb.Batch {
+	return &batch{db: db}
+}
+
+// NewBatchWithSize creates a write-only database batch with pre-allocated buffer.
+func (db *Database) NewBatchWithSize(size int) ethdb.Batch {
+	return &batch{db: db}
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset of database
+// content with a particular key prefix, starting at a particular initial key (or
+// after, if it does not exist).
+func (db *Database) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db.NewIterator(prefix, start)
+}
+
+// NewSnapshot creates a database snapshot based on the current state.
+func (db *Database) NewSnapshot() (ethdb.Snapshot, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db.NewSnapshot()
+}
+
+// Stat returns a particular internal stat of the database.
+func (db *Database) Stat(property string) (string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db.Stat(property)
+}
+
+// Compact flattens the underlying data store for the given key range.
+func (db *Database) Compact(start []byte, limit []byte) error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db.Compact(start, limit)
+}
+
+// write applies a list of changes, spilling the content to disk first if the
+// changes would grow it beyond the cap.
+func (db *Database) write(writes []keyvalue) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	size := db.size
+	if db.mem != nil {
+		// Account for the changes, replacing the sizes of overwritten entries,
+		// including those written earlier in the same batch
+		sizes := make(map[string]uint64)
+		for _, kv := range writes {
+			old, ok := sizes[string(kv.key)]
+			if !ok {
+				if value, err := db.mem.Get(kv.key); err == nil {
+					old = uint64(len(kv.key) + len(value))
+				}
+			}
+			size -= old
+
+			var entry uint64
+			if !kv.delete {
+				entry = uint64(len(kv.key) + len(kv.value))
+			}
+			size += entry
+			sizes[string(kv.key)] = entry
+		}
+		if db.cap != 0 && size > db.cap {
+			if db.open == nil {
+				return ErrCapExceeded
+			}
+			if err := db.spill(); err != nil {
+				return err
+			}
+		}
+	}
+	batch := db.db.NewBatch()
+	for _, kv := range writes {
+		if kv.delete {
+			if err := batch.Delete(kv.key); err != nil {
+				return err
+			}
+		} else if err := batch.Put(kv.key, kv.value); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if db.mem != nil {
+		db.size = size
+	}
+	return nil
+}
+
+// spill copies the in-memory content into the disk store and switches over to
+// it. The lock must be held.
+func (db *Database) spill() error {
+	disk, err := db.open()
+	if err != nil {
+		return err
+	}
+	it := db.mem.NewIterator(nil, nil)
+	defer it.Release()
+
+	batch := disk.NewBatch()
+	for it.Next() {
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			disk.Close()
+			return err
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				disk.Close()
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		disk.Close()
+		return err
+	}
+	log.Info("Spilled in-memory database to disk", "size", common.StorageSize(db.size), "cap", common.StorageSize(db.cap))
+
+	db.mem.Close()
+	db.db, db.mem, db.size = disk, nil, 0
+	return nil
+}
+
+// keyvalue is a key-value tuple tagged with a deletion field to allow creating
+// spilling batches.
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch is a write-only batch that commits changes to its host database when
+// Write is called. A batch cannot be used concurrently.
+type batch struct {
+	db     *Database
+	writes []keyvalue
+	size   int
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *batch) Put(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{common.CopyBytes(key), common.CopyBytes(value), false})
+	b.size += len(key) + len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{common.CopyBytes(key), nil, true})
+	b.size += len(key)
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Write flushes any accumulated data to the host database.
+func (b *batch) Write() error {
+	return b.db.write(b.writes)
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+// Replay replays the batch contents.
+func (b *batch) Replay(w ethdb.KeyValueWriter) error {
+	for _, kv := range b.writes {
+		if kv.delete {
+			if err := w.Delete(kv.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(kv.key, kv.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -113,6 +113,12 @@ web3._extend({
 			call: 'ethash_submitHashrate',
 			params: 2,
 		}),
+		new web3._extend.Method({
+			name: 'setHashrate',
+			call: 'ethash_setHashrate',
+			params: 1,
+			inputFormatter: [web3._extend.utils.fromDecimal]
+		}),
 	]
 });
 `
@@ -0,0 +1,146 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package metrics implements counters, gauges and histograms kept separately
+// for every emulated node of the process.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are the histogram upper bounds used for durations in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ExponentialBuckets returns count upper bounds, the first being start and each
+// following one factor times the previous.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	count atomic.Int64
+}
+
+// Inc increments the counter by the given amount.
+func (c *Counter) Inc(n int64) {
+	c.count.Add(n)
+}
+
+// Count returns the current count.
+func (c *Counter) Count() int64 {
+	return c.count.Load()
+}
+
+// Gauge holds a value that may go up and down.
+type Gauge struct {
+	value atomic.Int64
+}
+
+// Update sets the gauge to the given value.
+func (g *Gauge) Update(v int64) {
+	g.value.Store(v)
+}
+
+// Inc increments the gauge by the given amount.
+func (g *Gauge) Inc(n int64) {
+	g.value.Add(n)
+}
+
+// Dec decrements the gauge by the given amount.
+func (g *Gauge) Dec(n int64) {
+	g.value.Add(-n)
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+// Histogram counts observations into buckets of fixed upper bounds.
+type Histogram struct {
+	bounds []float64
+	counts []uint64 // Observations per bucket, the last one being unbounded
+	count  uint64
+	sum    float64
+	lock   sync.Mutex
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	bounds = append([]float64{}, bounds...)
+	sort.Float64s(bounds)
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe adds a value to the histogram.
+func (h *Histogram) Observe(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	idx := sort.SearchFloat64s(h.bounds, v)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.counts[idx]++
+	h.count++
+	h.sum += v
+}
+
+// UpdateSince observes the time elapsed since the given start in seconds.
+func (h *Histogram) UpdateSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// HistogramSnapshot is a point in time copy of a histogram.
+type HistogramSnapshot struct {
+	Bounds []float64 // Upper bounds of the buckets
+	Counts []uint64  // Cumulative observation count of every bucket
+	Count  uint64    // Total number of observations
+	Sum    float64   // Sum of all observations
+}
+
+// Snapshot returns a copy of the histogram with cumulative bucket counts.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	snap := HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: make([]uint64, len(h.bounds)),
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+	var total uint64
+	for i := range h.bounds {
+		total += h.counts[i]
+		snap.Counts[i] = total
+	}
+	return snap
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// family collects the samples of one metric across all nodes.
+type family struct {
+	kind    string
+	samples bytes.Buffer
+}
+
+// promName converts a metric name into the Prometheus naming scheme.
+func promName(name string) string {
+	return strings.NewReplacer("/", "_", ".", "_", "-", "_").Replace(name)
+}
+
+// WritePrometheus writes the metrics of all nodes in the Prometheus text
+// exposition format, labelling every sample with the id of its node.
+func WritePrometheus(w io.Writer) error {
+	families := make(map[string]*family)
+	get := func(name, kind string) *family {
+		f, ok := families[name]
+		if !ok {
+			f = &family{kind: kind}
+			families[name] = f
+		}
+		return f
+	}
+	for _, r := range Nodes() {
+		node := strconv.Itoa(r.id)
+		r.each(
+			func(name string, c *Counter) {
+				name = promName(name)
+				fmt.Fprintf(&get(name, "counter").samples, "%s{node=%q} %d\n", name, node, c.Count())
+			},
+			func(name string, g *Gauge) {
+				name = promName(name)
+				fmt.Fprintf(&get(name, "gauge").samples, "%s{node=%q} %d\n", name, node, g.Value())
+			},
+			func(name string, h *Histogram) {
+				name = promName(name)
+				f, snap := get(name, "histogram"), h.Snapshot()
+				for i, bound := range snap.Bounds {
+					fmt.Fprintf(&f.samples, "%s_bucket{node=%q,le=%q} %d\n", name, node, strconv.FormatFloat(bound, 'g', -1, 64), snap.Counts[i])
+				}
+				fmt.Fprintf(&f.samples, "%s_bucket{node=%q,le=\"+Inf\"} %d\n", name, node, snap.Count)
+				fmt.Fprintf(&f.samples, "%s_sum{node=%q} %v\n", name, node, snap.Sum)
+				fmt.Fprintf(&f.samples, "%s_count{node=%q} %d\n", name, node, snap.Count)
+			},
+		)
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, families[name].kind); err != nil {
+			return err
+		}
+		if _, err := families[name].samples.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns an HTTP handler serving the metrics of all nodes to
+// Prometheus.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w)
+	})
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry holds the metrics of a single emulated node. A nil registry hands
+// out metrics that work but aren't reported anywhere.
+type Registry struct {
+	id         int
+	counters   map[string]*Counter
+	gauges     map[string]*Gauge
+	histograms map[string]*Histogram
+	lock       sync.Mutex
+}
+
+var (
+	registries     = make(map[int]*Registry)
+	registriesLock sync.Mutex
+)
+
+// Node returns the registry of the emulated node with the given id, creating it
+// on first use.
+func Node(id int) *Registry {
+	registriesLock.Lock()
+	defer registriesLock.Unlock()
+
+	r, ok := registries[id]
+	if !ok {
+		r = &Registry{
+			id:         id,
+			counters:   make(map[string]*Counter),
+			gauges:     make(map[string]*Gauge),
+			histograms: make(map[string]*Histogram),
+		}
+		registries[id] = r
+	}
+	return r
+}
+
+// Nodes returns the registries of all nodes ordered by node id.
+func Nodes() []*Registry {
+	registriesLock.Lock()
+	defer registriesLock.Unlock()
+
+	list := make([]*Registry, 0, len(registries))
+	for _, r := range registries {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+// ID returns the id of the node the registry belongs to.
+func (r *Registry) ID() int {
+	return r.id
+}
+
+// Counter returns the counter of the given name, registering it on first use.
+func (r *Registry) Counter(name string) *Counter {
+	if r == nil {
+		return new(Counter)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c, ok := r.counters[name]
+	if !ok {
+		c = new(Counter)
+		r.counters[name] = c
+	}
+	return c
+}
+
+// Gauge returns the gauge of the given name, registering it on first use.
+func (r *Registry) Gauge(name string) *Gauge {
+	if r == nil {
+		return new(Gauge)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	g, ok := r.gauges[name]
+	if !ok {
+		g = new(Gauge)
+		r.gauges[name] = g
+	}
+	return g
+}
+
+// Histogram returns the histogram of the given name, registering it with the
+// given bucket bounds on first use.
+func (r *Registry) Histogram(name string, bounds []float64) *Histogram {
+	if r == nil {
+		return newHistogram(bounds)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	h, ok := r.histograms[name]
+	if !ok {
+		h = newHistogram(bounds)
+		r.histograms[name] = h
+	}
+	return h
+}
+
+// Value returns the current value of the counter or gauge with the given name,
+// zero if neither is registered.
+func (r *Registry) Value(name string) int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if c, ok := r.counters[name]; ok {
+		return c.Count()
+	}
+	if g, ok := r.gauges[name]; ok {
+		return g.Value()
+	}
+	return 0
+}
+
+// each calls the given functions for all registered metrics in name order.
+func (r *Registry) each(counter func(string, *Counter), gauge func(string, *Gauge), histogram func(string, *Histogram)) {
+	r.lock.Lock()
+	counters := make(map[string]*Counter, len(r.counters))
+	for name, c := range r.counters {
+		counters[name] = c
+	}
+	gauges := make(map[string]*Gauge, len(r.gauges))
+	for name, g := range r.gauges {
+		gauges[name] = g
+	}
+	histograms := make(map[string]*Histogram, len(r.histograms))
+	for name, h := range r.histograms {
+		histograms[name] = h
+	}
+	r.lock.Unlock()
+
+	for _, name := range sortedKeys(counters) {
+		counter(name, counters[name])
+	}
+	for _, name := range sortedKeys(gauges) {
+		gauge(name, gauges[name])
+	}
+	for _, name := range sortedKeys(histograms) {
+		histogram(name, histograms[name])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
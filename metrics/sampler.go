@@ -0,0 +1,122 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// SampledMetrics are the counters and gauges a sampler records by default.
+var SampledMetrics = []string{
+	"txpool/pending",
+	"txpool/queued",
+	"chain/head/block",
+	"p2p/peers",
+	"p2p/ingress",
+	"p2p/egress",
+}
+
+// Sampler periodically records the values of a set of counters and gauges of
+// every node, either as CSV or as JSON lines.
+type Sampler struct {
+	out      *bufio.Writer
+	jsonl    bool
+	header   bool
+	names    []string
+	interval time.Duration
+	quit     chan chan struct{}
+}
+
+// NewSampler creates a sampler writing to the given writer. The format is either
+// "csv" or "jsonl", CSV output starting with a header if requested.
+func NewSampler(w io.Writer, format string, header bool, interval time.Duration, names []string) (*Sampler, error) {
+	if format != "csv" && format != "jsonl" {
+		return nil, fmt.Errorf("unknown sample format %q", format)
+	}
+	return &Sampler{
+		out:      bufio.NewWriter(w),
+		jsonl:    format == "jsonl",
+		header:   header,
+		names:    names,
+		interval: interval,
+		quit:     make(chan chan struct{}),
+	}, nil
+}
+
+// Start begins sampling in the background.
+func (s *Sampler) Start() {
+	if !s.jsonl && s.header {
+		fmt.Fprintf(s.out, "time,node,%s\n", strings.Join(s.names, ","))
+	}
+	go s.loop()
+}
+
+// Stop terminates sampling, flushing everything recorded so far.
+func (s *Sampler) Stop() {
+	done := make(chan struct{})
+	s.quit <- done
+	<-done
+}
+
+func (s *Sampler) loop() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.sample(now)
+		case done := <-s.quit:
+			s.out.Flush()
+			close(done)
+			return
+		}
+	}
+}
+
+// sample records one row per node.
+func (s *Sampler) sample(now time.Time) {
+	for _, r := range Nodes() {
+		if s.jsonl {
+			row := map[string]int64{
+				"time": now.UnixMilli(),
+				"node": int64(r.id),
+			}
+			for _, name := range s.names {
+				row[name] = r.Value(name)
+			}
+			blob, _ := json.Marshal(row)
+			s.out.Write(append(blob, '\n'))
+			continue
+		}
+		fmt.Fprintf(s.out, "%d,%d", now.UnixMilli(), r.id)
+		for _, name := range s.names {
+			fmt.Fprintf(s.out, ",%d", r.Value(name))
+		}
+		s.out.WriteByte('\n')
+	}
+	if err := s.out.Flush(); err != nil {
+		log.Warn("Failed to write metrics sample", "err", err)
+	}
+}
@@ -497,12 +497,12 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		select {
 		case <-w.startCh:
 			clearPending(w.chain.CurrentBlock().Number.Uint64())
-			timestamp = time.Now().Unix()
+			timestamp = w.chain.Clock().Now().Unix()
 			commit(false, commitInterruptNewHead)
 
 		case head := <-w.chainHeadCh:
 			clearPending(head.Block.NumberU64())
-			timestamp = time.Now().Unix()
+			timestamp = w.chain.Clock().Now().Unix()
 			commit(false, commitInterruptNewHead)
 
 		case <-timer.C:
@@ -649,7 +649,7 @@ func (w *worker) mainLoop() {
 				// submit sealing work here since all empty submission will be rejected
 				// by clique. Of course the advance sealing(empty submission) is disabled.
 				if w.chainConfig.Clique != nil && w.chainConfig.Clique.Period == 0 {
-					w.commitWork(nil, true, time.Now().Unix())
+					w.commitWork(nil, true, w.chain.Clock().Now().Unix())
 				}
 			}
 			w.newTxs.Add(int32(len(ev.Txs)))
@@ -683,36 +683,47 @@ func (w *worker) taskLoop() {
 			stopCh = nil
 		}
 	}
+	// seal pushes the given task to the consensus engine.
+	seal := func(task *task) {
+		if w.newTaskHook != nil {
+			w.newTaskHook(task)
+		}
+		// Reject duplicate sealing work due to resubmitting.
+		sealHash := w.engine.SealHash(task.block.Header())
+		if sealHash == prev {
+			return
+		}
+		// Interrupt previous sealing operation
+		interrupt()
+		stopCh, prev = make(chan struct{}), sealHash
+
+		if w.skipSealHook != nil && w.skipSealHook(task) {
+			return
+		}
+		w.pendingMu.Lock()
+		w.pendingTasks[sealHash] = task
+		w.pendingMu.Unlock()
+
+		if err := w.engine.Seal(w.chain, task.block, w.resultCh, stopCh); err != nil {
+			log.Warn("Block sealing failed", "err", err)
+			w.pendingMu.Lock()
+			delete(w.pendingTasks, sealHash)
+			w.pendingMu.Unlock()
+		}
+	}
 	var task *task
 	for {
 		select {
 		case task = <-w.taskCh:
-		case <-w.workCh:
-			if w.newTaskHook != nil {
-				w.newTaskHook(task)
-			}
-			// Reject duplicate sealing work due to resubmitting.
-			sealHash := w.engine.SealHash(task.block.Header())
-			if sealHash == prev {
-				continue
+			// Engines searching for seals on their own start right away
+			if sealer, ok := w.engine.(consensus.AutoSealer); ok && sealer.AutoSeal() {
+				seal(task)
 			}
-			// Interrupt previous sealing operation
-			interrupt()
-			stopCh, prev = make(chan struct{}), sealHash
-
-			if w.skipSealHook != nil && w.skipSealHook(task) {
+		case <-w.workCh:
+			if task == nil {
 				continue
 			}
-			w.pendingMu.Lock()
-			w.pendingTasks[sealHash] = task
-			w.pendingMu.Unlock()
-
-			if err := w.engine.Seal(w.chain, task.block, w.resultCh, stopCh); err != nil {
-				log.Warn("Block sealing failed", "err", err)
-				w.pendingMu.Lock()
-				delete(w.pendingTasks, sealHash)
-				w.pendingMu.Unlock()
-			}
+			seal(task)
 		case <-w.exitCh:
 			interrupt()
 			return
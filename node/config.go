@@ -63,6 +63,26 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// SharedDatabase is the folder of read-only databases shared by the nodes of
+	// a process. A database found there under the same name is layered below the
+	// node's own database, which then only stores the node's changes.
+	SharedDatabase string `toml:",omitempty"`
+
+	// DBEngine is the database engine of the node, "memory" to keep all databases
+	// in memory instead of the data directory.
+	DBEngine string `toml:",omitempty"`
+
+	// DatabaseMemoryCap is the size cap in megabytes of each in-memory database
+	// (0 = unbounded). Once exceeded, a database spills to disk if DatabaseSpill
+	// is set and refuses further writes otherwise.
+	DatabaseMemoryCap int  `toml:",omitempty"`
+	DatabaseSpill     bool `toml:",omitempty"`
+
+	// InProcOnly restricts the RPC APIs to in-process calls, skipping the IPC
+	// endpoint, the HTTP and WebSocket servers as well as the authenticated RPC
+	// along with its JWT secret.
+	InProcOnly bool `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -379,6 +379,9 @@ func (n *Node) startRPC() error {
 	if err := n.startInProc(n.rpcAPIs); err != nil {
 		return err
 	}
+	if n.config.InProcOnly {
+		return nil
+	}
 
 	// Configure IPC.
 	if n.ipc.endpoint != "" {
@@ -697,12 +700,20 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string, r
 	if n.config.DataDir == "" {
 		db = rawdb.NewMemoryDatabase()
 	} else {
+		var shared string
+		if n.config.SharedDatabase != "" && common.FileExist(filepath.Join(n.config.SharedDatabase, name)) {
+			shared = filepath.Join(n.config.SharedDatabase, name)
+		}
 		db, err = rawdb.Open(rawdb.OpenOptions{
 			Directory: n.ResolvePath(name),
 			Namespace: namespace,
 			Cache:     cache,
 			Handles:   handles,
 			ReadOnly:  readonly,
+			Shared:    shared,
+			Type:      n.config.DBEngine,
+			MemoryCap: uint64(n.config.DatabaseMemoryCap) * 1024 * 1024,
+			Spill:     n.config.DatabaseSpill,
 		})
 	}
 
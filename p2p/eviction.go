@@ -0,0 +1,152 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// EvictionPolicies lists the peer eviction policies selectable by name.
+var EvictionPolicies = []string{"random", "oldest", "lowest-score"}
+
+// PeerScorer rates a peer, the lowest-score eviction policy evicting the peers
+// with the lowest scores first.
+type PeerScorer func(*Peer) float64
+
+// LinkFilter reports whether the network lets the server connect to the node
+// with the given identity.
+type LinkFilter func(id enode.ID) bool
+
+// checkEviction validates the name of an eviction policy.
+func checkEviction(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	for _, name := range EvictionPolicies {
+		if policy == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown peer eviction policy %q (%s)", policy, strings.Join(EvictionPolicies, ", "))
+}
+
+// SetPeerScorer sets the rating of peers used by the lowest-score eviction
+// policy. Without a scorer, all peers score the same.
+func (srv *Server) SetPeerScorer(scorer PeerScorer) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.scorer = scorer
+}
+
+// SetLinkFilter sets the check of the links the server may connect over, which
+// refuses both dials and inbound connections from nodes it rejects. Without a
+// filter, all nodes are reachable.
+func (srv *Server) SetLinkFilter(filter LinkFilter) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.links = filter
+}
+
+// EvictPeers disconnects up to n peers chosen by the eviction policy of the
+// server and returns them. Evicted peers are removed from the static node set,
+// so the dialer looks for other candidates to fill their slots.
+func (srv *Server) EvictPeers(n int) []*Peer {
+	srv.lock.Lock()
+	scorer := srv.scorer
+	srv.lock.Unlock()
+
+	var evicted []*Peer
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		candidates := make([]*Peer, 0, len(peers))
+		for _, p := range peers {
+			candidates = append(candidates, p)
+		}
+		// Shuffle first, so peers ranking equal are evicted at random
+		rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+		switch srv.Eviction {
+		case "oldest":
+			sort.SliceStable(candidates, func(i, j int) bool {
+				return candidates[i].created < candidates[j].created
+			})
+		case "lowest-score":
+			if scorer != nil {
+				scores := make(map[*Peer]float64, len(candidates))
+				for _, p := range candidates {
+					scores[p] = scorer(p)
+				}
+				sort.SliceStable(candidates, func(i, j int) bool {
+					return scores[candidates[i]] < scores[candidates[j]]
+				})
+			}
+		}
+		if len(candidates) > n {
+			candidates = candidates[:n]
+		}
+		for _, p := range candidates {
+			srv.dialsched.removeStatic(p.Node())
+			p.Disconnect(DiscRequested)
+		}
+		evicted = candidates
+	})
+	return evicted
+}
+
+// evictForSlot frees a slot for a new peer by evicting the lowest scoring peer,
+// provided it scores below zero, the neutral score of a newcomer. It reports
+// whether a peer was evicted, and runs on the server loop.
+func (srv *Server) evictForSlot(peers map[enode.ID]*Peer) bool {
+	srv.lock.Lock()
+	scorer := srv.scorer
+	srv.lock.Unlock()
+
+	if scorer == nil {
+		return false
+	}
+	var (
+		lowest      *Peer
+		lowestScore float64
+	)
+	for id, p := range peers {
+		if p.rw.is(trustedConn) || srv.evicting[id] {
+			continue
+		}
+		if score := scorer(p); lowest == nil || score < lowestScore {
+			lowest, lowestScore = p, score
+		}
+	}
+	if lowest == nil || lowestScore >= 0 {
+		return false
+	}
+	if srv.evicting == nil {
+		srv.evicting = make(map[enode.ID]bool)
+	}
+	srv.evicting[lowest.ID()] = true
+	srv.log.Debug("Evicting low scoring peer", "id", lowest.ID(), "score", lowestScore)
+
+	srv.dialsched.removeStatic(lowest.Node())
+	lowest.Disconnect(DiscUselessPeer)
+	return true
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -103,6 +104,7 @@ type PeerEvent struct {
 // Peer represents a connected remote node.
 type Peer struct {
 	rw      *conn
+	self    enode.ID // ID of the local node the peer is connected to
 	running map[string]*protoRW
 	log     log.Logger
 	created mclock.AbsTime
@@ -114,6 +116,17 @@ type Peer struct {
 
 	// events receives message send / receive events if set
 	events *event.Feed
+
+	// Traffic meters of the local node, shared by all its peers
+	ingressMeter       *metrics.Counter
+	ingressPacketMeter *metrics.Counter
+	egressMeter        *metrics.Counter
+	egressPacketMeter  *metrics.Counter
+}
+
+// LocalID returns the ID of the local node the peer is connected to.
+func (p *Peer) LocalID() enode.ID {
+	return p.self
 }
 
 // ID returns the node's public key.
@@ -179,6 +192,11 @@ func (p *Peer) Disconnect(reason DiscReason) {
 	}
 }
 
+// Closed returns a channel which is closed once the connection is torn down.
+func (p *Peer) Closed() <-chan struct{} {
+	return p.closed
+}
+
 // String implements fmt.Stringer.
 func (p *Peer) String() string {
 	id := p.ID()
@@ -190,7 +208,7 @@ func (p *Peer) Inbound() bool {
 	return p.rw.is(inboundConn)
 }
 
-func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
+func newPeer(log log.Logger, conn *conn, protocols []Protocol, registry *metrics.Registry) *Peer {
 	protomap := matchProtocols(protocols, conn.caps, conn)
 	p := &Peer{
 		rw:       conn,
@@ -200,6 +218,11 @@ func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 		protoErr: make(chan error, len(protomap)+1), // protocols + pingLoop
 		closed:   make(chan struct{}),
 		log:      log.New("id", conn.node.ID(), "conn", conn.flags),
+
+		ingressMeter:       registry.Counter("p2p/ingress"),
+		ingressPacketMeter: registry.Counter("p2p/ingress/packets"),
+		egressMeter:        registry.Counter("p2p/egress"),
+		egressPacketMeter:  registry.Counter("p2p/egress/packets"),
 	}
 	return p
 }
@@ -285,6 +308,8 @@ func (p *Peer) readLoop(errc chan<- error) {
 			return
 		}
 		msg.ReceivedAt = time.Now()
+		p.ingressMeter.Inc(int64(msg.Size))
+		p.ingressPacketMeter.Inc(1)
 		if err = p.handle(msg); err != nil {
 			errc <- err
 			return
@@ -366,6 +391,8 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		proto.closed = p.closed
 		proto.wstart = writeStart
 		proto.werr = writeErr
+		proto.egressMeter = p.egressMeter
+		proto.egressPacketMeter = p.egressPacketMeter
 		var rw MsgReadWriter = proto
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name, p.Info().Network.RemoteAddress, p.Info().Network.LocalAddress)
@@ -404,6 +431,9 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	egressMeter       *metrics.Counter
+	egressPacketMeter *metrics.Counter
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
@@ -417,7 +447,12 @@ func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 
 	select {
 	case <-rw.wstart:
+		size := msg.Size
 		err = rw.w.WriteMsg(msg)
+		if err == nil {
+			rw.egressMeter.Inc(int64(size))
+			rw.egressPacketMeter.Inc(1)
+		}
 		// Report write status back to Peer.run. It will initiate
 		// shutdown if the error is non-nil and unblock the next write
 		// otherwise. The calling protocol code should exit for errors
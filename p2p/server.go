@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/enr"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
@@ -122,6 +123,19 @@ type Config struct {
 	// If NoDial is true, the server will not dial any peers.
 	NoDial bool `toml:",omitempty"`
 
+	// Discovery is the source of dial candidates beyond the static nodes, which
+	// the dialer connects to within MaxPeers and DialRatio. No candidates are
+	// found if it is nil.
+	Discovery enode.Iterator `toml:"-"`
+
+	// Eviction is the policy choosing the peers dropped by EvictPeers, one of
+	// EvictionPolicies. Empty selects random eviction.
+	Eviction string `toml:",omitempty"`
+
+	// ScoreEviction makes room for new peers when all slots are taken, evicting
+	// the lowest scoring peer if it scores below a newcomer.
+	ScoreEviction bool `toml:",omitempty"`
+
 	// If EnableMsgEvents is set then the server will emit PeerEvents
 	// whenever a message is sent to or received from a peer
 	EnableMsgEvents bool
@@ -129,6 +143,10 @@ type Config struct {
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
+	// Metrics is the registry of the emulated node to report peer counts and
+	// traffic to. Nothing is reported if it is nil.
+	Metrics *metrics.Registry `toml:"-"`
+
 	clock mclock.Clock
 }
 
@@ -155,6 +173,9 @@ type Server struct {
 	localnode *enode.LocalNode
 	discmix   *enode.FairMix
 	dialsched *dialScheduler
+	scorer    PeerScorer        // Rating of peers for eviction, protected by lock
+	links     LinkFilter        // Check of the links to peers, protected by lock
+	evicting  map[enode.ID]bool // Peers disconnected to free a slot, owned by the run loop
 
 	// Channels into the run loop.
 	quit                    chan struct{}
@@ -397,6 +418,9 @@ func (srv *Server) Start() (err error) {
 	}
 
 	// static fields
+	if err := checkEviction(srv.Eviction); err != nil {
+		return err
+	}
 	if srv.PrivateKey == nil {
 		return errors.New("Server.PrivateKey must be set to a non-nil key")
 	}
@@ -457,6 +481,9 @@ func (srv *Server) setupLocalNode() error {
 func (srv *Server) setupDiscovery() error {
 	srv.discmix = enode.NewFairMix(discmixTimeout)
 
+	if srv.Discovery != nil {
+		srv.discmix.AddSource(srv.Discovery)
+	}
 	return nil
 }
 
@@ -591,6 +618,7 @@ running:
 				// The handshakes are done and it passed all checks.
 				p := srv.launchPeer(c)
 				peers[c.node.ID()] = p
+				srv.Metrics.Gauge("p2p/peers").Update(int64(len(peers)))
 				srv.log.Debug("Adding p2p peer", "peercount", len(peers), "id", p.ID(), "conn", c.flags, "addr", p.RemoteAddr(), "name", p.Name())
 				srv.dialsched.peerAdded(c)
 				if p.Inbound() {
@@ -603,6 +631,8 @@ running:
 			// A peer disconnected.
 			d := common.PrettyDuration(mclock.Now() - pd.created)
 			delete(peers, pd.ID())
+			delete(srv.evicting, pd.ID())
+			srv.Metrics.Gauge("p2p/peers").Update(int64(len(peers)))
 			srv.log.Debug("Removing p2p peer", "peercount", len(peers), "id", pd.ID(), "duration", d, "req", pd.requested, "err", pd.err)
 			srv.dialsched.peerRemoved(pd.rw)
 			if pd.Inbound() {
@@ -628,8 +658,11 @@ running:
 }
 
 func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
+	// Peers already being evicted have given up their slots
+	full := !c.is(trustedConn) && len(peers)-len(srv.evicting) >= srv.MaxPeers
+
 	switch {
-	case !c.is(trustedConn) && len(peers) >= srv.MaxPeers:
+	case full && !srv.ScoreEviction:
 		return DiscTooManyPeers
 	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
 		return DiscTooManyPeers
@@ -637,6 +670,8 @@ func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount in
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case full && !srv.evictForSlot(peers):
+		return DiscTooManyPeers
 	default:
 		return nil
 	}
@@ -782,6 +817,13 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 		c.node = nodeFromConn(remotePubkey, c.fd)
 	}
 	clog := srv.log.New("id", c.node.ID(), "addr", c.fd.RemoteAddr(), "conn", c.flags)
+	srv.lock.Lock()
+	filter := srv.links
+	srv.lock.Unlock()
+	if filter != nil && !filter(c.node.ID()) {
+		clog.Trace("Rejected unreachable peer")
+		return DiscNetworkError
+	}
 	err = srv.checkpoint(c, srv.checkpointPostHandshake)
 	if err != nil {
 		clog.Trace("Rejected peer", "err", err)
@@ -830,7 +872,8 @@ func (srv *Server) checkpoint(c *conn, stage chan<- *conn) error {
 }
 
 func (srv *Server) launchPeer(c *conn) *Peer {
-	p := newPeer(srv.log, c, srv.Protocols)
+	p := newPeer(srv.log, c, srv.Protocols, srv.Metrics)
+	p.self = srv.localnode.ID()
 	if srv.EnableMsgEvents {
 		// If message events are enabled, pass the peerFeed
 		// to the peer.
@@ -20,8 +20,15 @@ import (
 	"container/list"
 	"sync"
 	"time"
+
+	"github.com/ethereum/go-ethereum/log"
 )
 
+// maxTrackedPackets is a huge number to act as a failsafe on the number of
+// pending requests the node will track. It should never be hit unless an
+// attacker figures out a way to spin requests.
+const maxTrackedPackets = 100000
+
 // request tracks sent network requests which have not yet received a response.
 type request struct {
 	peer    string
@@ -44,6 +51,9 @@ type Tracker struct {
 	expire  *list.List          // Linked list tracking the expiration order
 	wake    *time.Timer         // Timer tracking the expiration of the next item
 
+	expired func(peer string, reqCode uint64) // Callback for requests timing out
+	stopped bool                              // Whether the tracker was stopped
+
 	lock sync.Mutex // Lock protecting from concurrent updates
 }
 
@@ -58,12 +68,128 @@ func New(protocol string, timeout time.Duration) *Tracker {
 	}
 }
 
+// OnExpire sets a callback invoked with the peer and the request code of every
+// request timing out without a response.
+func (t *Tracker) OnExpire(fn func(peer string, reqCode uint64)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.expired = fn
+}
+
+// Track adds a network request to the tracker to wait for a response to arrive
+// or until the request times out.
+func (t *Tracker) Track(peer string, version uint, reqCode uint64, resCode uint64, id uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.stopped {
+		return
+	}
+	// If there's a duplicate request, we've just random-collided (or more probably,
+	// we have a bug), report it.
+	if _, ok := t.pending[id]; ok {
+		log.Error("Network request id collision", "protocol", t.protocol, "version", version, "code", reqCode, "id", id)
+		return
+	}
+	// If we have too many pending requests, bail out instead of leaking memory
+	if pending := len(t.pending); pending >= maxTrackedPackets {
+		log.Error("Request tracker exceeded allowance", "pending", pending, "peer", peer, "protocol", t.protocol, "version", version, "code", reqCode)
+		return
+	}
+	// Id doesn't exist yet, start tracking it
+	t.pending[id] = &request{
+		peer:    peer,
+		version: version,
+		reqCode: reqCode,
+		resCode: resCode,
+		time:    time.Now(),
+		expire:  t.expire.PushBack(id),
+	}
+	// If we've just inserted the first item, start the expiration timer
+	if t.wake == nil {
+		t.schedule()
+	}
+}
+
+// Fulfil fills a pending request, if any is found, and reports whether the
+// response was tracked.
+func (t *Tracker) Fulfil(peer string, version uint, code uint64, id uint64) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// If it's a non existing request, track as stale response
+	req, ok := t.pending[id]
+	if !ok {
+		return false
+	}
+	// If the response is funky, it might be some active attack
+	if req.peer != peer || req.version != version || req.resCode != code {
+		log.Warn("Network response id collision", "have", peer, "want", req.peer, "version", version, "code", code, "id", id)
+		return false
+	}
+	// Everything matches, mark the request serviced
+	t.remove(id, req)
+	return true
+}
+
+// Untrack stops tracking a request which was cancelled before its response
+// arrived, so that it neither expires nor counts as answered.
+func (t *Tracker) Untrack(peer string, id uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if req, ok := t.pending[id]; ok && req.peer == peer {
+		t.remove(id, req)
+	}
+}
+
+// remove drops a pending request, rescheduling the expiration timer if it was
+// waiting on it. The lock must be held.
+func (t *Tracker) remove(id uint64, req *request) {
+	first := req.expire.Prev() == nil
+	t.expire.Remove(req.expire)
+	delete(t.pending, id)
+	if first && t.wake != nil && t.wake.Stop() {
+		t.schedule()
+	}
+}
+
+// Stop drops all pending requests without reporting them as expired.
+func (t *Tracker) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.stopped = true
+	if t.wake != nil {
+		t.wake.Stop()
+		t.wake = nil
+	}
+	t.pending = make(map[uint64]*request)
+	t.expire.Init()
+}
+
 // clean is called automatically when a preset time passes without a response
 // being delivered for the first network request.
 func (t *Tracker) clean() {
+	var dead []*request
+	defer func() {
+		t.lock.Lock()
+		expired := t.expired
+		t.lock.Unlock()
+
+		if expired != nil {
+			for _, req := range dead {
+				expired(req.peer, req.reqCode)
+			}
+		}
+	}()
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	if t.stopped {
+		return
+	}
 	// Expire anything within a certain threshold (might be no items at all if
 	// we raced with the delivery)
 	for t.expire.Len() > 0 {
@@ -79,6 +205,7 @@ func (t *Tracker) clean() {
 		// Nope, dead, drop it
 		t.expire.Remove(head)
 		delete(t.pending, id)
+		dead = append(dead, req)
 	}
 	t.schedule()
 }
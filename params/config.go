@@ -442,6 +442,7 @@ type ChainConfig struct {
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
+	BFT    *BFTConfig    `json:"bft,omitempty"`
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -463,6 +464,19 @@ func (c *CliqueConfig) String() string {
 	return "clique"
 }
 
+// BFTConfig is the consensus engine configs for leader-based BFT sealing with
+// immediate finality.
+type BFTConfig struct {
+	Period       uint64           `json:"period"`       // Number of seconds between blocks to enforce
+	RoundTimeout uint64           `json:"roundTimeout"` // Base timeout of a consensus round step in milliseconds
+	Validators   []common.Address `json:"validators"`   // Fixed set of validators allowed to propose and vote
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (c *BFTConfig) String() string {
+	return "bft"
+}
+
 // Description returns a human-readable description of ChainConfig.
 func (c *ChainConfig) Description() string {
 	var banner string
@@ -490,6 +504,8 @@ func (c *ChainConfig) Description() string {
 		} else {
 			banner += "Consensus: Beacon (proof-of-stake), merged from Clique (proof-of-authority)\n"
 		}
+	case c.BFT != nil:
+		banner += fmt.Sprintf("Consensus: BFT (%d validators, immediate finality)\n", len(c.BFT.Validators))
 	default:
 		banner += "Consensus: unknown\n"
 	}